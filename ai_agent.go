@@ -682,11 +682,48 @@ func (a *App) UpdateAgentConfig(config *AgentConfig) error {
 		return fmt.Errorf("AI agent not initialized")
 	}
 
+	if config == nil {
+		return fmt.Errorf("agent configuration is empty")
+	}
+
 	a.aiAgent.mu.Lock()
 	defer a.aiAgent.mu.Unlock()
 
 	a.aiAgent.config = config
-	runtime.LogInfo(a.app.ctx, "Agent configuration updated")
+	runtime.LogInfo(a.ctx, "Agent configuration updated")
 
+	// The API key goes to the encrypted secret store, never to settings.json.
+	if a.secrets == nil {
+		return fmt.Errorf("agent configuration applied but not persisted: secret store unavailable")
+	}
+	if err := a.secrets.Set(secretAgentAPIKey, config.APIKey); err != nil {
+		return fmt.Errorf("agent configuration applied but API key not persisted: %w", err)
+	}
+	persisted := *config
+	persisted.APIKey = ""
+	a.settings.AgentConfig = &persisted
+	if err := a.saveSettings(); err != nil {
+		return fmt.Errorf("agent configuration applied but not persisted: %w", err)
+	}
 	return nil
 }
+
+// restoreAgentConfig applies the persisted agent configuration, if any, and
+// reads the API key back from the secret store.
+func (a *App) restoreAgentConfig() {
+	if a.aiAgent == nil || a.settings.AgentConfig == nil {
+		return
+	}
+	config := *a.settings.AgentConfig
+	if a.secrets != nil {
+		apiKey, err := a.secrets.Get(secretAgentAPIKey)
+		if err != nil {
+			runtime.LogWarningf(a.ctx, "Failed to read agent API key: %v", err)
+		}
+		config.APIKey = apiKey
+	}
+	a.aiAgent.mu.Lock()
+	a.aiAgent.config = &config
+	a.aiAgent.mu.Unlock()
+	runtime.LogInfo(a.ctx, "Restored agent configuration from settings")
+}
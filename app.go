@@ -29,8 +29,17 @@ var defaultCustomIgnoreRulesContent string
 const defaultCustomPromptRulesContent = "no additional rules"
 
 type AppSettings struct {
-	CustomIgnoreRules string `json:"customIgnoreRules"`
-	CustomPromptRules string `json:"customPromptRules"`
+	Version             int                         `json:"version"` // Schema version, see settings.go
+	CustomIgnoreRules   string                      `json:"customIgnoreRules"`
+	CustomPromptRules   string                      `json:"customPromptRules"`
+	SelectionProfiles   map[string]*ProjectProfiles `json:"selectionProfiles,omitempty"`   // Keyed by project root
+	PromptTemplates     []PromptTemplate            `json:"promptTemplates"`               // nil (null) means the built-in templates; empty means all were deleted
+	ProjectPromptRules  map[string]string           `json:"projectPromptRules,omitempty"`  // Keyed by project root
+	LanguagePromptRules map[string]string           `json:"languagePromptRules,omitempty"` // Keyed by language (see languageForPath)
+	UseGitignore        *bool                       `json:"useGitignore,omitempty"`        // nil means the default (true)
+	UseCustomIgnore     *bool                       `json:"useCustomIgnore,omitempty"`     // nil means the default (true)
+	AgentConfig         *AgentConfig                `json:"agentConfig,omitempty"`         // APIKey is kept in the secret store
+	UIState             map[string]interface{}      `json:"uiState,omitempty"`             // Opaque frontend state (last step, panel sizes, ...)
 }
 
 type App struct {
@@ -40,6 +49,9 @@ type App struct {
 	computerVision              *ComputerVision
 	computerAutomation          *ComputerAutomation
 	aiAgent                     *AIAgent
+	symbolIndexer               *SymbolIndexer
+	contextArchive              *ContextArchive
+	secrets                     *SecretStore
 	settings                    AppSettings
 	currentCustomIgnorePatterns *gitignore.GitIgnore
 	configPath                  string
@@ -59,6 +71,8 @@ func (a *App) startup(ctx context.Context) {
 	a.computerVision = NewComputerVision(a)
 	a.computerAutomation = NewComputerAutomation(a)
 	a.aiAgent = NewAIAgent(a)
+	a.symbolIndexer = NewSymbolIndexer(a)
+	a.contextArchive = NewContextArchive(a)
 	a.useGitignore = true    // Default to true, matching frontend
 	a.useCustomIgnore = true // Default to true, matching frontend
 
@@ -70,11 +84,23 @@ func (a *App) startup(ctx context.Context) {
 	}
 	a.configPath = configFilePath
 
+	a.secrets, err = NewSecretStore(runtimeLog{a.ctx})
+	if err != nil {
+		runtime.LogErrorf(a.ctx, "Error initializing secret store: %v. Secrets will not be persisted.", err)
+	}
+
 	a.loadSettings()
 	// Ensure CustomPromptRules has a default if it's empty after loading
 	if strings.TrimSpace(a.settings.CustomPromptRules) == "" {
 		a.settings.CustomPromptRules = defaultCustomPromptRulesContent
 	}
+	if a.settings.UseGitignore != nil {
+		a.useGitignore = *a.settings.UseGitignore
+	}
+	if a.settings.UseCustomIgnore != nil {
+		a.useCustomIgnore = *a.settings.UseCustomIgnore
+	}
+	a.restoreAgentConfig()
 }
 
 type FileNode struct {
@@ -204,18 +230,26 @@ func buildTreeRecursive(ctx context.Context, currentPath, rootPath string, gitIg
 		nodes = append(nodes, node)
 	}
 	// Sort nodes: directories first, then files, then alphabetically
-	sort.SliceStable(nodes, func(i, j int) bool {
-		if nodes[i].IsDir && !nodes[j].IsDir {
-			return true
-		}
-		if !nodes[i].IsDir && nodes[j].IsDir {
-			return false
-		}
-		return strings.ToLower(nodes[i].Name) < strings.ToLower(nodes[j].Name)
+	sort.Slice(nodes, func(i, j int) bool {
+		return treeEntryLess(nodes[i].Name, nodes[i].IsDir, nodes[j].Name, nodes[j].IsDir)
 	})
 	return nodes, nil
 }
 
+// treeEntryLess orders directories before files, then names case-insensitively.
+// Names that differ only in case are ordered byte-wise, so the order is total
+// and does not depend on the order the OS returned the entries in.
+func treeEntryLess(nameI string, isDirI bool, nameJ string, isDirJ bool) bool {
+	if isDirI != isDirJ {
+		return isDirI
+	}
+	lowerI, lowerJ := strings.ToLower(nameI), strings.ToLower(nameJ)
+	if lowerI != lowerJ {
+		return lowerI < lowerJ
+	}
+	return nameI < nameJ
+}
+
 // ContextGenerator manages the asynchronous generation of shotgun context
 type ContextGenerator struct {
 	app                *App // To access Wails runtime context for emitting events
@@ -231,7 +265,9 @@ func NewContextGenerator(app *App) *ContextGenerator {
 // RequestShotgunContextGeneration is called by the frontend to start/restart generation.
 // This method itself is not bound to Wails directly if it's part of App.
 // Instead, a wrapper method in App struct will be bound.
-func (cg *ContextGenerator) requestShotgunContextGenerationInternal(rootDir string, excludedPaths []string) {
+// rootDir is only used for logging and messages; generate produces the actual output.
+// A successful output is archived under archiveEntry unless it is nil.
+func (cg *ContextGenerator) requestShotgunContextGenerationInternal(rootDir string, archiveEntry *ContextArchiveEntry, generate func(jobCtx context.Context) (string, error)) {
 	cg.mu.Lock()
 	if cg.currentCancelFunc != nil {
 		runtime.LogDebug(cg.app.ctx, "Cancelling previous context generation job.")
@@ -265,7 +301,7 @@ func (cg *ContextGenerator) requestShotgunContextGenerationInternal(rootDir stri
 			return
 		}
 
-		output, err := cg.app.generateShotgunOutputWithProgress(genCtx, rootDir, excludedPaths)
+		output, err := generate(genCtx)
 
 		select {
 		case <-genCtx.Done():
@@ -285,25 +321,43 @@ func (cg *ContextGenerator) requestShotgunContextGenerationInternal(rootDir stri
 				}
 				runtime.LogInfo(cg.app.ctx, successMsg)
 				runtime.EventsEmit(cg.app.ctx, "shotgunContextGenerated", output)
+				cg.app.archiveGeneration(archiveEntry, output)
 			}
 		}
 	}(myToken) // Pass the token to the goroutine
 }
 
+// ContextGenerationOptions controls how file contents are rendered into the context.
+type ContextGenerationOptions struct {
+	RenderMode    string   `json:"renderMode"`    // RenderModeFull (default) or RenderModeOutline
+	FocusPaths    []string `json:"focusPaths"`    // Relative paths (files or dirs) always rendered in full in outline mode
+	Transforms    []string `json:"transforms"`    // Minification transforms applied to each file body (see transforms.go)
+	EmbedManifest bool     `json:"embedManifest"` // Prefix the output with the manifest and context hash
+}
+
 // RequestShotgunContextGeneration is the method bound to Wails.
 func (a *App) RequestShotgunContextGeneration(rootDir string, excludedPaths []string) {
+	a.RequestShotgunContextGenerationWithOptions(rootDir, excludedPaths, ContextGenerationOptions{})
+}
+
+// RequestShotgunContextGenerationWithOptions starts generation with explicit rendering options.
+func (a *App) RequestShotgunContextGenerationWithOptions(rootDir string, excludedPaths []string, opts ContextGenerationOptions) {
 	if a.contextGenerator == nil {
 		// This should not happen if startup initializes it correctly
 		runtime.LogError(a.ctx, "ContextGenerator not initialized")
 		runtime.EventsEmit(a.ctx, "shotgunContextError", "Internal error: ContextGenerator not initialized")
 		return
 	}
-	a.contextGenerator.requestShotgunContextGenerationInternal(rootDir, excludedPaths)
+	archiveEntry := &ContextArchiveEntry{Roots: []string{rootDir}, ExcludedPaths: excludedPaths, Options: opts}
+	a.contextGenerator.requestShotgunContextGenerationInternal(rootDir, archiveEntry, func(jobCtx context.Context) (string, error) {
+		return a.generateShotgunOutputWithProgress(jobCtx, rootDir, excludedPaths, opts)
+	})
 }
 
 // countProcessableItems estimates the total number of operations for progress tracking.
 // Operations: 1 for root dir line, 1 for each dir/file entry in tree, 1 for each file content read.
-func (a *App) countProcessableItems(jobCtx context.Context, rootDir string, excludedMap map[string]bool) (int, error) {
+func (a *App) countProcessableItems(jobCtx context.Context, root *contextRoot) (int, error) {
+	rootDir := root.dir
 	count := 1 // For the root directory line itself
 
 	var counterHelper func(currentPath string) error
@@ -314,7 +368,7 @@ func (a *App) countProcessableItems(jobCtx context.Context, rootDir string, excl
 		default:
 		}
 
-		entries, err := os.ReadDir(currentPath)
+		entries, err := root.readDir(currentPath)
 		if err != nil {
 			runtime.LogWarningf(a.ctx, "countProcessableItems: error reading dir %s: %v", currentPath, err)
 			return nil // Continue counting other parts if a subdir is inaccessible
@@ -324,7 +378,7 @@ func (a *App) countProcessableItems(jobCtx context.Context, rootDir string, excl
 			path := filepath.Join(currentPath, entry.Name())
 			relPath, _ := filepath.Rel(rootDir, path)
 
-			if excludedMap[relPath] {
+			if root.isExcluded(relPath, entry.IsDir()) {
 				continue
 			}
 
@@ -355,51 +409,113 @@ type generationProgressState struct {
 }
 
 func (a *App) emitProgress(state *generationProgressState) {
-	runtime.EventsEmit(a.ctx, "shotgunContextGenerationProgress", map[string]int{
+	a.emitEvent("shotgunContextGenerationProgress", map[string]int{
 		"current": state.processedItems,
 		"total":   state.totalItems,
 	})
 }
 
-// generateShotgunOutputWithProgress generates the TXT output with progress reporting and size limits
-func (a *App) generateShotgunOutputWithProgress(jobCtx context.Context, rootDir string, excludedPaths []string) (string, error) {
-	if err := jobCtx.Err(); err != nil { // Check for cancellation at the beginning
-		return "", err
+// emitEvent sends an event to the frontend. Without a Wails context, as when
+// generating outside the app, there is no frontend and it does nothing.
+func (a *App) emitEvent(eventName string, data ...interface{}) {
+	if a.ctx == nil {
+		return
 	}
+	runtime.EventsEmit(a.ctx, eventName, data...)
+}
 
-	excludedMap := make(map[string]bool)
-	for _, p := range excludedPaths {
-		excludedMap[p] = true
+// contextRoot is one directory tree rendered into the generated context.
+type contextRoot struct {
+	dir      string
+	alias    string                 // Label of the tree and prefix of <file> paths; empty for single-root output
+	excluded map[string]bool        // Relative paths excluded by the user
+	ignores  []*gitignore.GitIgnore // Ignore rules evaluated against paths relative to dir
+	label    string                 // Tree header override, e.g. "repo@v1.2/"
+	fsys     fs.FS                  // Source of files rooted at dir; nil reads the working tree
+}
+
+// readDir lists a directory of the root, given as a path under dir.
+func (r *contextRoot) readDir(dirPath string) ([]fs.DirEntry, error) {
+	if r.fsys == nil {
+		return os.ReadDir(dirPath)
 	}
+	relPath, err := filepath.Rel(r.dir, dirPath)
+	if err != nil {
+		return nil, err
+	}
+	return fs.ReadDir(r.fsys, filepath.ToSlash(relPath))
+}
 
-	totalItems, err := a.countProcessableItems(jobCtx, rootDir, excludedMap)
+// readFile reads a file of the root, given as a path under dir.
+func (r *contextRoot) readFile(filePath string) ([]byte, error) {
+	if r.fsys == nil {
+		return os.ReadFile(filePath)
+	}
+	relPath, err := filepath.Rel(r.dir, filePath)
 	if err != nil {
-		return "", fmt.Errorf("failed to count processable items: %w", err)
+		return nil, err
+	}
+	return fs.ReadFile(r.fsys, filepath.ToSlash(relPath))
+}
+
+func (r *contextRoot) isExcluded(relPath string, isDir bool) bool {
+	if r.excluded[relPath] {
+		return true
+	}
+	pathToMatch := relPath
+	if isDir {
+		pathToMatch += string(os.PathSeparator)
+	}
+	for _, ign := range r.ignores {
+		if ign != nil && ign.MatchesPath(pathToMatch) {
+			return true
+		}
+	}
+	return false
+}
+
+// generateShotgunOutputWithProgress generates the TXT output with progress reporting and size limits
+func (a *App) generateShotgunOutputWithProgress(jobCtx context.Context, rootDir string, excludedPaths []string, opts ContextGenerationOptions) (string, error) {
+	root := &contextRoot{dir: rootDir, excluded: make(map[string]bool)}
+	for _, p := range excludedPaths {
+		root.excluded[p] = true
+	}
+	return a.generateContextOutput(jobCtx, []*contextRoot{root}, opts)
+}
+
+// generateContextOutput renders the tree of every root, then the file blocks of all roots.
+func (a *App) generateContextOutput(jobCtx context.Context, roots []*contextRoot, opts ContextGenerationOptions) (string, error) {
+	if err := jobCtx.Err(); err != nil { // Check for cancellation at the beginning
+		return "", err
+	}
+
+	totalItems := 0
+	for _, root := range roots {
+		rootItems, err := a.countProcessableItems(jobCtx, root)
+		if err != nil {
+			return "", fmt.Errorf("failed to count processable items: %w", err)
+		}
+		totalItems += rootItems
 	}
 	progressState := &generationProgressState{processedItems: 0, totalItems: totalItems}
 	a.emitProgress(progressState) // Initial progress (0 / total)
 
 	var output strings.Builder
 	var fileContents strings.Builder
-
-	// Root directory line
-	output.WriteString(filepath.Base(rootDir) + string(os.PathSeparator) + "\n")
-	progressState.processedItems++
-	a.emitProgress(progressState)
-	if output.Len() > maxOutputSizeBytes {
-		return "", fmt.Errorf("%w: content limit of %d bytes exceeded after root dir line (size: %d bytes)", ErrContextTooLong, maxOutputSizeBytes, output.Len())
-	}
+	var transformStats []FileTransformStats
+	var manifestEntries []ContextManifestEntry
 
 	// buildShotgunTreeRecursive is a recursive helper for generating the tree string and file contents
-	var buildShotgunTreeRecursive func(pCtx context.Context, currentPath, prefix string) error
-	buildShotgunTreeRecursive = func(pCtx context.Context, currentPath, prefix string) error {
+	var buildShotgunTreeRecursive func(pCtx context.Context, root *contextRoot, currentPath, prefix string) error
+	buildShotgunTreeRecursive = func(pCtx context.Context, root *contextRoot, currentPath, prefix string) error {
+		rootDir := root.dir
 		select {
 		case <-pCtx.Done():
 			return pCtx.Err()
 		default:
 		}
 
-		entries, err := os.ReadDir(currentPath)
+		entries, err := root.readDir(currentPath)
 		if err != nil {
 			runtime.LogWarningf(a.ctx, "buildShotgunTreeRecursive: error reading dir %s: %v", currentPath, err)
 			// Decide if this error should halt the entire process or just skip this directory
@@ -408,18 +524,8 @@ func (a *App) generateShotgunOutputWithProgress(jobCtx context.Context, rootDir
 		}
 
 		// Sort entries like in ListFiles for consistent tree
-		sort.SliceStable(entries, func(i, j int) bool {
-			entryI := entries[i]
-			entryJ := entries[j]
-			isDirI := entryI.IsDir()
-			isDirJ := entryJ.IsDir()
-			if isDirI && !isDirJ {
-				return true
-			}
-			if !isDirI && isDirJ {
-				return false
-			}
-			return strings.ToLower(entryI.Name()) < strings.ToLower(entryJ.Name())
+		sort.Slice(entries, func(i, j int) bool {
+			return treeEntryLess(entries[i].Name(), entries[i].IsDir(), entries[j].Name(), entries[j].IsDir())
 		})
 
 		// Create a temporary slice to hold non-excluded entries for correct prefixing
@@ -427,7 +533,7 @@ func (a *App) generateShotgunOutputWithProgress(jobCtx context.Context, rootDir
 		for _, entry := range entries {
 			path := filepath.Join(currentPath, entry.Name())
 			relPath, _ := filepath.Rel(rootDir, path)
-			if !excludedMap[relPath] {
+			if !root.isExcluded(relPath, entry.IsDir()) {
 				visibleEntries = append(visibleEntries, entry)
 			}
 		}
@@ -460,7 +566,7 @@ func (a *App) generateShotgunOutputWithProgress(jobCtx context.Context, rootDir
 			}
 
 			if entry.IsDir() {
-				err := buildShotgunTreeRecursive(pCtx, path, nextPrefix)
+				err := buildShotgunTreeRecursive(pCtx, root, path, nextPrefix)
 				if err != nil {
 					if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
 						return err
@@ -473,7 +579,7 @@ func (a *App) generateShotgunOutputWithProgress(jobCtx context.Context, rootDir
 					return pCtx.Err()
 				default:
 				}
-				content, err := os.ReadFile(path)
+				content, err := root.readFile(path)
 				if err != nil {
 					fmt.Printf("Error reading file %s: %v\n", path, err)
 					content = []byte(fmt.Sprintf("Error reading file: %v", err))
@@ -481,9 +587,27 @@ func (a *App) generateShotgunOutputWithProgress(jobCtx context.Context, rootDir
 
 				// Ensure forward slashes for the name attribute, consistent with documentation.
 				relPathForwardSlash := filepath.ToSlash(relPath)
+				if root.alias != "" {
+					relPathForwardSlash = root.alias + "/" + relPathForwardSlash
+				}
 
-				fileContents.WriteString(fmt.Sprintf("<file path=\"%s\">\n", relPathForwardSlash))
-				fileContents.WriteString(string(content))
+				openTag := fmt.Sprintf("<file path=\"%s\">\n", relPathForwardSlash)
+				body := string(content)
+				if opts.RenderMode == RenderModeOutline && !isFocusPath(relPathForwardSlash, opts.FocusPaths) {
+					if outline, ok := outlineSource(relPathForwardSlash, content); ok {
+						openTag = fmt.Sprintf("<file path=\"%s\" mode=\"outline\">\n", relPathForwardSlash)
+						body = outline
+					}
+				}
+				if len(opts.Transforms) > 0 {
+					var stats FileTransformStats
+					body, stats = applyTransforms(relPathForwardSlash, body, opts.Transforms)
+					transformStats = append(transformStats, stats)
+				}
+				manifestEntries = append(manifestEntries, newManifestEntry(relPathForwardSlash, body))
+
+				fileContents.WriteString(openTag)
+				fileContents.WriteString(body)
 				fileContents.WriteString("\n</file>\n") // Each file block ends with a newline
 
 				progressState.processedItems++ // For file content
@@ -497,20 +621,54 @@ func (a *App) generateShotgunOutputWithProgress(jobCtx context.Context, rootDir
 		return nil
 	}
 
-	err = buildShotgunTreeRecursive(jobCtx, rootDir, "")
-	if err != nil {
-		return "", fmt.Errorf("failed to build tree for shotgun: %w", err)
+	for i, root := range roots {
+		if i > 0 {
+			output.WriteString("\n") // Blank line between the trees of a multi-root workspace
+		}
+		// Root directory line
+		if root.label != "" {
+			output.WriteString(root.label + "\n")
+		} else if root.alias != "" {
+			output.WriteString(root.alias + "/\n")
+		} else {
+			output.WriteString(filepath.Base(root.dir) + string(os.PathSeparator) + "\n")
+		}
+		progressState.processedItems++
+		a.emitProgress(progressState)
+		if output.Len() > maxOutputSizeBytes {
+			return "", fmt.Errorf("%w: content limit of %d bytes exceeded after root dir line (size: %d bytes)", ErrContextTooLong, maxOutputSizeBytes, output.Len())
+		}
+
+		if err := buildShotgunTreeRecursive(jobCtx, root, root.dir, ""); err != nil {
+			return "", fmt.Errorf("failed to build tree for shotgun: %w", err)
+		}
 	}
 
 	if err := jobCtx.Err(); err != nil { // Check for cancellation before final string operations
 		return "", err
 	}
 
+	if len(opts.Transforms) > 0 {
+		bytesSaved, tokensSaved := 0, 0
+		for _, s := range transformStats {
+			bytesSaved += s.BytesSaved
+			tokensSaved += s.TokensSaved
+		}
+		runtime.LogInfof(a.ctx, "Transforms %v saved %d bytes (~%d tokens) across %d files", opts.Transforms, bytesSaved, tokensSaved, len(transformStats))
+		a.emitEvent("shotgunContextTransformStats", transformStats)
+	}
+
 	// The final output is the tree, a newline, then all concatenated file contents.
 	// If fileContents is empty, we still want the newline after the tree.
 	// If fileContents is not empty, it already ends with a newline, so an extra one might not be desired
 	// depending on how it's structured. Given each <file> block ends with \n, this should be fine.
-	return output.String() + "\n" + strings.TrimRight(fileContents.String(), "\n"), nil
+	result := output.String() + "\n" + strings.TrimRight(fileContents.String(), "\n")
+	manifest := newContextManifest(manifestEntries, result)
+	a.emitEvent("shotgunContextManifest", manifest)
+	if opts.EmbedManifest {
+		result = manifest.header() + result
+	}
+	return result, nil
 }
 
 // --- Watchman Implementation ---
@@ -790,6 +948,9 @@ func (w *Watchman) addPathsToWatcherRecursive(baseDirToAdd string) {
 
 // notifyFileChange is an internal method for the App to emit a Wails event.
 func (a *App) notifyFileChange(rootDir string) {
+	if a.symbolIndexer != nil {
+		a.symbolIndexer.Invalidate()
+	}
 	runtime.EventsEmit(a.ctx, "projectFilesChanged", rootDir)
 }
 
@@ -848,19 +1009,22 @@ func (a *App) compileCustomIgnorePatterns() error {
 		runtime.LogDebug(a.ctx, "Custom ignore rules are empty, no patterns compiled.")
 		return nil
 	}
-	lines := strings.Split(strings.ReplaceAll(a.settings.CustomIgnoreRules, "\r\n", "\n"), "\n")
-	var validLines []string
-	for _, line := range lines {
-		// CompileIgnoreLines should handle empty/comment lines appropriately based on .gitignore syntax
-		validLines = append(validLines, line)
+	lines := splitIgnoreRules(a.settings.CustomIgnoreRules)
+
+	// CompileIgnoreLines silently drops lines it cannot compile, so validate separately.
+	issues, _ := validateIgnoreRules(a.settings.CustomIgnoreRules)
+	var broken []string
+	for _, issue := range issues {
+		runtime.LogWarningf(a.ctx, "Custom ignore rule line %d (%q): %s", issue.Line, issue.Rule, issue.Message)
+		if issue.Severity == IgnoreIssueError {
+			broken = append(broken, fmt.Sprintf("line %d: %s", issue.Line, issue.Message))
+		}
 	}
 
-	ign := gitignore.CompileIgnoreLines(validLines...)
-	// Поскольку CompileIgnoreLines в этой версии не возвращает ошибку,
-	// проверка на err удалена.
-	// Если ign будет nil (например, если все строки были пустыми или комментариями,
-	// и библиотека так обрабатывает), то это будет корректно обработано ниже.
-	a.currentCustomIgnorePatterns = ign
+	a.currentCustomIgnorePatterns = gitignore.CompileIgnoreLines(lines...)
+	if len(broken) > 0 {
+		return fmt.Errorf("invalid custom ignore rules (%s)", strings.Join(broken, "; "))
+	}
 	runtime.LogInfo(a.ctx, "Successfully compiled custom ignore patterns.")
 	return nil
 }
@@ -889,12 +1053,39 @@ func (a *App) loadSettings() {
 			runtime.LogErrorf(a.ctx, "Error reading settings file %s: %v. Using default custom ignore rules (embedded).", a.configPath, err)
 		}
 	} else {
-		err = json.Unmarshal(data, &a.settings)
+		settings, fromVersion, err := decodeSettings(data)
 		if err != nil {
-			runtime.LogErrorf(a.ctx, "Error unmarshalling settings from %s: %v. Using default custom ignore rules (embedded).", a.configPath, err)
-			a.settings.CustomIgnoreRules = defaultCustomIgnoreRulesContent // Reset to default on unmarshal error
+			// Keep the unreadable file so the user's rules can be recovered by hand.
+			runtime.LogErrorf(a.ctx, "Error reading settings from %s: %v. Using default custom ignore rules (embedded).", a.configPath, err)
+			if backupPath, errBackup := backupSettingsFile(a.configPath, "corrupt"); errBackup != nil {
+				runtime.LogErrorf(a.ctx, "Failed to back up unreadable settings file: %v", errBackup)
+			} else {
+				runtime.LogWarningf(a.ctx, "Unreadable settings file backed up to %s", backupPath)
+			}
 		} else {
+			a.settings = settings
 			runtime.LogInfo(a.ctx, "Successfully loaded custom ignore rules from config.")
+			switch {
+			case fromVersion < currentSettingsVersion:
+				runtime.LogInfof(a.ctx, "Migrating settings from version %d to %d.", fromVersion, currentSettingsVersion)
+				if backupPath, errBackup := backupSettingsFile(a.configPath, fmt.Sprintf("v%d", fromVersion)); errBackup != nil {
+					runtime.LogWarningf(a.ctx, "Failed to back up settings before migration: %v", errBackup)
+				} else {
+					runtime.LogInfof(a.ctx, "Settings before migration backed up to %s", backupPath)
+				}
+				if errSave := a.saveSettings(); errSave != nil {
+					runtime.LogErrorf(a.ctx, "Failed to save migrated settings: %v", errSave)
+				}
+			case fromVersion > currentSettingsVersion:
+				// Written by a newer release: fields we don't know are dropped on the next
+				// save, which then records our version. Keep the first such file around.
+				runtime.LogWarningf(a.ctx, "Settings file version %d is newer than supported version %d.", fromVersion, currentSettingsVersion)
+				if backupPath, errBackup := backupSettingsFileOnce(a.configPath, fmt.Sprintf("v%d", fromVersion)); errBackup != nil {
+					runtime.LogWarningf(a.ctx, "Failed to back up newer settings: %v", errBackup)
+				} else if backupPath != "" {
+					runtime.LogInfof(a.ctx, "Newer settings backed up to %s", backupPath)
+				}
+			}
 			// If loaded rules are empty but default embedded rules are not, use default.
 			if strings.TrimSpace(a.settings.CustomIgnoreRules) == "" && strings.TrimSpace(defaultCustomIgnoreRulesContent) != "" {
 				runtime.LogInfo(a.ctx, "Loaded custom ignore rules are empty, falling back to default embedded rules.")
@@ -914,13 +1105,21 @@ func (a *App) loadSettings() {
 }
 
 func (a *App) saveSettings() error {
+	return a.writeSettings(&a.settings)
+}
+
+// writeSettings saves settings to the config file without touching a.settings,
+// so callers can swap new settings in only once they are on disk.
+func (a *App) writeSettings(settings *AppSettings) error {
 	if a.configPath == "" {
 		err := errors.New("config path is not set, cannot save settings")
 		runtime.LogError(a.ctx, err.Error())
 		return err
 	}
 
-	data, err := json.MarshalIndent(a.settings, "", "  ")
+	// Fields of a newer version were dropped on load, so the file is ours now
+	settings.Version = currentSettingsVersion
+	data, err := json.MarshalIndent(settings, "", "  ")
 	if err != nil {
 		runtime.LogErrorf(a.ctx, "Error marshalling settings: %v", err)
 		return err
@@ -932,7 +1131,8 @@ func (a *App) saveSettings() error {
 		return err
 	}
 
-	err = os.WriteFile(a.configPath, data, 0644)
+	// Write to a temp file and rename so a crash mid-write can't corrupt the settings.
+	err = writeFileAtomic(a.configPath, data, 0644)
 	if err != nil {
 		runtime.LogErrorf(a.ctx, "Error writing settings to %s: %v", a.configPath, err)
 		return err
@@ -951,23 +1151,23 @@ func (a *App) GetCustomIgnoreRules() string {
 // SetCustomIgnoreRules updates the custom ignore rules, saves them, and recompiles.
 func (a *App) SetCustomIgnoreRules(rules string) error {
 	a.settings.CustomIgnoreRules = rules
-	// Attempt to compile first. If compilation fails, we might not want to save invalid rules,
-	// or save them and let the user know they are not effective.
-	// For now, compile then save. If compile fails, the old patterns (or nil) remain active.
+	// Compile then save. Invalid lines are reported, but the valid ones are
+	// compiled and active either way, so the project is rescanned before any
+	// error is returned to keep the file tree in step with them.
 	compileErr := a.compileCustomIgnorePatterns()
-
 	saveErr := a.saveSettings()
+
+	var rescanErr error
+	if a.fileWatcher != nil && a.fileWatcher.rootDir != "" {
+		rescanErr = a.fileWatcher.RefreshIgnoresAndRescan()
+	}
 	if saveErr != nil {
 		return fmt.Errorf("failed to save settings: %w (compile error: %v)", saveErr, compileErr)
 	}
 	if compileErr != nil {
 		return fmt.Errorf("rules saved, but failed to compile custom ignore patterns: %w", compileErr)
 	}
-
-	if a.fileWatcher != nil && a.fileWatcher.rootDir != "" {
-		return a.fileWatcher.RefreshIgnoresAndRescan()
-	}
-	return nil
+	return rescanErr
 }
 
 // GetCustomPromptRules returns the current custom prompt rules as a string.
@@ -989,10 +1189,24 @@ func (a *App) SetCustomPromptRules(rules string) error {
 	return nil
 }
 
+// GetUseGitignore returns whether .gitignore rules are applied (persisted across restarts).
+func (a *App) GetUseGitignore() bool {
+	return a.useGitignore
+}
+
+// GetUseCustomIgnore returns whether the custom ignore rules are applied (persisted across restarts).
+func (a *App) GetUseCustomIgnore() bool {
+	return a.useCustomIgnore
+}
+
 // SetUseGitignore updates the app's setting for using .gitignore and informs the watcher.
 func (a *App) SetUseGitignore(enabled bool) error {
 	a.useGitignore = enabled
+	a.settings.UseGitignore = &enabled
 	runtime.LogInfof(a.ctx, "App setting useGitignore changed to: %v", enabled)
+	if err := a.saveSettings(); err != nil {
+		runtime.LogWarningf(a.ctx, "useGitignore applied but not persisted: %v", err)
+	}
 	if a.fileWatcher != nil && a.fileWatcher.rootDir != "" {
 		// Assuming watcher is for the current project if active.
 		return a.fileWatcher.RefreshIgnoresAndRescan()
@@ -1003,7 +1217,11 @@ func (a *App) SetUseGitignore(enabled bool) error {
 // SetUseCustomIgnore updates the app's setting for using custom ignore rules and informs the watcher.
 func (a *App) SetUseCustomIgnore(enabled bool) error {
 	a.useCustomIgnore = enabled
+	a.settings.UseCustomIgnore = &enabled
 	runtime.LogInfof(a.ctx, "App setting useCustomIgnore changed to: %v", enabled)
+	if err := a.saveSettings(); err != nil {
+		runtime.LogWarningf(a.ctx, "useCustomIgnore applied but not persisted: %v", err)
+	}
 	if a.fileWatcher != nil && a.fileWatcher.rootDir != "" {
 		// Assuming watcher is for the current project if active.
 		return a.fileWatcher.RefreshIgnoresAndRescan()
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/adrg/xdg"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// --- Context archive ---
+
+const (
+	defaultArchiveMaxEntries    = 100
+	defaultArchiveMaxTotalBytes = 500_000_000 // 500MB
+)
+
+// ContextArchiveEntry describes one archived generation. The context itself
+// is stored next to the index as <ID>.txt.
+type ContextArchiveEntry struct {
+	ID              string                   `json:"id"`
+	CreatedAt       time.Time                `json:"createdAt"`
+	Roots           []string                 `json:"roots"`             // Project roots (several for multi-root workspaces)
+	Treeish         string                   `json:"treeish,omitempty"` // Set when generated from a git tree-ish
+	ExcludedPaths   []string                 `json:"excludedPaths"`     // Selection as sent by the frontend
+	Options         ContextGenerationOptions `json:"options"`
+	UseGitignore    bool                     `json:"useGitignore"`
+	UseCustomIgnore bool                     `json:"useCustomIgnore"`
+	Size            int                      `json:"size"`
+	SHA256          string                   `json:"sha256"`
+}
+
+// ContextArchive keeps recent generations under the XDG data directory.
+type ContextArchive struct {
+	app *App
+	mu  sync.Mutex
+	dir string // Empty if the data directory could not be resolved
+}
+
+func NewContextArchive(app *App) *ContextArchive {
+	ca := &ContextArchive{app: app}
+	indexPath, err := xdg.DataFile("shotgun-code/history/index.json")
+	if err != nil {
+		runtime.LogErrorf(app.ctx, "Error getting context archive path: %v. Generations will not be archived.", err)
+		return ca
+	}
+	ca.dir = filepath.Dir(indexPath)
+	return ca
+}
+
+func (ca *ContextArchive) indexPath() string {
+	return filepath.Join(ca.dir, "index.json")
+}
+
+func (ca *ContextArchive) contentPath(id string) string {
+	return filepath.Join(ca.dir, id+".txt")
+}
+
+// readIndex returns the entries newest first. Callers must hold ca.mu.
+func (ca *ContextArchive) readIndex() ([]ContextArchiveEntry, error) {
+	if ca.dir == "" {
+		return nil, fmt.Errorf("context archive directory is not available")
+	}
+	data, err := os.ReadFile(ca.indexPath())
+	if os.IsNotExist(err) {
+		return []ContextArchiveEntry{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read context archive index: %w", err)
+	}
+	var entries []ContextArchiveEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse context archive index: %w", err)
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].CreatedAt.After(entries[j].CreatedAt) })
+	return entries, nil
+}
+
+// writeIndex persists the entries. Callers must hold ca.mu.
+func (ca *ContextArchive) writeIndex(entries []ContextArchiveEntry) error {
+	if err := os.MkdirAll(ca.dir, os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create context archive directory: %w", err)
+	}
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal context archive index: %w", err)
+	}
+	if err := writeFileAtomic(ca.indexPath(), data, 0644); err != nil {
+		return fmt.Errorf("failed to write context archive index: %w", err)
+	}
+	return nil
+}
+
+// findArchiveEntry returns the index of the entry with the given ID, or -1.
+func findArchiveEntry(entries []ContextArchiveEntry, id string) int {
+	for i := range entries {
+		if entries[i].ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// Save archives a generated context and applies the default retention limits.
+// A context identical to the newest archived one (an automatic regeneration
+// that changed nothing) is not archived again.
+func (ca *ContextArchive) Save(entry ContextArchiveEntry, output string) error {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+
+	entries, err := ca.readIndex()
+	if err != nil {
+		return err
+	}
+	entry.SHA256 = sha256Hex(output)
+	if len(entries) > 0 && entries[0].SHA256 == entry.SHA256 {
+		return nil
+	}
+	entry.CreatedAt = time.Now().UTC()
+	entry.Size = len(output)
+	entry.ID = entry.CreatedAt.Format("20060102T150405.000000") + "-" + entry.SHA256[:12]
+	if entry.ExcludedPaths == nil {
+		entry.ExcludedPaths = []string{}
+	}
+
+	if err := os.MkdirAll(ca.dir, os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create context archive directory: %w", err)
+	}
+	if err := os.WriteFile(ca.contentPath(entry.ID), []byte(output), 0644); err != nil {
+		return fmt.Errorf("failed to write archived context: %w", err)
+	}
+	entries = append([]ContextArchiveEntry{entry}, entries...)
+	kept, removed := pruneArchiveEntries(entries, time.Time{}, defaultArchiveMaxTotalBytes, defaultArchiveMaxEntries)
+	if err := ca.writeIndex(kept); err != nil {
+		os.Remove(ca.contentPath(entry.ID))
+		return err
+	}
+	ca.removeContents(removed)
+	return nil
+}
+
+// pruneArchiveEntries splits newest-first entries into those to keep and those
+// to drop. A zero cutoff, maxTotalBytes or maxEntries disables that limit.
+func pruneArchiveEntries(entries []ContextArchiveEntry, cutoff time.Time, maxTotalBytes int64, maxEntries int) (kept, removed []ContextArchiveEntry) {
+	kept = []ContextArchiveEntry{}
+	var total int64
+	for _, e := range entries {
+		total += int64(e.Size)
+		switch {
+		case !cutoff.IsZero() && e.CreatedAt.Before(cutoff),
+			maxTotalBytes > 0 && total > maxTotalBytes,
+			maxEntries > 0 && len(kept) >= maxEntries:
+			removed = append(removed, e)
+		default:
+			kept = append(kept, e)
+		}
+	}
+	return kept, removed
+}
+
+// removeContents deletes the stored contexts of dropped entries, once the index
+// no longer lists them. Callers must hold ca.mu.
+func (ca *ContextArchive) removeContents(entries []ContextArchiveEntry) {
+	for _, e := range entries {
+		if err := os.Remove(ca.contentPath(e.ID)); err != nil && !os.IsNotExist(err) {
+			runtime.LogWarningf(ca.app.ctx, "Failed to remove archived context %s: %v", e.ID, err)
+		}
+	}
+}
+
+// archiveGeneration is called by the context generator after a successful job.
+func (a *App) archiveGeneration(entry *ContextArchiveEntry, output string) {
+	if entry == nil || a.contextArchive == nil {
+		return
+	}
+	entry.UseGitignore = a.useGitignore
+	entry.UseCustomIgnore = a.useCustomIgnore
+	if err := a.contextArchive.Save(*entry, output); err != nil {
+		runtime.LogWarningf(a.ctx, "Failed to archive generated context: %v", err)
+	}
+}
+
+// ListArchivedContexts returns the archived generations, newest first.
+func (a *App) ListArchivedContexts() ([]ContextArchiveEntry, error) {
+	a.contextArchive.mu.Lock()
+	defer a.contextArchive.mu.Unlock()
+	return a.contextArchive.readIndex()
+}
+
+// ReloadArchivedContext returns the stored context of an archived generation.
+func (a *App) ReloadArchivedContext(id string) (string, error) {
+	ca := a.contextArchive
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+
+	entries, err := ca.readIndex()
+	if err != nil {
+		return "", err
+	}
+	if findArchiveEntry(entries, id) < 0 {
+		return "", fmt.Errorf("archived context '%s' not found", id)
+	}
+	data, err := os.ReadFile(ca.contentPath(id))
+	if err != nil {
+		return "", fmt.Errorf("failed to read archived context '%s': %w", id, err)
+	}
+	return string(data), nil
+}
+
+// ExportArchivedContext copies an archived context to destPath.
+func (a *App) ExportArchivedContext(id string, destPath string) error {
+	content, err := a.ReloadArchivedContext(id)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(destPath, []byte(content), 0644); err != nil {
+		return fmt.Errorf("failed to export archived context to %s: %w", destPath, err)
+	}
+	runtime.LogInfof(a.ctx, "Exported archived context %s to %s", id, destPath)
+	return nil
+}
+
+// DeleteArchivedContext removes one archived generation.
+func (a *App) DeleteArchivedContext(id string) error {
+	ca := a.contextArchive
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+
+	entries, err := ca.readIndex()
+	if err != nil {
+		return err
+	}
+	i := findArchiveEntry(entries, id)
+	if i < 0 {
+		return fmt.Errorf("archived context '%s' not found", id)
+	}
+	deleted := entries[i]
+	if err := ca.writeIndex(append(entries[:i], entries[i+1:]...)); err != nil {
+		return err
+	}
+	ca.removeContents([]ContextArchiveEntry{deleted})
+	return nil
+}
+
+// PruneContextArchive drops generations older than maxAgeDays and, keeping the
+// newest, those beyond maxTotalBytes in total. Zero disables a limit. It
+// returns the number of removed generations.
+func (a *App) PruneContextArchive(maxAgeDays int, maxTotalBytes int64) (int, error) {
+	ca := a.contextArchive
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+
+	entries, err := ca.readIndex()
+	if err != nil {
+		return 0, err
+	}
+	var cutoff time.Time
+	if maxAgeDays > 0 {
+		cutoff = time.Now().UTC().AddDate(0, 0, -maxAgeDays)
+	}
+	kept, removed := pruneArchiveEntries(entries, cutoff, maxTotalBytes, 0)
+	if len(removed) == 0 {
+		return 0, nil
+	}
+	if err := ca.writeIndex(kept); err != nil {
+		return 0, err
+	}
+	ca.removeContents(removed)
+	runtime.LogInfof(a.ctx, "Pruned %d archived contexts", len(removed))
+	return len(removed), nil
+}
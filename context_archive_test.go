@@ -0,0 +1,83 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPruneArchiveEntries(t *testing.T) {
+	now := time.Date(2024, 5, 10, 12, 0, 0, 0, time.UTC)
+	entries := []ContextArchiveEntry{
+		{ID: "a", CreatedAt: now, Size: 40},
+		{ID: "b", CreatedAt: now.Add(-24 * time.Hour), Size: 30},
+		{ID: "c", CreatedAt: now.Add(-48 * time.Hour), Size: 20},
+		{ID: "d", CreatedAt: now.Add(-72 * time.Hour), Size: 10},
+	}
+	ids := func(entries []ContextArchiveEntry) []string {
+		out := []string{}
+		for _, e := range entries {
+			out = append(out, e.ID)
+		}
+		return out
+	}
+
+	tests := []struct {
+		name          string
+		cutoff        time.Time
+		maxTotalBytes int64
+		maxEntries    int
+		kept, removed []string
+	}{
+		{name: "no limits", kept: []string{"a", "b", "c", "d"}, removed: []string{}},
+		{name: "age", cutoff: now.Add(-36 * time.Hour), kept: []string{"a", "b"}, removed: []string{"c", "d"}},
+		{name: "total size", maxTotalBytes: 70, kept: []string{"a", "b"}, removed: []string{"c", "d"}},
+		{name: "entry count", maxEntries: 3, kept: []string{"a", "b", "c"}, removed: []string{"d"}},
+		{name: "newest too large", maxTotalBytes: 30, kept: []string{}, removed: []string{"a", "b", "c", "d"}},
+		{name: "combined", cutoff: now.Add(-60 * time.Hour), maxEntries: 1, kept: []string{"a"}, removed: []string{"b", "c", "d"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kept, removed := pruneArchiveEntries(entries, tt.cutoff, tt.maxTotalBytes, tt.maxEntries)
+			if !reflect.DeepEqual(ids(kept), tt.kept) || !reflect.DeepEqual(ids(removed), tt.removed) {
+				t.Errorf("kept %v, removed %v; want %v and %v", ids(kept), ids(removed), tt.kept, tt.removed)
+			}
+		})
+	}
+}
+
+func TestDeleteArchivedContext(t *testing.T) {
+	a := &App{}
+	a.contextArchive = &ContextArchive{app: a, dir: t.TempDir()}
+	ca := a.contextArchive
+	for _, output := range []string{"first", "second"} {
+		if err := ca.Save(ContextArchiveEntry{Roots: []string{"/src/app"}}, output); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ca.Save(ContextArchiveEntry{}, "second"); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := a.ListArchivedContexts()
+	if err != nil || len(entries) != 2 {
+		t.Fatalf("archive = %+v (%v), want two entries without the repeated context", entries, err)
+	}
+
+	if err := a.DeleteArchivedContext(entries[1].ID); err != nil {
+		t.Fatal(err)
+	}
+	left, err := a.ListArchivedContexts()
+	if err != nil || len(left) != 1 || left[0].ID != entries[0].ID {
+		t.Errorf("after delete: archive = %+v (%v), want only the newest entry", left, err)
+	}
+	if _, err := os.Stat(ca.contentPath(entries[1].ID)); !os.IsNotExist(err) {
+		t.Errorf("deleted context is still stored (%v)", err)
+	}
+	if got, err := a.ReloadArchivedContext(entries[0].ID); got != "second" || err != nil {
+		t.Errorf("reload = %q, %v; want the kept context", got, err)
+	}
+	if err := a.DeleteArchivedContext(entries[1].ID); err == nil {
+		t.Error("deleting a missing entry succeeded")
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// --- Diffing generated contexts ---
+
+// contextFile is one <file> block of a generated context.
+type contextFile struct {
+	Path string
+	Body string
+}
+
+// ContextDiff summarizes how two generated contexts differ.
+type ContextDiff struct {
+	Added       []string `json:"added"`
+	Removed     []string `json:"removed"`
+	Changed     []string `json:"changed"`
+	Unchanged   []string `json:"unchanged"`
+	UnifiedDiff string   `json:"unifiedDiff"` // Only available when both full contexts were given
+	FullSize    int      `json:"fullSize"`    // Size of the new context in bytes
+	DeltaSize   int      `json:"deltaSize"`   // Size of UnifiedDiff in bytes
+}
+
+var contextFileStartRegex = regexp.MustCompile(`(?m)^<file path="([^"]*)"(?: [a-z-]+="[^"]*")*>\n`)
+
+const contextFileEnd = "\n</file>"
+
+// parseContextFiles extracts the <file> blocks of a generated context. When
+// the context carries a manifest header, the recorded sizes delimit each body
+// exactly; otherwise a body ends at the first "</file>" line followed by the
+// next block or the end of the text.
+func parseContextFiles(text string) []contextFile {
+	manifest, body, hasManifest := splitManifestHeader(text)
+	sizes := make(map[string]int)
+	if hasManifest {
+		for _, f := range manifest.Files {
+			sizes[f.Path] = f.Size
+		}
+	}
+
+	var files []contextFile
+	pos := 0
+	for {
+		loc := contextFileStartRegex.FindStringSubmatchIndex(body[pos:])
+		if loc == nil {
+			break
+		}
+		path := body[pos+loc[2] : pos+loc[3]]
+		start := pos + loc[1]
+
+		end := -1
+		if size, ok := sizes[path]; ok && start+size <= len(body) && strings.HasPrefix(body[start+size:], contextFileEnd) {
+			end = start + size
+		}
+		for search := start; end < 0; {
+			idx := strings.Index(body[search:], contextFileEnd)
+			if idx < 0 {
+				break
+			}
+			candidate := search + idx
+			after := strings.TrimPrefix(body[candidate+len(contextFileEnd):], "\n")
+			if next := contextFileStartRegex.FindStringIndex(after); strings.TrimSpace(after) == "" || (next != nil && next[0] == 0) {
+				end = candidate
+			} else {
+				search = candidate + 1
+			}
+		}
+		if end < 0 {
+			// Unterminated block (e.g. truncated paste): take the rest of the text.
+			files = append(files, contextFile{Path: path, Body: body[start:]})
+			break
+		}
+		files = append(files, contextFile{Path: path, Body: body[start:end]})
+		pos = end + len(contextFileEnd)
+	}
+	return files
+}
+
+// DiffContexts compares two generated contexts file by file and returns the
+// file-level summary plus a unified diff of every added, removed or changed file.
+func (a *App) DiffContexts(oldContext string, newContext string) *ContextDiff {
+	oldFiles := make(map[string]string)
+	for _, f := range parseContextFiles(oldContext) {
+		oldFiles[f.Path] = f.Body
+	}
+	newFiles := parseContextFiles(newContext)
+
+	result := &ContextDiff{FullSize: len(newContext)}
+	var diff strings.Builder
+	seen := make(map[string]bool, len(newFiles))
+	for _, f := range newFiles {
+		seen[f.Path] = true
+		oldBody, existed := oldFiles[f.Path]
+		switch {
+		case !existed:
+			result.Added = append(result.Added, f.Path)
+			diff.WriteString(unifiedDiff("", f.Path, "", f.Body+"\n", 3))
+		case oldBody != f.Body:
+			result.Changed = append(result.Changed, f.Path)
+			diff.WriteString(unifiedDiff(f.Path, f.Path, oldBody+"\n", f.Body+"\n", 3))
+		default:
+			result.Unchanged = append(result.Unchanged, f.Path)
+		}
+	}
+	var removed []string
+	for p := range oldFiles {
+		if !seen[p] {
+			removed = append(removed, p)
+		}
+	}
+	sort.Strings(removed)
+	for _, p := range removed {
+		result.Removed = append(result.Removed, p)
+		diff.WriteString(unifiedDiff(p, "", oldFiles[p]+"\n", "", 3))
+	}
+
+	result.UnifiedDiff = diff.String()
+	result.DeltaSize = len(result.UnifiedDiff)
+	result.normalize()
+	return result
+}
+
+// DiffContextManifests compares two manifests. Only the file-level summary is
+// available since manifests do not carry file contents.
+func (a *App) DiffContextManifests(oldManifest ContextManifest, newManifest ContextManifest) *ContextDiff {
+	oldHashes := make(map[string]string, len(oldManifest.Files))
+	for _, f := range oldManifest.Files {
+		oldHashes[f.Path] = f.SHA256
+	}
+	result := &ContextDiff{FullSize: newManifest.ContextSize}
+	seen := make(map[string]bool, len(newManifest.Files))
+	for _, f := range newManifest.Files {
+		seen[f.Path] = true
+		oldHash, existed := oldHashes[f.Path]
+		switch {
+		case !existed:
+			result.Added = append(result.Added, f.Path)
+		case oldHash != f.SHA256:
+			result.Changed = append(result.Changed, f.Path)
+		default:
+			result.Unchanged = append(result.Unchanged, f.Path)
+		}
+	}
+	for _, f := range oldManifest.Files {
+		if !seen[f.Path] {
+			result.Removed = append(result.Removed, f.Path)
+		}
+	}
+	sort.Strings(result.Removed)
+	result.normalize()
+	return result
+}
+
+// normalize replaces nil slices so the frontend always receives arrays.
+func (d *ContextDiff) normalize() {
+	for _, s := range []*[]string{&d.Added, &d.Removed, &d.Changed, &d.Unchanged} {
+		if *s == nil {
+			*s = []string{}
+		}
+	}
+}
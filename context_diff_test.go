@@ -0,0 +1,66 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"shotgun_code/internal/unidiff"
+)
+
+func TestParseContextFiles(t *testing.T) {
+	// The body of b.txt looks like the end of its block followed by another block
+	tricky := "x\n</file>\n<file path=\"fake.txt\">\ny"
+	files := []contextFile{{Path: "a.txt", Body: "one\ntwo"}, {Path: "b.txt", Body: tricky}, {Path: "c.txt", Body: ""}}
+
+	if got := parseContextFiles(testContext(files, true)); !reflect.DeepEqual(got, files) {
+		t.Errorf("with manifest: files = %+v, want %+v", got, files)
+	}
+	plain := []contextFile{files[0], files[2]}
+	if got := parseContextFiles(testContext(plain, false)); !reflect.DeepEqual(got, plain) {
+		t.Errorf("without manifest: files = %+v, want %+v", got, plain)
+	}
+	truncated := strings.TrimSuffix(testContext(plain[:1], false), "\n</file>")
+	if got, want := parseContextFiles(truncated), []contextFile{{Path: "a.txt", Body: "one\ntwo"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("truncated: files = %+v, want %+v", got, want)
+	}
+}
+
+func TestDiffContexts(t *testing.T) {
+	oldFiles := []contextFile{{Path: "keep.txt", Body: "same"}, {Path: "edit.txt", Body: "a\nb"}, {Path: "gone.txt", Body: "bye"}}
+	newFiles := []contextFile{{Path: "keep.txt", Body: "same"}, {Path: "edit.txt", Body: "a\nB"}, {Path: "new.txt", Body: "hi"}}
+	oldContext, newContext := testContext(oldFiles, true), testContext(newFiles, false)
+
+	a := &App{}
+	d := a.DiffContexts(oldContext, newContext)
+	want := &ContextDiff{Added: []string{"new.txt"}, Removed: []string{"gone.txt"}, Changed: []string{"edit.txt"}, Unchanged: []string{"keep.txt"}}
+	if !reflect.DeepEqual([][]string{d.Added, d.Removed, d.Changed, d.Unchanged}, [][]string{want.Added, want.Removed, want.Changed, want.Unchanged}) {
+		t.Errorf("diff = %+v, want %+v", d, want)
+	}
+	if d.FullSize != len(newContext) || d.DeltaSize != len(d.UnifiedDiff) {
+		t.Errorf("sizes = %d/%d, want %d/%d", d.FullSize, d.DeltaSize, len(newContext), len(d.UnifiedDiff))
+	}
+	patch, err := unidiff.Parse(d.UnifiedDiff)
+	if err != nil {
+		t.Fatalf("unified diff does not parse: %v\n%s", err, d.UnifiedDiff)
+	}
+	var paths []string
+	for _, f := range patch.Files {
+		paths = append(paths, f.Path())
+	}
+	if want := []string{"edit.txt", "new.txt", "gone.txt"}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("unified diff covers %v, want %v", paths, want)
+	}
+
+	oldManifest, _, _ := splitManifestHeader(oldContext)
+	newManifest, _, _ := splitManifestHeader(testContext(newFiles, true))
+	md := a.DiffContextManifests(*oldManifest, *newManifest)
+	if !reflect.DeepEqual([][]string{md.Added, md.Removed, md.Changed, md.Unchanged}, [][]string{want.Added, want.Removed, want.Changed, want.Unchanged}) || md.UnifiedDiff != "" {
+		t.Errorf("manifest diff = %+v, want %+v without a unified diff", md, want)
+	}
+
+	same := a.DiffContexts(oldContext, oldContext)
+	if len(same.Added)+len(same.Removed)+len(same.Changed) != 0 || same.UnifiedDiff != "" || same.Added == nil {
+		t.Errorf("diff of a context with itself = %+v, want only unchanged files and empty lists", same)
+	}
+}
@@ -0,0 +1,363 @@
+package main
+
+import (
+	"fmt"
+	"go/parser"
+	"go/token"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// --- Dependency closure selection ---
+
+var (
+	goModuleRegex = regexp.MustCompile(`(?m)^\s*module\s+"?([^\s"]+)"?`)
+	// Covers `import x from '...'`, `import '...'`, `export ... from '...'`, `require('...')` and `import('...')`.
+	jsImportRegex = regexp.MustCompile(`(?:\bfrom\s*|\bimport\s*\(?\s*|\brequire\s*\(\s*)['"]([^'"]+)['"]`)
+	pyImportRegex = regexp.MustCompile(`(?m)^[ \t]*import[ \t]+([\w.]+(?:[ \t]+as[ \t]+\w+)?(?:[ \t]*,[ \t]*[\w.]+(?:[ \t]+as[ \t]+\w+)?)*)`)
+	pyFromRegex   = regexp.MustCompile(`(?m)^[ \t]*from[ \t]+(\.*[\w.]*)[ \t]+import[ \t]+(\([^)]*\)|[\w \t,*]+)`)
+	jsResolveExts = []string{"", ".ts", ".tsx", ".js", ".jsx", ".mjs", ".cjs", ".vue", ".json", ".d.ts"}
+	jsSourceExts  = map[string]bool{".js": true, ".jsx": true, ".mjs": true, ".cjs": true, ".ts": true, ".tsx": true, ".mts": true, ".cts": true, ".vue": true}
+	pySourceExts  = map[string]bool{".py": true, ".pyi": true}
+)
+
+// dependencyResolver finds the local files a source file imports.
+type dependencyResolver struct {
+	rootDir      string
+	goModulePath string // Module path from rootDir/go.mod, empty if absent
+}
+
+func newDependencyResolver(rootDir string) *dependencyResolver {
+	r := &dependencyResolver{rootDir: rootDir}
+	if data, err := os.ReadFile(filepath.Join(rootDir, "go.mod")); err == nil {
+		if m := goModuleRegex.FindSubmatch(data); m != nil {
+			r.goModulePath = string(m[1])
+		}
+	}
+	return r
+}
+
+// ResolveDependencyClosure returns the seed files plus every local file they
+// transitively import, up to maxDepth import hops (maxDepth <= 0 means no limit).
+// Paths are relative to rootDir, using the same form as FileNode.RelPath.
+func (a *App) ResolveDependencyClosure(rootDir string, seedFiles []string, maxDepth int) ([]string, error) {
+	result, skipped, err := resolveDependencyClosure(rootDir, seedFiles, maxDepth)
+	if err != nil {
+		return nil, err
+	}
+	for _, rel := range sortedErrorKeys(skipped) {
+		runtime.LogWarningf(a.ctx, "ResolveDependencyClosure: skipping imports of %s: %v", rel, skipped[rel])
+	}
+	runtime.LogInfof(a.ctx, "ResolveDependencyClosure: %d seed(s) expanded to %d file(s) (max depth %d)", len(seedFiles), len(result), maxDepth)
+	return result, nil
+}
+
+// resolveDependencyClosure does the work of ResolveDependencyClosure. skipped
+// maps files whose imports could not be read to the error.
+func resolveDependencyClosure(rootDir string, seedFiles []string, maxDepth int) (result []string, skipped map[string]error, err error) {
+	result = []string{}
+	if len(seedFiles) == 0 {
+		return result, nil, nil
+	}
+	r := newDependencyResolver(rootDir)
+
+	depthOf := make(map[string]int)
+	var queue []string
+	for _, seed := range seedFiles {
+		rel := filepath.ToSlash(seed)
+		if filepath.IsAbs(seed) {
+			relOS, err := filepath.Rel(rootDir, seed)
+			if err != nil {
+				return nil, nil, fmt.Errorf("seed %s is not inside %s: %w", seed, rootDir, err)
+			}
+			rel = filepath.ToSlash(relOS)
+		}
+		rel = path.Clean(rel)
+		if !isInsideRoot(rel) {
+			return nil, nil, fmt.Errorf("seed %s is not inside %s", seed, rootDir)
+		}
+		if _, err := os.Stat(r.abs(rel)); err != nil {
+			return nil, nil, fmt.Errorf("seed file %s: %w", seed, err)
+		}
+		if _, seen := depthOf[rel]; !seen {
+			depthOf[rel] = 0
+			queue = append(queue, rel)
+		}
+	}
+
+	skipped = make(map[string]error)
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		depth := depthOf[current]
+		if maxDepth > 0 && depth >= maxDepth {
+			continue
+		}
+		deps, err := r.localImports(current)
+		if err != nil {
+			skipped[current] = err
+			continue
+		}
+		for _, dep := range deps {
+			if _, seen := depthOf[dep]; seen {
+				continue
+			}
+			depthOf[dep] = depth + 1
+			queue = append(queue, dep)
+		}
+	}
+
+	for rel := range depthOf {
+		result = append(result, filepath.FromSlash(rel))
+	}
+	sort.Strings(result)
+	return result, skipped, nil
+}
+
+func sortedErrorKeys(m map[string]error) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ExcludedPathsForSelection converts a set of selected files into the
+// excludedPaths list expected by RequestShotgunContextGeneration: directories
+// without any selected file are excluded as a whole, other unselected files individually.
+func (a *App) ExcludedPathsForSelection(rootDir string, selectedFiles []string) ([]string, error) {
+	selected := make(map[string]bool, len(selectedFiles))
+	selectedDirs := make(map[string]bool)
+	for _, f := range selectedFiles {
+		rel := filepath.Clean(f)
+		selected[rel] = true
+		for dir := filepath.Dir(rel); dir != "." && dir != string(os.PathSeparator); dir = filepath.Dir(dir) {
+			selectedDirs[dir] = true
+		}
+	}
+
+	var excluded []string
+	var walk func(currentPath string) error
+	walk = func(currentPath string) error {
+		entries, err := os.ReadDir(currentPath)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			p := filepath.Join(currentPath, entry.Name())
+			rel, _ := filepath.Rel(rootDir, p)
+			switch {
+			case entry.IsDir() && selectedDirs[rel]:
+				if err := walk(p); err != nil {
+					return err
+				}
+			case !selected[rel]:
+				excluded = append(excluded, rel)
+			}
+		}
+		return nil
+	}
+	if err := walk(rootDir); err != nil {
+		return nil, fmt.Errorf("failed to walk %s: %w", rootDir, err)
+	}
+	sort.Strings(excluded)
+	return excluded, nil
+}
+
+func (r *dependencyResolver) abs(rel string) string {
+	return filepath.Join(r.rootDir, filepath.FromSlash(rel))
+}
+
+// isInsideRoot reports whether a cleaned, forward-slash relative path stays inside the root.
+func isInsideRoot(rel string) bool {
+	return !path.IsAbs(rel) && rel != ".." && !strings.HasPrefix(rel, "../")
+}
+
+// isFile reports whether rel names a regular file inside the root.
+func (r *dependencyResolver) isFile(rel string) bool {
+	if !isInsideRoot(path.Clean(rel)) {
+		return false
+	}
+	info, err := os.Stat(r.abs(rel))
+	return err == nil && !info.IsDir()
+}
+
+// localImports returns the local files (forward-slash, relative to rootDir) that relPath depends on.
+func (r *dependencyResolver) localImports(relPath string) ([]string, error) {
+	info, err := os.Stat(r.abs(relPath))
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return r.listFiles(relPath, func(string) bool { return true })
+	}
+
+	ext := strings.ToLower(path.Ext(relPath))
+	switch {
+	case ext == ".go":
+		return r.goImports(relPath)
+	case jsSourceExts[ext]:
+		return r.jsImports(relPath)
+	case pySourceExts[ext]:
+		return r.pythonImports(relPath)
+	}
+	return nil, nil
+}
+
+// listFiles returns the regular files directly inside dir that satisfy keep.
+func (r *dependencyResolver) listFiles(dir string, keep func(name string) bool) ([]string, error) {
+	if !isInsideRoot(path.Clean(dir)) {
+		return nil, fmt.Errorf("%s is outside the project", dir)
+	}
+	entries, err := os.ReadDir(r.abs(dir))
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, entry := range entries {
+		if !entry.IsDir() && keep(entry.Name()) {
+			files = append(files, path.Join(dir, entry.Name()))
+		}
+	}
+	return files, nil
+}
+
+func isGoSourceFile(name string) bool {
+	return strings.HasSuffix(name, ".go") && !strings.HasSuffix(name, "_test.go")
+}
+
+// goImports treats the package as the unit of dependency: a Go file depends on
+// the other files of its package and on every package it imports from the module.
+func (r *dependencyResolver) goImports(relPath string) ([]string, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, r.abs(relPath), nil, parser.ImportsOnly)
+	if err != nil {
+		return nil, err
+	}
+
+	deps, err := r.listFiles(path.Dir(relPath), isGoSourceFile)
+	if err != nil {
+		return nil, err
+	}
+	if r.goModulePath == "" {
+		return deps, nil
+	}
+	for _, imp := range file.Imports {
+		importPath, err := strconv.Unquote(imp.Path.Value)
+		if err != nil {
+			continue
+		}
+		var dir string
+		switch {
+		case importPath == r.goModulePath:
+			dir = "."
+		case strings.HasPrefix(importPath, r.goModulePath+"/"):
+			dir = strings.TrimPrefix(importPath, r.goModulePath+"/")
+		default:
+			continue // Standard library or third-party
+		}
+		pkgFiles, err := r.listFiles(dir, isGoSourceFile)
+		if err != nil {
+			continue
+		}
+		deps = append(deps, pkgFiles...)
+	}
+	return deps, nil
+}
+
+// jsImports resolves relative specifiers the way bundlers do: exact file,
+// known extensions, then index files of a directory.
+func (r *dependencyResolver) jsImports(relPath string) ([]string, error) {
+	data, err := os.ReadFile(r.abs(relPath))
+	if err != nil {
+		return nil, err
+	}
+	var deps []string
+	for _, m := range jsImportRegex.FindAllStringSubmatch(string(data), -1) {
+		spec := m[1]
+		if !strings.HasPrefix(spec, "./") && !strings.HasPrefix(spec, "../") {
+			continue // Package import
+		}
+		base := path.Join(path.Dir(relPath), spec)
+		if resolved, ok := r.resolveWithExts(base); ok {
+			deps = append(deps, resolved)
+		} else if resolved, ok := r.resolveWithExts(path.Join(base, "index")); ok {
+			deps = append(deps, resolved)
+		}
+	}
+	return deps, nil
+}
+
+func (r *dependencyResolver) resolveWithExts(base string) (string, bool) {
+	for _, ext := range jsResolveExts {
+		if r.isFile(base + ext) {
+			return base + ext, true
+		}
+	}
+	return "", false
+}
+
+// pythonImports resolves absolute imports against rootDir and relative
+// imports against the importing file's package.
+func (r *dependencyResolver) pythonImports(relPath string) ([]string, error) {
+	data, err := os.ReadFile(r.abs(relPath))
+	if err != nil {
+		return nil, err
+	}
+	src := string(data)
+	var deps []string
+	addModule := func(baseDir string, dotted string) bool {
+		modPath := path.Join(baseDir, strings.ReplaceAll(dotted, ".", "/"))
+		for _, candidate := range []string{modPath + ".py", modPath + ".pyi", path.Join(modPath, "__init__.py")} {
+			if r.isFile(candidate) {
+				deps = append(deps, candidate)
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, m := range pyImportRegex.FindAllStringSubmatch(src, -1) {
+		for _, part := range strings.Split(m[1], ",") {
+			name := strings.Fields(part)
+			if len(name) > 0 {
+				addModule(".", name[0])
+			}
+		}
+	}
+
+	for _, m := range pyFromRegex.FindAllStringSubmatch(src, -1) {
+		module, names := m[1], strings.Trim(m[2], "()")
+		baseDir := "."
+		if dots := len(module) - len(strings.TrimLeft(module, ".")); dots > 0 {
+			baseDir = path.Dir(relPath)
+			for i := 1; i < dots; i++ {
+				baseDir = path.Dir(baseDir)
+			}
+			module = module[dots:]
+		}
+		// `from pkg import mod` may import submodules; try those before the package itself.
+		foundSubmodule := false
+		for _, name := range strings.Split(names, ",") {
+			fields := strings.Fields(name)
+			if len(fields) == 0 || fields[0] == "*" {
+				continue
+			}
+			if addModule(baseDir, strings.Trim(module+"."+fields[0], ".")) {
+				foundSubmodule = true
+			}
+		}
+		if module != "" && !foundSubmodule {
+			addModule(baseDir, module)
+		}
+	}
+	return deps, nil
+}
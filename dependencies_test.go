@@ -0,0 +1,80 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestResolveDependencyClosure(t *testing.T) {
+	parent := t.TempDir()
+	root := filepath.Join(parent, "project")
+	writeTestFiles(t, parent, map[string]string{
+		"outside.js":                  "export const x = 1\n",
+		"outside.py":                  "X = 1\n",
+		"project/go.mod":              "module example.com/app\n\ngo 1.21\n",
+		"project/main.go":             "package main\n\nimport (\n\t\"fmt\"\n\n\t\"example.com/app/internal/store\"\n)\n\nfunc main() { fmt.Println(store.Open()) }\n",
+		"project/helpers.go":          "package main\n",
+		"project/main_test.go":        "package main\n",
+		"project/internal/store/s.go": "package store\n\nimport \"example.com/app/internal/util\"\n\nfunc Open() string { return util.Name }\n",
+		"project/internal/util/u.go":  "package util\n\nconst Name = \"u\"\n",
+		"project/web/app.ts":          "import { api } from './api'\nimport ui from './ui'\nimport x from '../../outside'\nimport React from 'react'\n",
+		"project/web/api.ts":          "export const api = require('./lib/http.js')\n",
+		"project/web/lib/http.js":     "module.exports = {}\n",
+		"project/web/ui/index.tsx":    "export default 1\n",
+		"project/py/main.py":          "import pkg.mod\nfrom . import sibling\nfrom .. import outside\nimport os\n",
+		"project/py/sibling.py":       "",
+		"project/pkg/__init__.py":     "",
+		"project/pkg/mod.py":          "",
+	})
+
+	tests := []struct {
+		name     string
+		seeds    []string
+		maxDepth int
+		want     []string
+	}{
+		{
+			name:  "go package and module imports",
+			seeds: []string{"main.go"},
+			want:  []string{"helpers.go", "internal/store/s.go", "internal/util/u.go", "main.go"},
+		},
+		{
+			name:     "max depth",
+			seeds:    []string{"main.go"},
+			maxDepth: 1,
+			want:     []string{"helpers.go", "internal/store/s.go", "main.go"},
+		},
+		{
+			name:  "js relative imports stay inside the root",
+			seeds: []string{filepath.Join(root, "web", "app.ts")},
+			want:  []string{"web/api.ts", "web/app.ts", "web/lib/http.js", "web/ui/index.tsx"},
+		},
+		{
+			name:  "python imports stay inside the root",
+			seeds: []string{"py/main.py"},
+			want:  []string{"pkg/mod.py", "py/main.py", "py/sibling.py"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _, err := resolveDependencyClosure(root, tt.seeds, tt.maxDepth)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := make([]string, len(tt.want))
+			for i, p := range tt.want {
+				want[i] = filepath.FromSlash(p)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("closure = %v, want %v", got, want)
+			}
+		})
+	}
+
+	for _, seed := range []string{"../outside.js", filepath.Join(parent, "outside.py"), "missing.go"} {
+		if got, _, err := resolveDependencyClosure(root, []string{seed}, 0); err == nil {
+			t.Errorf("seed %s: closure = %v, want an error", seed, got)
+		}
+	}
+}
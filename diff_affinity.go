@@ -0,0 +1,152 @@
+package main
+
+import (
+	"path"
+	"sort"
+	"strings"
+)
+
+// --- Affinity between parts of a diff ---
+
+// testDirNames are directory names that hold tests mirroring the source tree.
+var testDirNames = map[string]bool{"test": true, "tests": true, "__tests__": true, "spec": true, "specs": true}
+
+// testStemSuffixes mark test files: foo_test.go, foo.test.ts, foo.spec.js,
+// FooTest.java, FooTests.cs.
+var testStemSuffixes = []string{"_test", ".test", ".spec", "_spec", "Test", "Tests"}
+
+// pairKey maps a test file and the file it tests to the same key by dropping
+// test markers from the name and test directories from the path, so that
+// src/foo.ts and src/__tests__/foo.test.ts both give "src/foo".
+func pairKey(p string) string {
+	dir, name := path.Split(p)
+	stem := strings.TrimSuffix(name, path.Ext(name))
+	for _, suffix := range testStemSuffixes {
+		if trimmed := strings.TrimSuffix(stem, suffix); trimmed != stem && trimmed != "" {
+			stem = trimmed
+			break
+		}
+	}
+	stem = strings.TrimPrefix(stem, "test_") // Python
+	var parts []string
+	for _, part := range strings.Split(strings.Trim(dir, "/"), "/") {
+		if part != "" && !testDirNames[part] {
+			parts = append(parts, part)
+		}
+	}
+	return path.Join(append(parts, stem)...)
+}
+
+// affinityKeys are the keys a set of diff units relate by.
+type affinityKeys struct {
+	files map[int]bool    // File indexes
+	pairs map[string]bool // See pairKey
+	dirs  map[string]bool
+}
+
+func newAffinityKeys() affinityKeys {
+	return affinityKeys{files: make(map[int]bool), pairs: make(map[string]bool), dirs: make(map[string]bool)}
+}
+
+func (k affinityKeys) add(u diffUnit) {
+	p := u.file.Path()
+	k.files[u.fileIndex] = true
+	k.pairs[pairKey(p)] = true
+	k.dirs[path.Dir(p)] = true
+}
+
+func (k affinityKeys) union(o affinityKeys) affinityKeys {
+	merged := newAffinityKeys()
+	for _, src := range []affinityKeys{k, o} {
+		for f := range src.files {
+			merged.files[f] = true
+		}
+		for p := range src.pairs {
+			merged.pairs[p] = true
+		}
+		for d := range src.dirs {
+			merged.dirs[d] = true
+		}
+	}
+	return merged
+}
+
+func sharesKey[K comparable](a, b map[K]bool) bool {
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	for key := range a {
+		if b[key] {
+			return true
+		}
+	}
+	return false
+}
+
+// affinity rates how closely two sets of units are related: 3 if they share a
+// file, 2 if they hold a test and the file it tests, 1 if they share a
+// directory (a package, in most languages), 0 otherwise.
+func (k affinityKeys) affinity(o affinityKeys) int {
+	switch {
+	case sharesKey(k.files, o.files):
+		return 3
+	case sharesKey(k.pairs, o.pairs):
+		return 2
+	case sharesKey(k.dirs, o.dirs):
+		return 1
+	}
+	return 0
+}
+
+// affinityOrder reorders units so related ones are adjacent for packing.
+// Units linked by a directory or a test pair, directly or through others, form
+// a cluster; clusters keep the order of their first unit. Inside a cluster the
+// units of a file and its test come together, otherwise in diff order.
+func affinityOrder(units []diffUnit) []diffUnit {
+	parent := make([]int, len(units))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	union := func(i, j int) {
+		ri, rj := find(i), find(j)
+		parent[max(ri, rj)] = min(ri, rj) // The root is the earliest unit of a cluster
+	}
+	firstByKey := make(map[string]int)
+	pairFirst := make([]int, len(units))
+	for i, u := range units {
+		p := u.file.Path()
+		pair := pairKey(p)
+		for _, key := range []string{"pair:" + pair, "dir:" + path.Dir(p)} {
+			if first, ok := firstByKey[key]; ok {
+				union(i, first)
+			} else {
+				firstByKey[key] = i
+			}
+		}
+		pairFirst[i] = firstByKey["pair:"+pair]
+	}
+
+	ordered := make([]int, len(units))
+	for i := range ordered {
+		ordered[i] = i
+	}
+	sort.SliceStable(ordered, func(x, y int) bool {
+		i, j := ordered[x], ordered[y]
+		if ci, cj := find(i), find(j); ci != cj {
+			return ci < cj
+		}
+		return pairFirst[i] < pairFirst[j]
+	})
+	result := make([]diffUnit, len(units))
+	for i, idx := range ordered {
+		result[i] = units[idx]
+	}
+	return result
+}
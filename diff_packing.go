@@ -0,0 +1,202 @@
+package main
+
+import "sort"
+
+// --- Packing diff groups into splits ---
+
+// utilization is the fill ratio of the fuller of the limits in use.
+func (o DiffSplitOptions) utilization(s diffSize) float64 {
+	utilization := 0.0
+	if o.LineLimit > 0 {
+		utilization = float64(s.lines) / float64(o.LineLimit)
+	}
+	if o.TokenLimit > 0 {
+		utilization = max(utilization, float64(s.tokens)/float64(o.TokenLimit))
+	}
+	return utilization
+}
+
+// groupScore is the share of one split in diffGroupsScore.
+func groupScore(g *diffGroup, maxAllowed DiffSplitOptions) float64 {
+	score := 1000.0 // Each split costs 1000
+	// We prefer splits to be closer to maxAllowed, but not over
+	if utilization := maxAllowed.utilization(g.size); utilization > 1.0 {
+		score += 10000 * (utilization - 1.0) // Severe penalty for exceeding max allowed size
+	} else {
+		score += 100 * (1.0 - utilization) // Penalty for underutilization
+	}
+	// Bonus for related diffs merged together (see affinityKeys.affinity). It
+	// adds up over merges and could outweigh a split, which is why packings are
+	// compared by split count first (see betterPacking)
+	return score - 50*float64(g.affinity)
+}
+
+// diffGroupsScore rates a set of splits (lower is better): fewer splits first,
+// then splits closer to the max allowed size, then related diffs kept together.
+func diffGroupsScore(groups []*diffGroup, maxAllowed DiffSplitOptions) float64 {
+	if len(groups) == 0 {
+		return float64(1<<31 - 1) // Maximum value, invalid solution
+	}
+	score := 0.0
+	for _, g := range groups {
+		score += groupScore(g, maxAllowed)
+	}
+	return score
+}
+
+// betterPacking reports whether packing a beats b: fewer splits, or as many
+// splits and a lower diffGroupsScore.
+func betterPacking(a, b []*diffGroup, maxAllowed DiffSplitOptions) bool {
+	if len(a) != len(b) {
+		return len(a) < len(b)
+	}
+	return diffGroupsScore(a, maxAllowed) < diffGroupsScore(b, maxAllowed)
+}
+
+// diffBin is a split being packed: the merged group and the groups it holds.
+type diffBin struct {
+	group *diffGroup
+	items []*diffGroup
+}
+
+func newDiffBin(items []*diffGroup) *diffBin {
+	group := items[0]
+	for _, item := range items[1:] {
+		group = group.merge(item)
+	}
+	return &diffBin{group: group, items: items}
+}
+
+func (b *diffBin) with(item *diffGroup) *diffBin {
+	return &diffBin{group: b.group.merge(item), items: append(append([]*diffGroup(nil), b.items...), item)}
+}
+
+func (b *diffBin) fits(item *diffGroup, maxAllowed DiffSplitOptions) bool {
+	return !maxAllowed.exceeds(b.group.size.plus(diffSeparator).plus(item.size))
+}
+
+// bestBin returns the index of the bin item fits into with the highest
+// affinity, the first such bin on a tie, or -1 if it fits nowhere. Bins for
+// which skip returns true are not considered.
+func bestBin(bins []*diffBin, item *diffGroup, maxAllowed DiffSplitOptions, skip func(i int) bool) int {
+	best, bestAffinity := -1, -1
+	for i, b := range bins {
+		if (skip != nil && skip(i)) || !b.fits(item, maxAllowed) {
+			continue
+		}
+		if affinity := b.group.keys.affinity(item.keys); affinity > bestAffinity {
+			best, bestAffinity = i, affinity
+		}
+	}
+	return best
+}
+
+func binGroups(bins []*diffBin) []*diffGroup {
+	groups := make([]*diffGroup, len(bins))
+	for i, b := range bins {
+		groups[i] = b.group
+	}
+	return groups
+}
+
+// packDiffGroups packs groups into as few splits within maxAllowed as it can,
+// then by diffGroupsScore. It runs first fit twice, with the largest groups
+// first and in the given order (which keeps related groups adjacent, see
+// affinityOrder), improves both by moving groups next to related ones, and
+// returns the better. Each step is a single pass of O(n·splits) fit checks.
+func packDiffGroups(groups []*diffGroup, maxAllowed DiffSplitOptions) []*diffGroup {
+	if len(groups) <= 1 {
+		return groups
+	}
+	var best []*diffGroup
+	for _, order := range [][]*diffGroup{byDecreasingSize(groups, maxAllowed), groups} {
+		bins := moveRelatedGroups(firstFitDiffGroups(order, maxAllowed), maxAllowed)
+		if candidate := binGroups(bins); best == nil || betterPacking(candidate, best, maxAllowed) {
+			best = candidate
+		}
+	}
+	return best
+}
+
+func byDecreasingSize(groups []*diffGroup, maxAllowed DiffSplitOptions) []*diffGroup {
+	sorted := append([]*diffGroup(nil), groups...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return maxAllowed.utilization(sorted[i].size) > maxAllowed.utilization(sorted[j].size)
+	})
+	return sorted
+}
+
+// firstFitDiffGroups puts each group, in order, into the first split it fits,
+// preferring one it has affinity with. Then, smallest first, each split whose
+// groups all fit into the remaining ones is dissolved.
+func firstFitDiffGroups(groups []*diffGroup, maxAllowed DiffSplitOptions) []*diffBin {
+	var bins []*diffBin
+	for _, item := range groups {
+		if i := bestBin(bins, item, maxAllowed, nil); i >= 0 {
+			bins[i] = bins[i].with(item)
+		} else {
+			bins = append(bins, &diffBin{group: item, items: []*diffGroup{item}})
+		}
+	}
+
+	order := make([]int, len(bins))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(x, y int) bool {
+		return maxAllowed.utilization(bins[order[x]].group.size) < maxAllowed.utilization(bins[order[y]].group.size)
+	})
+	dissolved := make([]bool, len(bins))
+	for _, x := range order {
+		dissolved[x] = true
+		skip := func(i int) bool { return dissolved[i] }
+		trial := append([]*diffBin(nil), bins...)
+		placed := true
+		for _, item := range byDecreasingSize(bins[x].items, maxAllowed) {
+			i := bestBin(trial, item, maxAllowed, skip)
+			if i < 0 {
+				placed = false
+				break
+			}
+			trial[i] = trial[i].with(item)
+		}
+		if placed {
+			bins = trial
+		} else {
+			dissolved[x] = false
+		}
+	}
+	kept := bins[:0]
+	for i, b := range bins {
+		if !dissolved[i] {
+			kept = append(kept, b)
+		}
+	}
+	return kept
+}
+
+// moveRelatedGroups makes one pass over the groups, moving each to the split
+// it has the most affinity with if it fits there and that lowers the score.
+// The number of splits stays the same, and moving a group keeps the total
+// size, so only moves towards a related split can pay off.
+func moveRelatedGroups(bins []*diffBin, maxAllowed DiffSplitOptions) []*diffBin {
+	for x := range bins {
+		for i := 0; i < len(bins[x].items) && len(bins[x].items) > 1; i++ {
+			from, item := bins[x], bins[x].items[i]
+			y := bestBin(bins, item, maxAllowed, func(j int) bool { return j == x })
+			if y < 0 || bins[y].group.keys.affinity(item.keys) == 0 {
+				continue
+			}
+			to := bins[y]
+			rest := newDiffBin(append(append([]*diffGroup(nil), from.items[:i]...), from.items[i+1:]...))
+			joined := to.with(item)
+			delta := groupScore(rest.group, maxAllowed) + groupScore(joined.group, maxAllowed) -
+				groupScore(from.group, maxAllowed) - groupScore(to.group, maxAllowed)
+			if delta < -1e-9 {
+				bins[x], bins[y] = rest, joined
+				i-- // The next group moved into position i
+			}
+		}
+	}
+	return bins
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"shotgun_code/internal/unidiff"
+)
+
+// discardLog drops the messages of splitDiff.
+type discardLog struct{}
+
+func (discardLog) Infof(format string, args ...interface{})    {}
+func (discardLog) Warningf(format string, args ...interface{}) {}
+
+// randomDiffGroups returns n single-unit groups of random size up to limit
+// lines, spread over a few directories with some tests, in affinity order.
+func randomDiffGroups(r *rand.Rand, n, limit int) []*diffGroup {
+	dirs := []string{"src", "src/util", "web", "docs", "pkg/a", "pkg/b", "test"}
+	units := make([]diffUnit, n)
+	for i := range units {
+		name := fmt.Sprintf("%s/f%d.go", dirs[r.Intn(len(dirs))], r.Intn(n))
+		if r.Intn(4) == 0 {
+			name = fmt.Sprintf("%s/f%d_test.go", dirs[r.Intn(len(dirs))], r.Intn(n))
+		}
+		lines := 1 + r.Intn(limit-1)
+		if r.Intn(2) == 0 {
+			lines = 1 + r.Intn(limit/4)
+		}
+		units[i] = diffUnit{
+			file:      &unidiff.FilePatch{OldPath: name, NewPath: name},
+			fileIndex: i,
+			size:      diffSize{lines: lines, tokens: lines * (5 + r.Intn(10))},
+		}
+	}
+	var groups []*diffGroup
+	for _, unit := range affinityOrder(units) {
+		g := newDiffGroup()
+		g.add(unit)
+		groups = append(groups, g)
+	}
+	return groups
+}
+
+// baselineGroupScore is the score of one split in the original pairwise merge
+// of SplitShotgunDiff: 1000 per split plus the penalty for its line count. It
+// knew neither token limits nor affinity, and is the yardstick for the packing.
+func baselineGroupScore(g *diffGroup, maxAllowed DiffSplitOptions) float64 {
+	score := 1000.0
+	if utilization := float64(g.size.lines) / float64(maxAllowed.LineLimit); utilization > 1.0 {
+		score += 10000 * (utilization - 1.0)
+	} else {
+		score += 100 * (1.0 - utilization)
+	}
+	return score
+}
+
+func baselineGroupsScore(groups []*diffGroup, maxAllowed DiffSplitOptions) float64 {
+	score := 0.0
+	for _, g := range groups {
+		score += baselineGroupScore(g, maxAllowed)
+	}
+	return score
+}
+
+// pairwiseMergeDiffGroups is the packing packDiffGroups replaced: repeatedly
+// merge the pair of groups that lowers baselineGroupsScore the most. It takes
+// O(n³) score evaluations and serves as the reference for the packing quality.
+func pairwiseMergeDiffGroups(groups []*diffGroup, maxAllowed DiffSplitOptions) []*diffGroup {
+	groups = append([]*diffGroup(nil), groups...)
+	for {
+		bestI, bestJ, bestDelta := -1, -1, 0.0
+		for i := range groups {
+			for j := i + 1; j < len(groups); j++ {
+				merged := groups[i].merge(groups[j])
+				if maxAllowed.exceeds(merged.size) {
+					continue
+				}
+				delta := baselineGroupScore(merged, maxAllowed) - baselineGroupScore(groups[i], maxAllowed) - baselineGroupScore(groups[j], maxAllowed)
+				if delta < bestDelta {
+					bestI, bestJ, bestDelta = i, j, delta
+				}
+			}
+		}
+		if bestI < 0 {
+			return groups
+		}
+		groups[bestI] = groups[bestI].merge(groups[bestJ])
+		groups = append(groups[:bestJ], groups[bestJ+1:]...)
+	}
+}
+
+func TestPackDiffGroupsAgainstPairwiseMerge(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	var fewer, equal int
+	for trial := 0; trial < 100; trial++ {
+		n, limit := 2+r.Intn(40), 20+r.Intn(200)
+		maxAllowed := DiffSplitOptions{LineLimit: limit * 6 / 5}
+		if r.Intn(3) == 0 {
+			maxAllowed.TokenLimit = limit * 8
+		}
+		groups := randomDiffGroups(r, n, limit)
+
+		packed := packDiffGroups(groups, maxAllowed)
+		reference := pairwiseMergeDiffGroups(groups, maxAllowed)
+
+		units := 0
+		for _, g := range packed {
+			units += len(g.units)
+			if len(g.units) > 1 && maxAllowed.exceeds(g.size) {
+				t.Errorf("trial %d: split with %d lines (~%d tokens) is over %+v", trial, g.size.lines, g.size.tokens, maxAllowed)
+			}
+		}
+		if units != n {
+			t.Errorf("trial %d: packed %d units, want %d", trial, units, n)
+		}
+		switch {
+		case len(packed) > len(reference):
+			t.Errorf("trial %d: %d splits, pairwise merge needs only %d", trial, len(packed), len(reference))
+		case len(packed) < len(reference):
+			fewer++
+		default:
+			equal++
+			// Affinity aside, the packing must score at least as well as the pairwise merge
+			if score, referenceScore := baselineGroupsScore(packed, maxAllowed), baselineGroupsScore(reference, maxAllowed); score > referenceScore+1e-9 {
+				t.Errorf("trial %d: baseline score %.2f, pairwise merge %.2f", trial, score, referenceScore)
+			}
+		}
+	}
+	t.Logf("fewer splits than pairwise merge in %d trials, as many in %d", fewer, equal)
+}
+
+func TestGroupScoreAffinityNeverCostsASplit(t *testing.T) {
+	maxAllowed := DiffSplitOptions{LineLimit: 120}
+	// Many hunks of one file in two splits, against the same hunks spread over
+	// three splits, one of them with all the affinity
+	file := func(n int) *diffGroup {
+		g := newDiffGroup()
+		for i := 0; i < n; i++ {
+			g.add(diffUnit{file: &unidiff.FilePatch{OldPath: "a.go", NewPath: "a.go"}, hunkIndex: i, size: diffSize{lines: 1}})
+		}
+		return g
+	}
+	two := []*diffGroup{file(2), file(2)}
+	three := []*diffGroup{file(40), file(1), file(1)}
+	if betterPacking(three, two, maxAllowed) {
+		t.Errorf("three splits (score %.1f) beat two (score %.1f)", diffGroupsScore(three, maxAllowed), diffGroupsScore(two, maxAllowed))
+	}
+}
+
+// shotgunDiff returns a diff of n small files in a few directories.
+func shotgunDiff(n int) string {
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		name := fmt.Sprintf("pkg%d/file%d.go", i%7, i)
+		fmt.Fprintf(&b, "diff --git a/%[1]s b/%[1]s\n--- a/%[1]s\n+++ b/%[1]s\n@@ -%[2]d,4 +%[2]d,%[3]d @@\n", name, 10+i%5, 5+i%3)
+		b.WriteString(" func f() {\n")
+		for j := 0; j < 1+i%3; j++ {
+			fmt.Fprintf(&b, "+\tcall%d()\n", j)
+		}
+		b.WriteString(" \treturn\n }\n \n")
+	}
+	return b.String()
+}
+
+func BenchmarkSplitShotgunDiff(b *testing.B) {
+	diff := shotgunDiff(400)
+	opts := DiffSplitOptions{LineLimit: 200}
+	b.ResetTimer()
+	var splits []DiffSplit
+	for i := 0; i < b.N; i++ {
+		var err error
+		if splits, err = splitDiff(diff, opts, discardLog{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(len(splits)), "splits")
+}
+
+// BenchmarkPairwiseMergeShotgunDiff splits the input of
+// BenchmarkSplitShotgunDiff with the pairwise merge that packing replaced.
+func BenchmarkPairwiseMergeShotgunDiff(b *testing.B) {
+	diff := shotgunDiff(400)
+	opts := DiffSplitOptions{LineLimit: 200}
+	maxAllowed := DiffSplitOptions{LineLimit: opts.LineLimit * 6 / 5}
+	b.ResetTimer()
+	var splits int
+	for i := 0; i < b.N; i++ {
+		patch, err := unidiff.ParseLenient(diff)
+		if err != nil {
+			b.Fatal(err)
+		}
+		var large, small []*diffGroup
+		for _, g := range initialDiffGroups(diffUnits(patch, opts, discardLog{}), opts) {
+			if g.size.lines >= opts.LineLimit {
+				large = append(large, g)
+			} else {
+				small = append(small, g)
+			}
+		}
+		splits = len(large) + len(pairwiseMergeDiffGroups(small, maxAllowed))
+	}
+	b.ReportMetric(float64(splits), "splits")
+}
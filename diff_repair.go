@@ -0,0 +1,376 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"shotgun_code/internal/unidiff"
+)
+
+// --- Repairing malformed diffs from model output ---
+
+// Kinds of DiffRepair.
+const (
+	DiffRepairExtracted  = "extracted"   // Text around the diff was removed
+	DiffRepairFileHeader = "file-header" // A file header was added or completed
+	DiffRepairHunkHeader = "hunk-header" // A hunk header was recomputed from its body
+	DiffRepairUnresolved = "unresolved"  // A problem was found but could not be fixed
+)
+
+// DiffRepair describes one change repairDiff made to a diff.
+type DiffRepair struct {
+	Kind    string `json:"kind"`
+	File    string `json:"file,omitempty"`
+	Hunk    int    `json:"hunk,omitempty"` // 1-based; 0 when the repair concerns the whole file
+	Message string `json:"message"`
+}
+
+// RepairedDiff is the result of RepairDiff.
+type RepairedDiff struct {
+	Diff    string       `json:"diff"`
+	Repairs []DiffRepair `json:"repairs"`
+}
+
+var (
+	markdownFenceRegex = regexp.MustCompile("^ {0,3}(`{3,}|~{3,})\\s*(.*)$")
+	backtickPathRegex  = regexp.MustCompile("`([^`\\s]*[./][^`\\s]*)`")
+	barePathRegex      = regexp.MustCompile(`(?:^|[\s(:'"*_\[])((?:[\w.-]+/)*[\w-][\w.-]*\.[A-Za-z][A-Za-z0-9]*)\b`)
+)
+
+// diffSegment is a candidate diff taken from a response, with a file path
+// hint from the fence info string, for hunks that come without a file header.
+type diffSegment struct {
+	lines []string
+	hint  string
+}
+
+// looksLikeDiff reports whether lines contain a file header or a hunk header.
+func looksLikeDiff(lines []string) bool {
+	for i, line := range lines {
+		if strings.HasPrefix(line, "@@") || unidiff.IsFileStart(lines, i) {
+			return true
+		}
+	}
+	return false
+}
+
+// pathInText returns the last file path mentioned in a line of prose, such as
+// "Changes to `src/app.go`:" or "### main.go", or "" if there is none.
+func pathInText(line string) string {
+	if m := backtickPathRegex.FindAllStringSubmatch(line, -1); m != nil {
+		return m[len(m)-1][1]
+	}
+	if m := barePathRegex.FindAllStringSubmatch(line, -1); m != nil {
+		return m[len(m)-1][1]
+	}
+	return ""
+}
+
+// fileLabel returns the path if line is nothing but a file name with markdown
+// decoration, such as "**src/app.go**", "### `main.go`:" or "File: x.go".
+func fileLabel(line string) string {
+	label := strings.Trim(line, " \t#*-_>:`'\"")
+	if len(label) > 5 && strings.EqualFold(label[:5], "file:") {
+		label = strings.Trim(label[5:], " \t*_:`'\"")
+	}
+	if m := barePathRegex.FindStringSubmatch(label); m != nil && m[1] == label {
+		return label
+	}
+	return ""
+}
+
+// extractDiffSegments returns the fenced code blocks of text that look like
+// diffs, or the whole text as one segment if there are none or the text
+// already starts with a diff.
+func extractDiffSegments(lines []string) ([]diffSegment, []DiffRepair) {
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "@@") || unidiff.IsFileStart(lines, i) {
+			return []diffSegment{{lines: lines}}, nil
+		}
+		break
+	}
+	var segments []diffSegment
+	proseLines, lastProse := 0, ""
+	for i := 0; i < len(lines); i++ {
+		m := markdownFenceRegex.FindStringSubmatch(strings.TrimSuffix(lines[i], "\r"))
+		if m == nil {
+			if strings.TrimSpace(lines[i]) != "" {
+				proseLines++
+				lastProse = lines[i]
+			}
+			continue
+		}
+		fence := m[1]
+		var body []string
+		j := i + 1
+		for ; j < len(lines); j++ {
+			if c := markdownFenceRegex.FindStringSubmatch(strings.TrimSuffix(lines[j], "\r")); c != nil && c[2] == "" &&
+				c[1][0] == fence[0] && len(c[1]) >= len(fence) {
+				break
+			}
+			body = append(body, lines[j])
+		}
+		if looksLikeDiff(body) {
+			var hint string
+			for _, field := range strings.Fields(m[2]) {
+				if p := pathInText(field); p != "" {
+					hint = p
+				}
+			}
+			if hint == "" {
+				hint = pathInText(lastProse)
+			}
+			segments = append(segments, diffSegment{lines: body, hint: hint})
+		} else {
+			proseLines += j - i + 1
+		}
+		i, lastProse = j, ""
+	}
+	if len(segments) == 0 {
+		return []diffSegment{{lines: lines}}, nil
+	}
+	msg := fmt.Sprintf("took the diff from %d markdown code block(s)", len(segments))
+	if proseLines > 0 {
+		msg += fmt.Sprintf(" and dropped %d line(s) of surrounding text", proseLines)
+	}
+	return segments, []DiffRepair{{Kind: DiffRepairExtracted, Message: msg}}
+}
+
+// placeholderHunkHeader replaces a hunk header without line numbers; its
+// all-zero ranges never occur in a real diff and are recomputed later.
+const placeholderHunkHeader = "@@ -0,0 +0,0 @@"
+
+// repairSegmentLines drops text before the diff, gives hunks without a file
+// header one when the file can be told from the surrounding text, and replaces
+// hunk headers that have no line numbers.
+func repairSegmentLines(seg diffSegment) ([]string, []DiffRepair) {
+	var out []string
+	var repairs []DiffRepair
+	currentPath, lastProse := "", ""
+	started, inHunk := false, false
+	dropped := 0
+
+	for i := 0; i < len(seg.lines); i++ {
+		line := seg.lines[i]
+		trimmed := strings.TrimSuffix(line, "\r")
+		switch {
+		case unidiff.IsFileStart(seg.lines, i):
+			started, inHunk, lastProse = true, false, ""
+			currentPath = ""
+			if strings.HasPrefix(trimmed, "diff --git ") {
+				_, currentPath = unidiff.ParseGitHeaderPaths(strings.TrimPrefix(trimmed, "diff --git "))
+			} else {
+				currentPath = unidiff.ParsePath(strings.TrimPrefix(seg.lines[i+1], "+++ "), "b/")
+			}
+
+		case strings.HasPrefix(trimmed, "@@"):
+			// Before the diff any mention of a file will do; between hunks only
+			// a line that is just a file name, so prose about other files does
+			// not split a file.
+			path := fileLabel(lastProse)
+			if !started && path == "" {
+				path = pathInText(lastProse)
+			}
+			if !started && path == "" {
+				path = seg.hint
+			}
+			if path != "" && path != currentPath {
+				out = append(out, "diff --git a/"+path+" b/"+path, "--- a/"+path, "+++ b/"+path)
+				repairs = append(repairs, DiffRepair{Kind: DiffRepairFileHeader, File: path, Message: "added the missing file header"})
+				currentPath = path
+			} else if !started {
+				repairs = append(repairs, DiffRepair{Kind: DiffRepairUnresolved, Message: "a hunk has no file header and no file name nearby"})
+			}
+			if !unidiff.IsHunkHeader(trimmed) {
+				section := ""
+				if _, after, found := strings.Cut(trimmed[2:], "@@"); found {
+					section = after
+				}
+				line = placeholderHunkHeader + section
+			}
+			started, inHunk, lastProse = true, true, ""
+
+		case inHunk && (trimmed == "" || strings.ContainsRune(" -+\\", rune(trimmed[0]))):
+			// Hunk body
+
+		case trimmed != "":
+			inHunk, lastProse = false, trimmed
+			if !started {
+				dropped++
+				continue
+			}
+
+		case !started:
+			continue
+		}
+		out = append(out, line)
+	}
+	if dropped > 0 {
+		repairs = append([]DiffRepair{{Kind: DiffRepairExtracted, Message: fmt.Sprintf("dropped %d line(s) of text before the diff", dropped)}}, repairs...)
+	}
+	return out, repairs
+}
+
+// hasHeaderLine reports whether a raw file header has a line with the prefix.
+func hasHeaderLine(header []string, prefix string) bool {
+	for _, line := range header {
+		if strings.HasPrefix(line, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// repairFilePatch completes the header of f and recomputes its hunk ranges
+// from the hunk bodies. Old start lines cannot be checked without the file and
+// are kept, except for placeholders, which continue after the previous hunk.
+// New start lines follow the offset of the first hunk with a real header, so a
+// partial diff (one split of a larger diff) keeps its offsets.
+func repairFilePatch(f *unidiff.FilePatch) []DiffRepair {
+	var repairs []DiffRepair
+	repair := func(kind string, hunk int, format string, args ...any) {
+		repairs = append(repairs, DiffRepair{Kind: kind, File: f.Path(), Hunk: hunk, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if len(f.Hunks) > 0 && !f.IsBinary {
+		missingGit := !hasHeaderLine(f.Header, "diff --git ")
+		missingPaths := !hasHeaderLine(f.Header, "--- ") || !hasHeaderLine(f.Header, "+++ ")
+		if missingGit || missingPaths {
+			f.Header = nil
+			switch {
+			case missingGit && missingPaths:
+				repair(DiffRepairFileHeader, 0, "added the missing diff --git and ---/+++ lines")
+			case missingGit:
+				repair(DiffRepairFileHeader, 0, "added the missing diff --git line")
+			default:
+				repair(DiffRepairFileHeader, 0, "added the missing ---/+++ lines")
+			}
+		}
+	}
+
+	delta, deltaKnown, nextOld, blankContext, strayText := 0, false, 1, 0, 0
+	for n, h := range f.Hunks {
+		parsedOldStart, parsedOldLines, parsedNewStart, parsedNewLines := h.HeaderRanges()
+		hasRanges := parsedOldStart != 0 || parsedOldLines != 0 || parsedNewStart != 0 || parsedNewLines != 0
+		if !deltaKnown && hasRanges {
+			oldFirst, newFirst := parsedOldStart, parsedNewStart
+			if parsedOldLines == 0 {
+				oldFirst++
+			}
+			if parsedNewLines == 0 {
+				newFirst++
+			}
+			delta, deltaKnown = newFirst-oldFirst, true
+		}
+		oldLines, newLines := 0, 0
+		for i, l := range h.Lines {
+			if l.IsBare() {
+				h.Lines[i] = unidiff.HunkLine{Kind: l.Kind, Text: l.Text}
+				blankContext++
+			}
+			switch l.Kind {
+			case unidiff.HunkLineContext:
+				oldLines++
+				newLines++
+			case unidiff.HunkLineDelete:
+				oldLines++
+			case unidiff.HunkLineAdd:
+				newLines++
+			}
+		}
+		for _, line := range h.Trailer {
+			if strings.TrimSpace(line) != "" {
+				strayText++
+			}
+		}
+		h.Trailer = nil
+
+		if !hasRanges {
+			h.OldStart = nextOld
+			if oldLines == 0 {
+				h.OldStart--
+			}
+			repair(DiffRepairHunkHeader, n+1, "hunk header had no line numbers; assumed it starts at line %d", nextOld)
+		}
+		if h.OldLines != oldLines || h.NewLines != newLines {
+			if hasRanges {
+				repair(DiffRepairHunkHeader, n+1, "header counted %d old and %d new lines; the body has %d and %d", h.OldLines, h.NewLines, oldLines, newLines)
+			}
+			h.OldLines, h.NewLines = oldLines, newLines
+		}
+
+		oldFirst := h.OldStart
+		if h.OldLines == 0 {
+			oldFirst++
+		}
+		newStart := oldFirst + delta
+		if h.NewLines == 0 {
+			newStart--
+		}
+		if h.NewStart != newStart {
+			if hasRanges {
+				repair(DiffRepairHunkHeader, n+1, "new start line %d does not follow from the earlier hunks; changed to %d", h.NewStart, newStart)
+			}
+			h.NewStart = newStart
+		}
+		delta += h.NewLines - h.OldLines
+		nextOld = oldFirst + h.OldLines
+	}
+	if blankContext > 0 {
+		repair(DiffRepairHunkHeader, 0, "restored the leading space of %d blank context line(s)", blankContext)
+	}
+	if strayText > 0 {
+		repair(DiffRepairExtracted, 0, "dropped %d line(s) of text between hunks", strayText)
+	}
+	return repairs
+}
+
+// repairDiff normalizes a diff written by a model: it takes the diff out of
+// markdown fences and prose, adds missing file headers and recomputes hunk
+// headers from their bodies. Text without anything that looks like a diff is
+// returned unchanged, and so is a diff that needs no repair.
+func repairDiff(text string) (string, []DiffRepair) {
+	repairs := []DiffRepair{}
+	lines := strings.Split(text, "\n")
+	if !looksLikeDiff(lines) {
+		return text, repairs
+	}
+
+	segments, extracted := extractDiffSegments(lines)
+	repairs = append(repairs, extracted...)
+	var joined []string
+	for _, seg := range segments {
+		segLines, segRepairs := repairSegmentLines(seg)
+		joined = append(joined, segLines...)
+		repairs = append(repairs, segRepairs...)
+	}
+
+	patch, err := unidiff.ParseLenient(strings.Join(joined, "\n"))
+	if err != nil {
+		// Unreachable with the placeholder headers, but never lose the input.
+		repairs = append(repairs, DiffRepair{Kind: DiffRepairUnresolved, Message: err.Error()})
+		return text, repairs
+	}
+	for _, f := range patch.Files {
+		repairs = append(repairs, repairFilePatch(f)...)
+	}
+	for len(patch.Preamble) > 0 && strings.TrimSpace(patch.Preamble[len(patch.Preamble)-1]) == "" {
+		patch.Preamble = patch.Preamble[:len(patch.Preamble)-1]
+	}
+	if len(repairs) == 0 {
+		return text, repairs
+	}
+	patch.NoFinalNewline = false
+	return patch.String(), repairs
+}
+
+// RepairDiff returns the normalized form of a diff and the repairs made to it,
+// as SplitShotgunDiff applies them before splitting.
+func (a *App) RepairDiff(text string) *RepairedDiff {
+	diff, repairs := repairDiff(text)
+	return &RepairedDiff{Diff: diff, Repairs: repairs}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"shotgun_code/internal/unidiff"
+)
+
+func TestRepairDiff(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string // Empty means the input is returned unchanged
+		kinds []string
+	}{
+		{
+			name:  "valid diff",
+			input: "diff --git a/a.txt b/a.txt\n--- a/a.txt\n+++ b/a.txt\n@@ -1,2 +1,2 @@\n x\n-a\n+b\n",
+		},
+		{
+			name:  "not a diff",
+			input: "Sorry, I cannot help with that.\n",
+		},
+		{
+			name:  "markdown fence and prose",
+			input: "Here is the fix:\n\n```diff\ndiff --git a/a.txt b/a.txt\n--- a/a.txt\n+++ b/a.txt\n@@ -1,2 +1,2 @@\n x\n-a\n+b\n```\n\nThis renames a to b.\n",
+			want:  "diff --git a/a.txt b/a.txt\n--- a/a.txt\n+++ b/a.txt\n@@ -1,2 +1,2 @@\n x\n-a\n+b\n",
+			kinds: []string{DiffRepairExtracted},
+		},
+		{
+			name:  "text before the diff",
+			input: "The fix:\ndiff --git a/a.txt b/a.txt\n--- a/a.txt\n+++ b/a.txt\n@@ -1,2 +1,2 @@\n x\n-a\n+b\n",
+			want:  "diff --git a/a.txt b/a.txt\n--- a/a.txt\n+++ b/a.txt\n@@ -1,2 +1,2 @@\n x\n-a\n+b\n",
+			kinds: []string{DiffRepairExtracted},
+		},
+		{
+			name:  "missing diff --git line",
+			input: "--- a/a.txt\n+++ b/a.txt\n@@ -1,2 +1,2 @@\n x\n-a\n+b\n",
+			want:  "diff --git a/a.txt b/a.txt\n--- a/a.txt\n+++ b/a.txt\n@@ -1,2 +1,2 @@\n x\n-a\n+b\n",
+			kinds: []string{DiffRepairFileHeader},
+		},
+		{
+			name:  "hunk without a file header, file named in the fence",
+			input: "```diff src/a.go\n@@ -1,2 +1,2 @@\n x\n-a\n+b\n```\n",
+			want:  "diff --git a/src/a.go b/src/a.go\n--- a/src/a.go\n+++ b/src/a.go\n@@ -1,2 +1,2 @@\n x\n-a\n+b\n",
+			kinds: []string{DiffRepairExtracted, DiffRepairFileHeader},
+		},
+		{
+			name:  "hunks without file headers, files named before each",
+			input: "src/a.go\n@@ -1 +1 @@\n-a\n+b\nsrc/b.go\n@@ -1 +1 @@\n-c\n+d\n",
+			want:  "diff --git a/src/a.go b/src/a.go\n--- a/src/a.go\n+++ b/src/a.go\n@@ -1 +1 @@\n-a\n+b\ndiff --git a/src/b.go b/src/b.go\n--- a/src/b.go\n+++ b/src/b.go\n@@ -1 +1 @@\n-c\n+d\n",
+			kinds: []string{DiffRepairExtracted, DiffRepairFileHeader, DiffRepairFileHeader, DiffRepairExtracted},
+		},
+		{
+			name:  "hunk without a file header or file name",
+			input: "@@ -1 +1 @@\n-a\n+b\n",
+			want:  "@@ -1 +1 @@\n-a\n+b\n",
+			kinds: []string{DiffRepairUnresolved},
+		},
+		{
+			name:  "miscounted hunk header",
+			input: "diff --git a/a.txt b/a.txt\n--- a/a.txt\n+++ b/a.txt\n@@ -1,5 +1,5 @@\n x\n-a\n+b\n",
+			want:  "diff --git a/a.txt b/a.txt\n--- a/a.txt\n+++ b/a.txt\n@@ -1,2 +1,2 @@\n x\n-a\n+b\n",
+			kinds: []string{DiffRepairHunkHeader},
+		},
+		{
+			name:  "hunk header without line numbers",
+			input: "diff --git a/a.txt b/a.txt\n--- a/a.txt\n+++ b/a.txt\n@@ ... @@\n x\n-a\n+b\n+c\n",
+			want:  "diff --git a/a.txt b/a.txt\n--- a/a.txt\n+++ b/a.txt\n@@ -1,2 +1,3 @@\n x\n-a\n+b\n+c\n",
+			kinds: []string{DiffRepairHunkHeader},
+		},
+		{
+			name:  "new start line off",
+			input: "diff --git a/a.txt b/a.txt\n--- a/a.txt\n+++ b/a.txt\n@@ -1,2 +1,3 @@\n x\n+y\n z\n@@ -10,2 +10,2 @@\n p\n-q\n+r\n",
+			want:  "diff --git a/a.txt b/a.txt\n--- a/a.txt\n+++ b/a.txt\n@@ -1,2 +1,3 @@\n x\n+y\n z\n@@ -10,2 +11,2 @@\n p\n-q\n+r\n",
+			kinds: []string{DiffRepairHunkHeader},
+		},
+		{
+			name:  "partial diff keeps its offset",
+			input: "diff --git a/a.txt b/a.txt\n--- a/a.txt\n+++ b/a.txt\n@@ -20,2 +25,2 @@\n p\n-q\n+r\n",
+		},
+		{
+			name:  "blank context line without its space",
+			input: "diff --git a/a.txt b/a.txt\n--- a/a.txt\n+++ b/a.txt\n@@ -1,3 +1,3 @@\n x\n\n-a\n+b\n",
+			want:  "diff --git a/a.txt b/a.txt\n--- a/a.txt\n+++ b/a.txt\n@@ -1,3 +1,3 @@\n x\n \n-a\n+b\n",
+			kinds: []string{DiffRepairHunkHeader},
+		},
+		{
+			name:  "text between hunks",
+			input: "diff --git a/a.txt b/a.txt\n--- a/a.txt\n+++ b/a.txt\n@@ -1 +1 @@\n-a\n+b\nAnd further down:\n@@ -5 +5 @@\n-c\n+d\n",
+			want:  "diff --git a/a.txt b/a.txt\n--- a/a.txt\n+++ b/a.txt\n@@ -1 +1 @@\n-a\n+b\n@@ -5 +5 @@\n-c\n+d\n",
+			kinds: []string{DiffRepairExtracted},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, repairs := repairDiff(tt.input)
+			want := tt.want
+			if want == "" {
+				want = tt.input
+			}
+			if got != want {
+				t.Errorf("repairDiff() = %q, want %q", got, want)
+			}
+			var kinds []string
+			for _, r := range repairs {
+				kinds = append(kinds, r.Kind)
+			}
+			if !reflect.DeepEqual(kinds, tt.kinds) {
+				t.Errorf("repair kinds = %q, want %q (%+v)", kinds, tt.kinds, repairs)
+			}
+			if _, err := unidiff.Parse(got); tt.want != "" && err != nil {
+				t.Errorf("repaired diff does not parse strictly: %v", err)
+			}
+		})
+	}
+}
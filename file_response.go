@@ -0,0 +1,165 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"regexp"
+	"strings"
+
+	"shotgun_code/internal/unidiff"
+)
+
+// --- Whole-file responses ---
+
+// ResponseFile is one file of a whole-file response compared with the working tree.
+type ResponseFile struct {
+	Path    string `json:"path"`
+	Action  string `json:"action"` // "create", "modify" or "unchanged"
+	Added   int    `json:"added"`
+	Removed int    `json:"removed"`
+}
+
+// FileResponseDiff is a whole-file response converted to a unified diff.
+type FileResponseDiff struct {
+	Diff  string         `json:"diff"`
+	Files []ResponseFile `json:"files"`
+}
+
+// responseFileEndRegex matches a closing tag on a line of its own. Unlike our
+// own context, a response may have prose after a file, so the first closing
+// tag ends the block.
+var responseFileEndRegex = regexp.MustCompile(`(?m)^</file>[ \t\r]*$`)
+
+// isFileResponse reports whether text holds <file path="..."> blocks rather than a diff.
+func isFileResponse(text string) bool {
+	return contextFileStartRegex.MatchString(text)
+}
+
+// parseResponseFiles extracts the file blocks of a model response. A context
+// with a manifest (a response that echoes our own format) is parsed exactly;
+// otherwise each block ends at its first closing tag, and a markdown fence
+// wrapping the whole body is removed.
+func parseResponseFiles(text string) []contextFile {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	if _, _, hasManifest := splitManifestHeader(text); hasManifest {
+		return parseContextFiles(text)
+	}
+
+	var files []contextFile
+	pos := 0
+	for {
+		loc := contextFileStartRegex.FindStringSubmatchIndex(text[pos:])
+		if loc == nil {
+			break
+		}
+		path := text[pos+loc[2] : pos+loc[3]]
+		start := pos + loc[1]
+		body := text[start:]
+		pos = len(text)
+		if end := responseFileEndRegex.FindStringIndex(body); end != nil {
+			body = strings.TrimSuffix(body[:end[0]], "\n")
+			pos = start + end[1]
+		}
+		files = append(files, contextFile{Path: path, Body: unfenceFileBody(body)})
+	}
+	return files
+}
+
+// unfenceFileBody removes a markdown code fence around a whole file body.
+func unfenceFileBody(body string) string {
+	lines := strings.Split(strings.TrimRight(body, "\n"), "\n")
+	if len(lines) < 2 {
+		return body
+	}
+	open := markdownFenceRegex.FindStringSubmatch(lines[0])
+	last := markdownFenceRegex.FindStringSubmatch(lines[len(lines)-1])
+	if open == nil || last == nil || last[2] != "" || last[1] != open[1] {
+		return body
+	}
+	return strings.Join(lines[1:len(lines)-1], "\n")
+}
+
+// fileResponseDiff diffs the files of a whole-file response against rootDir.
+// Models rarely end a file block with an empty line, so a body gets a final
+// newline unless the current file has none; CRLF files keep their endings.
+func fileResponseDiff(rootDir, response string) (*FileResponseDiff, error) {
+	files := parseResponseFiles(response)
+	if len(files) == 0 {
+		return nil, fmt.Errorf("response contains no <file path=\"...\"> blocks")
+	}
+	latest := make(map[string]string, len(files))
+	var order []string
+	for _, f := range files {
+		if _, seen := latest[f.Path]; !seen {
+			order = append(order, f.Path)
+		}
+		latest[f.Path] = f.Body // A later block for the same file wins
+	}
+
+	result := &FileResponseDiff{Files: []ResponseFile{}}
+	var diff strings.Builder
+	for _, path := range order {
+		absPath, err := resolvePatchPath(rootDir, path)
+		if err != nil {
+			return nil, err
+		}
+		newText := latest[path]
+		oldData, err := os.ReadFile(absPath)
+		exists := err == nil
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		oldText := string(oldData)
+
+		if newText != "" && !strings.HasSuffix(newText, "\n") && (!exists || strings.HasSuffix(oldText, "\n")) {
+			newText += "\n"
+		}
+		if strings.Contains(oldText, "\r\n") && !strings.Contains(newText, "\r") {
+			newText = strings.ReplaceAll(newText, "\n", "\r\n")
+		}
+
+		file := ResponseFile{Path: path, Action: "modify"}
+		oldPath := path
+		if !exists {
+			file.Action, oldPath = "create", ""
+		}
+		// A new empty file still gets a diff: its header creates the file
+		fileDiff := unifiedDiff(oldPath, path, oldText, newText, 3)
+		if fileDiff == "" {
+			file.Action = "unchanged"
+		} else {
+			patch, err := unidiff.Parse(fileDiff)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse the diff of %s: %w", path, err)
+			}
+			for _, fp := range patch.Files {
+				for _, h := range fp.Hunks {
+					for _, l := range h.Lines {
+						switch l.Kind {
+						case unidiff.HunkLineAdd:
+							file.Added++
+						case unidiff.HunkLineDelete:
+							file.Removed++
+						}
+					}
+				}
+			}
+		}
+		diff.WriteString(fileDiff)
+		result.Files = append(result.Files, file)
+	}
+	result.Diff = diff.String()
+	return result, nil
+}
+
+// DiffFileResponse converts a response made of complete files into a unified
+// diff against the files under rootDir, for preview. SplitShotgunDiffWithOptions
+// (given a RootDir) and ApplyDiff accept such responses directly.
+func (a *App) DiffFileResponse(rootDir string, response string) (*FileResponseDiff, error) {
+	if err := checkProjectRoot(rootDir); err != nil {
+		return nil, err
+	}
+	return fileResponseDiff(rootDir, response)
+}
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	gitignore "github.com/sabhiram/go-gitignore"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// --- Context generation from a git tree-ish ---
+
+// gitTreeEntry is one path of a git tree listing.
+type gitTreeEntry struct {
+	name   string
+	isDir  bool
+	object string
+	size   int64
+}
+
+// gitTreeFS is a read-only fs.FS over a commit, tag or branch of a local
+// repository. The listing is loaded once; blobs are read on demand from a
+// single `git cat-file --batch` process, so the working tree is never touched.
+// The process is tied to the context the FS was created with; Close stops it.
+type gitTreeFS struct {
+	ctx      context.Context
+	repoDir  string
+	treeish  string
+	entries  map[string]gitTreeEntry
+	children map[string][]string // Directory path ("." for the root) -> sorted child paths
+
+	mu     sync.Mutex // Guards the cat-file process
+	batch  *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+}
+
+// runGit runs a git command in repoDir and returns its stdout.
+func runGit(ctx context.Context, repoDir string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", repoDir}, args...)...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("git %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+func newGitTreeFS(ctx context.Context, repoDir, treeish string) (*gitTreeFS, error) {
+	if strings.HasPrefix(treeish, "-") {
+		return nil, fmt.Errorf("invalid tree-ish %q", treeish)
+	}
+	if _, err := runGit(ctx, repoDir, "rev-parse", "--verify", "--quiet", treeish+"^{tree}"); err != nil {
+		return nil, fmt.Errorf("%s is not a valid tree-ish in %s: %w", treeish, repoDir, err)
+	}
+	listing, err := runGit(ctx, repoDir, "ls-tree", "-r", "-t", "-l", "-z", treeish)
+	if err != nil {
+		return nil, err
+	}
+
+	gfs := &gitTreeFS{
+		ctx:      ctx,
+		repoDir:  repoDir,
+		treeish:  treeish,
+		entries:  map[string]gitTreeEntry{".": {name: ".", isDir: true}},
+		children: make(map[string][]string),
+	}
+	for _, record := range strings.Split(string(listing), "\x00") {
+		// <mode> SP <type> SP <object> SP <size>\t<path>
+		meta, p, found := strings.Cut(record, "\t")
+		if !found {
+			continue
+		}
+		fields := strings.Fields(meta)
+		if len(fields) != 4 {
+			continue
+		}
+		objType, object := fields[1], fields[2]
+		if objType == "commit" {
+			continue // Submodule; its content is not part of this repository
+		}
+		entry := gitTreeEntry{name: path.Base(p), isDir: objType == "tree", object: object}
+		if !entry.isDir {
+			entry.size, _ = strconv.ParseInt(fields[3], 10, 64)
+		}
+		gfs.entries[p] = entry
+		gfs.children[path.Dir(p)] = append(gfs.children[path.Dir(p)], p)
+	}
+	for dir := range gfs.children {
+		sort.Strings(gfs.children[dir])
+	}
+	return gfs, nil
+}
+
+func (g *gitTreeFS) lookup(op, name string) (gitTreeEntry, error) {
+	if !fs.ValidPath(name) {
+		return gitTreeEntry{}, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	entry, ok := g.entries[name]
+	if !ok {
+		return gitTreeEntry{}, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	return entry, nil
+}
+
+// ReadDir implements fs.ReadDirFS.
+func (g *gitTreeFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entry, err := g.lookup("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if !entry.isDir {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fmt.Errorf("not a directory")}
+	}
+	children := g.children[name]
+	result := make([]fs.DirEntry, 0, len(children))
+	for _, child := range children {
+		result = append(result, gitDirEntry(g.entries[child]))
+	}
+	return result, nil
+}
+
+// ReadFile implements fs.ReadFileFS.
+func (g *gitTreeFS) ReadFile(name string) ([]byte, error) {
+	entry, err := g.lookup("read", name)
+	if err != nil {
+		return nil, err
+	}
+	if entry.isDir {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: fmt.Errorf("is a directory")}
+	}
+	data, err := g.readBlob(entry.object)
+	if err != nil {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: err}
+	}
+	return data, nil
+}
+
+// readBlob reads an object from the cat-file process, starting it on first use.
+func (g *gitTreeFS) readBlob(object string) ([]byte, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if err := g.ctx.Err(); err != nil {
+		return nil, err
+	}
+	if g.batch == nil {
+		cmd := exec.CommandContext(g.ctx, "git", "-C", g.repoDir, "cat-file", "--batch")
+		stdin, err := cmd.StdinPipe()
+		if err != nil {
+			return nil, err
+		}
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			return nil, err
+		}
+		if err := cmd.Start(); err != nil {
+			return nil, fmt.Errorf("git cat-file --batch: %w", err)
+		}
+		g.batch, g.stdin, g.stdout = cmd, stdin, bufio.NewReader(stdout)
+	}
+
+	if _, err := io.WriteString(g.stdin, object+"\n"); err != nil {
+		return nil, g.batchFailed(err)
+	}
+	// <object> SP <type> SP <size> LF <contents> LF, or <object> SP missing LF
+	header, err := g.stdout.ReadString('\n')
+	if err != nil {
+		return nil, g.batchFailed(err)
+	}
+	fields := strings.Fields(header)
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("git cat-file: %s", strings.TrimSpace(header))
+	}
+	size, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return nil, g.batchFailed(fmt.Errorf("unexpected header %q", strings.TrimSpace(header)))
+	}
+	data := make([]byte, size+1)
+	if _, err := io.ReadFull(g.stdout, data); err != nil {
+		return nil, g.batchFailed(err)
+	}
+	return data[:size], nil
+}
+
+// batchFailed stops a cat-file process that can no longer be read in step, so
+// the next read starts a new one.
+func (g *gitTreeFS) batchFailed(err error) error {
+	g.closeBatch()
+	if ctxErr := g.ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	return fmt.Errorf("git cat-file --batch: %w", err)
+}
+
+func (g *gitTreeFS) closeBatch() {
+	if g.batch == nil {
+		return
+	}
+	g.stdin.Close()
+	g.batch.Wait()
+	g.batch, g.stdin, g.stdout = nil, nil, nil
+}
+
+// Close stops the cat-file process, if one was started.
+func (g *gitTreeFS) Close() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.closeBatch()
+	return nil
+}
+
+// Open implements fs.FS.
+func (g *gitTreeFS) Open(name string) (fs.File, error) {
+	entry, err := g.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+	f := &gitTreeFile{entry: entry}
+	if entry.isDir {
+		f.dirEntries, _ = g.ReadDir(name)
+		return f, nil
+	}
+	data, err := g.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	f.reader = bytes.NewReader(data)
+	return f, nil
+}
+
+// gitDirEntry adapts a tree entry to fs.DirEntry and fs.FileInfo.
+type gitDirEntry gitTreeEntry
+
+func (e gitDirEntry) Name() string               { return e.name }
+func (e gitDirEntry) IsDir() bool                { return e.isDir }
+func (e gitDirEntry) Type() fs.FileMode          { return e.Mode().Type() }
+func (e gitDirEntry) Info() (fs.FileInfo, error) { return e, nil }
+func (e gitDirEntry) Size() int64                { return e.size }
+func (e gitDirEntry) ModTime() time.Time         { return time.Time{} }
+func (e gitDirEntry) Sys() any                   { return nil }
+func (e gitDirEntry) Mode() fs.FileMode {
+	if e.isDir {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
+
+// gitTreeFile is an opened file or directory of a gitTreeFS.
+type gitTreeFile struct {
+	entry      gitTreeEntry
+	reader     *bytes.Reader
+	dirEntries []fs.DirEntry
+}
+
+func (f *gitTreeFile) Stat() (fs.FileInfo, error) { return gitDirEntry(f.entry), nil }
+func (f *gitTreeFile) Close() error               { return nil }
+
+func (f *gitTreeFile) Read(b []byte) (int, error) {
+	if f.reader == nil {
+		return 0, &fs.PathError{Op: "read", Path: f.entry.name, Err: fmt.Errorf("is a directory")}
+	}
+	return f.reader.Read(b)
+}
+
+// ReadDir implements fs.ReadDirFile.
+func (f *gitTreeFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	if n <= 0 {
+		entries := f.dirEntries
+		f.dirEntries = nil
+		return entries, nil
+	}
+	if len(f.dirEntries) == 0 {
+		return nil, io.EOF
+	}
+	n = min(n, len(f.dirEntries))
+	entries := f.dirEntries[:n]
+	f.dirEntries = f.dirEntries[n:]
+	return entries, nil
+}
+
+// RequestGitTreeContextGeneration generates context for a commit, tag or branch
+// of the repository at repoDir, reading files from git instead of the working
+// tree. The output uses the same tree and <file> format as the regular context.
+func (a *App) RequestGitTreeContextGeneration(repoDir string, treeish string, excludedPaths []string, opts ContextGenerationOptions) {
+	if a.contextGenerator == nil {
+		runtime.LogError(a.ctx, "ContextGenerator not initialized")
+		runtime.EventsEmit(a.ctx, "shotgunContextError", "Internal error: ContextGenerator not initialized")
+		return
+	}
+	treeish = strings.TrimSpace(treeish)
+	if treeish == "" {
+		treeish = "HEAD"
+	}
+
+	label := fmt.Sprintf("%s@%s", repoDir, treeish)
+	archiveEntry := &ContextArchiveEntry{Roots: []string{repoDir}, Treeish: treeish, ExcludedPaths: excludedPaths, Options: opts}
+	a.contextGenerator.requestShotgunContextGenerationInternal(label, archiveEntry, func(jobCtx context.Context) (string, error) {
+		gfs, err := newGitTreeFS(jobCtx, repoDir, treeish)
+		if err != nil {
+			return "", err
+		}
+		defer gfs.Close()
+		return a.generateContextOutput(jobCtx, []*contextRoot{a.gitTreeContextRoot(gfs, excludedPaths)}, opts)
+	})
+}
+
+// gitTreeContextRoot returns the context root of a tree-ish, ignoring paths
+// like the working tree does. The .gitignore is the one in the tree-ish, so
+// force-added files it matches are hidden as they are in the working tree.
+func (a *App) gitTreeContextRoot(gfs *gitTreeFS, excludedPaths []string) *contextRoot {
+	root := &contextRoot{
+		dir:      gfs.repoDir,
+		label:    filepath.Base(gfs.repoDir) + "@" + gfs.treeish + "/",
+		excluded: make(map[string]bool),
+		fsys:     gfs,
+	}
+	for _, p := range excludedPaths {
+		root.excluded[filepath.Clean(p)] = true
+	}
+	if a.useGitignore {
+		if data, err := gfs.ReadFile(".gitignore"); err == nil {
+			lines := strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+			root.ignores = append(root.ignores, gitignore.CompileIgnoreLines(lines...))
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			runtime.LogWarningf(a.ctx, "Error reading .gitignore of %s: %v", gfs.treeish, err)
+		}
+	}
+	if a.useCustomIgnore && a.currentCustomIgnorePatterns != nil {
+		root.ignores = append(root.ignores, a.currentCustomIgnorePatterns)
+	}
+	return root
+}
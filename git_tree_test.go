@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// testGitRepo commits files to a new repository and returns its directory.
+// The test is skipped when git is not installed.
+func testGitRepo(t *testing.T, files map[string]string) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := filepath.Join(t.TempDir(), "repo")
+	writeTestFiles(t, dir, files)
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"add", "-A", "-f"},
+		{"-c", "user.name=Test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "initial"},
+	} {
+		if out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput(); err != nil {
+			t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+		}
+	}
+	return dir
+}
+
+func TestGitTreeFS(t *testing.T) {
+	repo := testGitRepo(t, map[string]string{
+		".gitignore":    "*.log\n",
+		"a.txt":         "committed\n",
+		"debug.log":     "force-added\n",
+		"sub/b.txt":     "b",
+		"sub/deep/c.go": "package deep\n",
+		"empty.txt":     "",
+	})
+	// The working tree must not be read
+	writeTestFiles(t, repo, map[string]string{"a.txt": "edited\n", "untracked.txt": "x"})
+
+	gfs, err := newGitTreeFS(context.Background(), repo, "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gfs.Close()
+
+	var paths []string
+	if err := fs.WalkDir(gfs, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		paths = append(paths, p)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{".", ".gitignore", "a.txt", "debug.log", "empty.txt", "sub", "sub/b.txt", "sub/deep", "sub/deep/c.go"}
+	if !reflect.DeepEqual(paths, want) {
+		t.Errorf("tree = %v, want %v", paths, want)
+	}
+
+	// Reads go through one cat-file process, in any order and more than once
+	for _, tt := range []struct{ name, want string }{
+		{"sub/deep/c.go", "package deep\n"},
+		{"a.txt", "committed\n"},
+		{"empty.txt", ""},
+		{"a.txt", "committed\n"},
+	} {
+		data, err := gfs.ReadFile(tt.name)
+		if err != nil || string(data) != tt.want {
+			t.Errorf("ReadFile(%s) = %q, %v; want %q", tt.name, data, err, tt.want)
+		}
+	}
+	if info, err := fs.Stat(gfs, "sub/b.txt"); err != nil || info.Size() != 1 || info.IsDir() {
+		t.Errorf("stat sub/b.txt = %v, %v", info, err)
+	}
+	if _, err := gfs.ReadFile("untracked.txt"); !os.IsNotExist(err) {
+		t.Errorf("untracked file: err = %v, want not exist", err)
+	}
+	if _, err := gfs.ReadFile("sub"); err == nil {
+		t.Error("a directory was read as a file")
+	}
+	if _, err := gfs.readBlob(strings.Repeat("0", 40)); err == nil {
+		t.Error("a missing object was read")
+	}
+	if data, err := gfs.ReadFile("sub/b.txt"); err != nil || string(data) != "b" {
+		t.Errorf("read after a missing object = %q, %v", data, err)
+	}
+
+	if err := fstest.TestFS(gfs, ".gitignore", "a.txt", "debug.log", "empty.txt", "sub/b.txt", "sub/deep/c.go"); err != nil {
+		t.Error(err)
+	}
+
+	if _, err := newGitTreeFS(context.Background(), repo, "no-such-branch"); err == nil {
+		t.Error("an unknown tree-ish was accepted")
+	}
+	if _, err := newGitTreeFS(context.Background(), repo, "--output=x"); err == nil {
+		t.Error("an option was accepted as a tree-ish")
+	}
+}
+
+func TestGitTreeContextIgnores(t *testing.T) {
+	repo := testGitRepo(t, map[string]string{
+		".gitignore": "*.log\n",
+		"a.txt":      "a",
+		"debug.log":  "force-added",
+	})
+	gfs, err := newGitTreeFS(context.Background(), repo, "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gfs.Close()
+
+	for _, tt := range []struct {
+		useGitignore bool
+		want         []string
+	}{
+		{useGitignore: true, want: []string{".gitignore", "a.txt"}},
+		{useGitignore: false, want: []string{".gitignore", "a.txt", "debug.log"}},
+	} {
+		a := &App{useGitignore: tt.useGitignore}
+		out, err := a.generateContextOutput(context.Background(), []*contextRoot{a.gitTreeContextRoot(gfs, nil)}, ContextGenerationOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var paths []string
+		for _, f := range parseContextFiles(out) {
+			paths = append(paths, f.Path)
+		}
+		if !reflect.DeepEqual(paths, tt.want) {
+			t.Errorf("gitignore %v: files = %v, want %v", tt.useGitignore, paths, tt.want)
+		}
+		if !strings.HasPrefix(out, "repo@HEAD/\n") {
+			t.Errorf("context starts with %q, want the tree-ish label", strings.SplitN(out, "\n", 2)[0])
+		}
+	}
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	gitignore "github.com/sabhiram/go-gitignore"
+)
+
+// --- Ignore rule validation and dry-run preview ---
+
+// Severities of IgnoreRuleIssue.
+const (
+	IgnoreIssueError   = "error"   // The rule is dropped or cannot work as written
+	IgnoreIssueWarning = "warning" // The rule works, but probably not as intended
+	IgnoreIssueInfo    = "info"    // The rule has no effect in the previewed root
+)
+
+// maxIgnorePreviewPaths caps the path lists of a preview; counts stay exact.
+const maxIgnorePreviewPaths = 500
+
+// IgnoreRuleIssue is a problem found in one line of the rules.
+type IgnoreRuleIssue struct {
+	Line     int    `json:"line"` // 1-based
+	Rule     string `json:"rule"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+// IgnoreRuleStats reports how one rule behaves on the previewed root.
+type IgnoreRuleStats struct {
+	Line    int    `json:"line"`
+	Rule    string `json:"rule"`
+	Matches int    `json:"matches"` // Visited paths the rule matches
+	Decides int    `json:"decides"` // Paths whose final ignore state comes from this rule
+}
+
+// IgnoreRulesPreview is the dry-run result of PreviewIgnoreRules. Directories
+// that change state are listed with a trailing slash, followed by the paths
+// inside them that change state too. When custom ignore rules are disabled,
+// CustomIgnoreEnabled is false, Rules still describes the proposed rules, and
+// nothing is newly hidden or shown.
+type IgnoreRulesPreview struct {
+	Issues              []IgnoreRuleIssue `json:"issues"`
+	Rules               []IgnoreRuleStats `json:"rules"`
+	CustomIgnoreEnabled bool              `json:"customIgnoreEnabled"`
+	NewlyHidden         []string          `json:"newlyHidden"`
+	NewlyShown          []string          `json:"newlyShown"`
+	NewlyHiddenCount    int               `json:"newlyHiddenCount"`
+	NewlyShownCount     int               `json:"newlyShownCount"`
+}
+
+// ignoreRule is one effective line of a rules text, compiled on its own.
+type ignoreRule struct {
+	line    int
+	text    string
+	negate  bool
+	matcher *gitignore.GitIgnore // Compiled without the "!" so it matches on its own
+}
+
+var (
+	ignoreRegexMetaRegex  = regexp.MustCompile(`[+{}|^$()]`)
+	ignoreBackslashRegex  = regexp.MustCompile(`\\[^#!* ]`)
+	ignoreMatchAllPattern = map[string]bool{"*": true, "**": true, "/": true, "/*": true, "/**": true, "**/*": true}
+)
+
+func splitIgnoreRules(rules string) []string {
+	return strings.Split(strings.ReplaceAll(rules, "\r\n", "\n"), "\n")
+}
+
+// unbalanced reports whether open and close characters are unbalanced, ignoring escaped ones.
+func unbalanced(s string, open, close byte) bool {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\':
+			i++
+		case s[i] == open:
+			depth++
+		case s[i] == close:
+			depth--
+			if depth < 0 {
+				return true
+			}
+		}
+	}
+	return depth != 0
+}
+
+// validateIgnoreRules checks rules line by line without touching the file system.
+// The checks follow how go-gitignore turns each line into a regular expression.
+func validateIgnoreRules(rules string) ([]IgnoreRuleIssue, []ignoreRule) {
+	issues := []IgnoreRuleIssue{}
+	var compiled []ignoreRule
+	seen := make(map[string]int)
+	positiveSeen := false
+
+	for i, raw := range splitIgnoreRules(rules) {
+		lineNo := i + 1
+		issue := func(severity, format string, args ...any) {
+			issues = append(issues, IgnoreRuleIssue{Line: lineNo, Rule: raw, Severity: severity, Message: fmt.Sprintf(format, args...)})
+		}
+		if strings.HasPrefix(raw, "#") || strings.TrimSpace(raw) == "" {
+			continue
+		}
+		if strings.HasSuffix(raw, " ") && !strings.HasSuffix(raw, `\ `) {
+			issue(IgnoreIssueWarning, "trailing spaces are ignored")
+		}
+		if strings.HasPrefix(raw, " ") {
+			issue(IgnoreIssueWarning, "leading spaces are ignored")
+		}
+
+		text := strings.TrimSpace(raw)
+		negate := strings.HasPrefix(text, "!")
+		pattern := strings.TrimPrefix(text, "!")
+		if pattern == "" {
+			issue(IgnoreIssueError, "negation without a pattern")
+			continue
+		}
+		if unbalanced(pattern, '[', ']') || unbalanced(pattern, '(', ')') {
+			issue(IgnoreIssueError, "unbalanced brackets; the matcher drops this rule")
+			continue
+		}
+		if first, dup := seen[text]; dup {
+			issue(IgnoreIssueWarning, "duplicate of line %d", first)
+		} else {
+			seen[text] = lineNo
+		}
+		if ignoreRegexMetaRegex.MatchString(pattern) {
+			issue(IgnoreIssueWarning, "contains %q, which the matcher treats as a regular expression operator", ignoreRegexMetaRegex.FindString(pattern))
+		}
+		if strings.Contains(pattern, "?") {
+			issue(IgnoreIssueWarning, "'?' is matched literally, not as a single-character wildcard")
+		}
+		if ignoreBackslashRegex.MatchString(pattern) {
+			issue(IgnoreIssueWarning, "backslash is not a path separator; use '/'")
+		}
+		if !negate && ignoreMatchAllPattern[pattern] {
+			issue(IgnoreIssueWarning, "matches every path in the project")
+		}
+		if negate && !positiveSeen {
+			issue(IgnoreIssueWarning, "negation before any ignore rule has no effect")
+		}
+		positiveSeen = positiveSeen || !negate
+
+		compiled = append(compiled, ignoreRule{line: lineNo, text: raw, negate: negate, matcher: gitignore.CompileIgnoreLines(pattern)})
+	}
+	return issues, compiled
+}
+
+// ValidateIgnoreRules returns the problems found in a rules text, without saving it.
+func (a *App) ValidateIgnoreRules(rules string) []IgnoreRuleIssue {
+	issues, _ := validateIgnoreRules(rules)
+	return issues
+}
+
+// PreviewIgnoreRules is a dry run of saving rules as the custom ignore rules:
+// it reports the validation issues, how many paths under rootDir each rule
+// matches, and which paths would newly be hidden or shown. The project's
+// .gitignore is applied to both sides when it is enabled; the current and the
+// proposed custom rules only when custom ignores are enabled.
+func (a *App) PreviewIgnoreRules(rootDir string, rules string) (*IgnoreRulesPreview, error) {
+	info, err := os.Stat(rootDir)
+	if err != nil {
+		return nil, fmt.Errorf("cannot preview ignore rules: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("cannot preview ignore rules: %s is not a directory", rootDir)
+	}
+
+	issues, compiled := validateIgnoreRules(rules)
+	var gitIgn *gitignore.GitIgnore
+	if a.useGitignore {
+		if ign, err := gitignore.CompileIgnoreFile(filepath.Join(rootDir, ".gitignore")); err == nil {
+			gitIgn = ign
+		}
+	}
+	var oldCustom *gitignore.GitIgnore
+	if a.useCustomIgnore {
+		oldCustom = gitignore.CompileIgnoreLines(splitIgnoreRules(a.settings.CustomIgnoreRules)...)
+	}
+	return previewIgnoreRules(rootDir, issues, compiled, gitIgn, oldCustom, a.useCustomIgnore)
+}
+
+// previewIgnoreRules does the work of PreviewIgnoreRules. gitIgn and oldCustom
+// may be nil; the proposed rules only hide paths when customEnabled is set.
+func previewIgnoreRules(rootDir string, issues []IgnoreRuleIssue, compiled []ignoreRule, gitIgn, oldCustom *gitignore.GitIgnore, customEnabled bool) (*IgnoreRulesPreview, error) {
+	preview := &IgnoreRulesPreview{Issues: issues, Rules: make([]IgnoreRuleStats, len(compiled)), CustomIgnoreEnabled: customEnabled, NewlyHidden: []string{}, NewlyShown: []string{}}
+	for i, r := range compiled {
+		preview.Rules[i] = IgnoreRuleStats{Line: r.line, Rule: r.text}
+	}
+
+	// newState evaluates the proposed rules in order, like GitIgnore.MatchesPath,
+	// while recording which rules match and which one decides.
+	newState := func(pathToMatch string) bool {
+		ignored, decider := false, -1
+		for i, r := range compiled {
+			if !r.matcher.MatchesPath(pathToMatch) {
+				continue
+			}
+			preview.Rules[i].Matches++
+			if !r.negate {
+				ignored, decider = true, i
+			} else if ignored {
+				ignored, decider = false, i
+			}
+		}
+		if decider >= 0 {
+			preview.Rules[decider].Decides++
+		}
+		return ignored
+	}
+	record := func(list *[]string, count *int, relPath string) {
+		*count++
+		if len(*list) < maxIgnorePreviewPaths {
+			*list = append(*list, filepath.ToSlash(relPath))
+		}
+	}
+
+	// dirStates holds the before and after state of each visited directory;
+	// paths inside a hidden directory are hidden too.
+	type hiddenState struct{ was, is bool }
+	dirStates := make(map[string]hiddenState)
+
+	err := filepath.WalkDir(rootDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || p == rootDir {
+			return nil
+		}
+		if d.IsDir() && d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		relPath, _ := filepath.Rel(rootDir, p)
+		pathToMatch, listed := relPath, relPath
+		if d.IsDir() {
+			pathToMatch += string(os.PathSeparator)
+			listed += "/"
+		}
+		parent := dirStates[filepath.Dir(relPath)]
+		gitIgnored := gitIgn != nil && gitIgn.MatchesPath(pathToMatch)
+		wasHidden := parent.was || gitIgnored || (oldCustom != nil && oldCustom.MatchesPath(pathToMatch))
+		isHidden := newState(pathToMatch) && customEnabled
+		isHidden = isHidden || parent.is || gitIgnored
+
+		switch {
+		case !wasHidden && isHidden:
+			record(&preview.NewlyHidden, &preview.NewlyHiddenCount, listed)
+		case wasHidden && !isHidden:
+			record(&preview.NewlyShown, &preview.NewlyShownCount, listed)
+		}
+		if d.IsDir() {
+			// Directories hidden on both sides are not descended into, as in the file tree.
+			if wasHidden && isHidden {
+				return filepath.SkipDir
+			}
+			dirStates[relPath] = hiddenState{was: wasHidden, is: isHidden}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan %s: %w", rootDir, err)
+	}
+
+	for _, s := range preview.Rules {
+		switch {
+		case s.Matches == 0:
+			preview.Issues = append(preview.Issues, IgnoreRuleIssue{Line: s.Line, Rule: s.Rule, Severity: IgnoreIssueInfo, Message: "matches nothing in this project"})
+		case s.Decides == 0:
+			preview.Issues = append(preview.Issues, IgnoreRuleIssue{Line: s.Line, Rule: s.Rule, Severity: IgnoreIssueWarning, Message: "shadowed: every path it matches is decided by another rule"})
+		}
+	}
+	sort.SliceStable(preview.Issues, func(i, j int) bool { return preview.Issues[i].Line < preview.Issues[j].Line })
+	return preview, nil
+}
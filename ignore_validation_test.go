@@ -0,0 +1,94 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	gitignore "github.com/sabhiram/go-gitignore"
+)
+
+func TestValidateIgnoreRules(t *testing.T) {
+	tests := []struct {
+		name     string
+		rules    string
+		lines    []int
+		severity []string
+		compiled int // Rules kept for the preview
+	}{
+		{name: "clean", rules: "# comment\n\nnode_modules/\n*.log\n!keep.log\n", compiled: 3},
+		{name: "negation without a pattern", rules: "*.log\n!\n", lines: []int{2}, severity: []string{IgnoreIssueError}, compiled: 1},
+		{name: "unbalanced brackets", rules: "file[ab.txt\n", lines: []int{1}, severity: []string{IgnoreIssueError}},
+		{name: "duplicate", rules: "*.log\n*.log\n", lines: []int{2}, severity: []string{IgnoreIssueWarning}, compiled: 2},
+		{name: "trailing space", rules: "*.log \n", lines: []int{1}, severity: []string{IgnoreIssueWarning}, compiled: 1},
+		{name: "regex operator", rules: "a+b\n", lines: []int{1}, severity: []string{IgnoreIssueWarning}, compiled: 1},
+		{name: "question mark", rules: "a?.txt\n", lines: []int{1}, severity: []string{IgnoreIssueWarning}, compiled: 1},
+		{name: "backslash", rules: `dir\sub` + "\n", lines: []int{1}, severity: []string{IgnoreIssueWarning}, compiled: 1},
+		{name: "matches everything", rules: "*\n", lines: []int{1}, severity: []string{IgnoreIssueWarning}, compiled: 1},
+		{name: "negation first", rules: "!keep.log\n*.log\n", lines: []int{1}, severity: []string{IgnoreIssueWarning}, compiled: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issues, compiled := validateIgnoreRules(tt.rules)
+			var lines []int
+			var severity []string
+			for _, issue := range issues {
+				lines = append(lines, issue.Line)
+				severity = append(severity, issue.Severity)
+			}
+			if !reflect.DeepEqual(lines, tt.lines) || !reflect.DeepEqual(severity, tt.severity) {
+				t.Errorf("issues = %+v, want lines %v with severities %v", issues, tt.lines, tt.severity)
+			}
+			if len(compiled) != tt.compiled {
+				t.Errorf("compiled %d rules, want %d", len(compiled), tt.compiled)
+			}
+		})
+	}
+}
+
+func TestPreviewIgnoreRules(t *testing.T) {
+	root := t.TempDir()
+	writeTestFiles(t, root, map[string]string{
+		"build/keep.txt":  "",
+		"build/out.bin":   "",
+		"docs/readme.md":  "",
+		"logs/x.log":      "",
+		"src/a.go":        "",
+		"src/vendored.go": "",
+		".gitignore":      "src/vendored.go\n",
+	})
+	gitIgn := gitignore.CompileIgnoreLines("src/vendored.go")
+	oldCustom := gitignore.CompileIgnoreLines("build/", "*.log")
+	issues, compiled := validateIgnoreRules("*.log\ndocs/\n*.tmp\n")
+
+	t.Run("enabled", func(t *testing.T) {
+		preview, err := previewIgnoreRules(root, issues, compiled, gitIgn, oldCustom, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []string{"docs/", "docs/readme.md"}; !reflect.DeepEqual(preview.NewlyHidden, want) || preview.NewlyHiddenCount != len(want) {
+			t.Errorf("newly hidden = %v (%d), want %v", preview.NewlyHidden, preview.NewlyHiddenCount, want)
+		}
+		if want := []string{"build/", "build/keep.txt", "build/out.bin"}; !reflect.DeepEqual(preview.NewlyShown, want) || preview.NewlyShownCount != len(want) {
+			t.Errorf("newly shown = %v (%d), want %v", preview.NewlyShown, preview.NewlyShownCount, want)
+		}
+		if got := []int{preview.Rules[0].Matches, preview.Rules[1].Matches, preview.Rules[2].Matches}; got[0] == 0 || got[1] == 0 || got[2] != 0 {
+			t.Errorf("rule matches = %v, want the first two to match and the last not", got)
+		}
+		if len(preview.Issues) != 1 || preview.Issues[0].Line != 3 || preview.Issues[0].Severity != IgnoreIssueInfo {
+			t.Errorf("issues = %+v, want one info issue for line 3", preview.Issues)
+		}
+	})
+
+	t.Run("custom ignores disabled", func(t *testing.T) {
+		preview, err := previewIgnoreRules(root, issues, compiled, gitIgn, nil, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if preview.CustomIgnoreEnabled || len(preview.NewlyHidden) != 0 || len(preview.NewlyShown) != 0 {
+			t.Errorf("preview = %+v, want custom ignores flagged as disabled and no changes", preview)
+		}
+		if preview.Rules[1].Matches == 0 {
+			t.Errorf("rule %q matches nothing, want its matches reported", preview.Rules[1].Rule)
+		}
+	})
+}
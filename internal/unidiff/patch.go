@@ -0,0 +1,480 @@
+// Package unidiff parses and renders unified diffs as written by git and
+// diff -u, keeping enough of the original text to reproduce it exactly.
+package unidiff
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Kinds of HunkLine.
+const (
+	HunkLineContext   = ' '
+	HunkLineDelete    = '-'
+	HunkLineAdd       = '+'
+	HunkLineNoNewline = '\\' // "\ No newline at end of file" after the preceding line
+)
+
+const defaultFileMode = "100644"
+
+// HunkLine is one body line of a hunk.
+type HunkLine struct {
+	Kind byte
+	Text string // Content without the kind prefix and without the line terminator
+	bare bool   // Context line written as an empty line, without the leading space
+}
+
+// Hunk is one "@@ -a,b +c,d @@" section of a file diff.
+type Hunk struct {
+	OldStart, OldLines int
+	NewStart, NewLines int
+	Section            string // Raw text after the closing "@@", usually " funcName(...)"
+	Lines              []HunkLine
+	Trailer            []string // Raw lines after the body that belong to no hunk (blank lines, prose)
+
+	header       string // Raw header line, reused while the ranges are unchanged
+	parsedRanges [4]int
+}
+
+// FilePatch is the diff of one file.
+type FilePatch struct {
+	// Header holds the raw lines from "diff --git" (or "---") up to the first
+	// hunk. It is reproduced verbatim; set it to nil to have it synthesized
+	// from the fields below after changing them.
+	Header           []string
+	OldPath, NewPath string // Without the a/ and b/ prefixes; empty for /dev/null
+	OldMode, NewMode string
+	IsNew, IsDeleted bool
+	IsRename, IsCopy bool
+	IsBinary         bool
+	Hunks            []*Hunk
+}
+
+// Patch is a parsed unified diff. String() reproduces the parsed text exactly.
+type Patch struct {
+	Preamble       []string // Raw lines before the first file diff
+	Files          []*FilePatch
+	NoFinalNewline bool // The text did not end with a newline
+}
+
+var hunkHeaderRegex = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@(.*)$`)
+
+// IsHunkHeader reports whether line is a well-formed "@@ -a,b +c,d @@" header.
+func IsHunkHeader(line string) bool {
+	return hunkHeaderRegex.MatchString(line)
+}
+
+// FormatRange renders one side of a hunk header the way git does.
+func FormatRange(start, count int) string {
+	if count == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+// Parse parses a unified diff strictly: every hunk must contain exactly
+// the number of lines its header announces.
+func Parse(text string) (*Patch, error) {
+	return parsePatch(text, false)
+}
+
+// ParseLenient parses a unified diff reading hunk bodies by line prefix,
+// without trusting the header counts. It suits diffs written by hand or by a
+// model.
+func ParseLenient(text string) (*Patch, error) {
+	return parsePatch(text, true)
+}
+
+// parsePatch parses a unified diff, leniently or not.
+func parsePatch(text string, lenient bool) (*Patch, error) {
+	p := &Patch{}
+	if text == "" {
+		return p, nil
+	}
+	lines := strings.Split(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	} else {
+		p.NoFinalNewline = true
+	}
+
+	i := 0
+	for i < len(lines) && !IsFileStart(lines, i) {
+		p.Preamble = append(p.Preamble, lines[i])
+		i++
+	}
+	for i < len(lines) {
+		f := &FilePatch{}
+		i = f.parseHeader(lines, i)
+		for i < len(lines) && strings.HasPrefix(lines[i], "@@ ") {
+			h, next, err := parseHunk(lines, i, lenient)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", f.Path(), err)
+			}
+			i = next
+			for i < len(lines) && !strings.HasPrefix(lines[i], "@@ ") && !IsFileStart(lines, i) {
+				h.Trailer = append(h.Trailer, lines[i])
+				i++
+			}
+			f.Hunks = append(f.Hunks, h)
+		}
+		p.Files = append(p.Files, f)
+	}
+	return p, nil
+}
+
+// IsFileStart reports whether a file diff starts at lines[i]: a git header, or
+// a bare "---"/"+++" pair as written by diff -u.
+func IsFileStart(lines []string, i int) bool {
+	if strings.HasPrefix(lines[i], "diff --git ") {
+		return true
+	}
+	return strings.HasPrefix(lines[i], "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ ")
+}
+
+// parseHeader consumes the header lines of a file diff starting at lines[i]
+// and returns the index of the first line after them.
+func (f *FilePatch) parseHeader(lines []string, i int) int {
+	start := i
+	gitHeader := strings.HasPrefix(lines[i], "diff --git ")
+	sawNewFileLine := false
+	if gitHeader {
+		f.OldPath, f.NewPath = ParseGitHeaderPaths(strings.TrimPrefix(lines[i], "diff --git "))
+		i++
+	}
+headerLoop:
+	for ; i < len(lines); i++ {
+		line := strings.TrimSuffix(lines[i], "\r")
+		if strings.HasPrefix(line, "@@ ") || strings.HasPrefix(line, "diff --git ") {
+			break
+		}
+		if sawNewFileLine && IsFileStart(lines, i) {
+			break // Next plain diff -u file
+		}
+		switch {
+		case strings.HasPrefix(line, "--- "):
+			f.OldPath = ParsePath(line[4:], "a/")
+			f.IsNew = f.IsNew || f.OldPath == ""
+		case strings.HasPrefix(line, "+++ "):
+			f.NewPath = ParsePath(line[4:], "b/")
+			f.IsDeleted = f.IsDeleted || f.NewPath == ""
+			sawNewFileLine = true
+			if !gitHeader {
+				i++
+				break headerLoop
+			}
+		case strings.HasPrefix(line, "new file mode "):
+			f.IsNew, f.NewMode = true, strings.TrimPrefix(line, "new file mode ")
+		case strings.HasPrefix(line, "deleted file mode "):
+			f.IsDeleted, f.OldMode = true, strings.TrimPrefix(line, "deleted file mode ")
+		case strings.HasPrefix(line, "old mode "):
+			f.OldMode = strings.TrimPrefix(line, "old mode ")
+		case strings.HasPrefix(line, "new mode "):
+			f.NewMode = strings.TrimPrefix(line, "new mode ")
+		case strings.HasPrefix(line, "rename from "):
+			f.IsRename, f.OldPath = true, unquotePatchPath(strings.TrimPrefix(line, "rename from "))
+		case strings.HasPrefix(line, "rename to "):
+			f.IsRename, f.NewPath = true, unquotePatchPath(strings.TrimPrefix(line, "rename to "))
+		case strings.HasPrefix(line, "copy from "):
+			f.IsCopy, f.OldPath = true, unquotePatchPath(strings.TrimPrefix(line, "copy from "))
+		case strings.HasPrefix(line, "copy to "):
+			f.IsCopy, f.NewPath = true, unquotePatchPath(strings.TrimPrefix(line, "copy to "))
+		case strings.HasPrefix(line, "Binary files "), line == "GIT binary patch":
+			f.IsBinary = true
+		}
+	}
+	f.Header = append([]string(nil), lines[start:i]...)
+	if f.IsNew {
+		f.OldPath = ""
+	}
+	if f.IsDeleted {
+		f.NewPath = ""
+	}
+	return i
+}
+
+// ParseGitHeaderPaths splits the "a/x b/y" part of a "diff --git" line. Paths
+// with spaces are ambiguous there; the common case of equal paths is resolved
+// and the ---/+++ or rename lines override the result when present.
+func ParseGitHeaderPaths(rest string) (oldPath, newPath string) {
+	rest = strings.TrimSuffix(rest, "\r")
+	if strings.HasPrefix(rest, `"`) {
+		if unquoted, tail, err := cutQuoted(rest); err == nil {
+			return strings.TrimPrefix(unquoted, "a/"), strings.TrimPrefix(unquotePatchPath(strings.TrimSpace(tail)), "b/")
+		}
+	}
+	if n := len(rest); n%2 == 1 && strings.HasPrefix(rest, "a/") {
+		half := n / 2
+		if rest[half] == ' ' && strings.HasPrefix(rest[half+1:], "b/") && rest[2:half] == rest[half+3:] {
+			return rest[2:half], rest[half+3:]
+		}
+	}
+	if before, after, found := strings.Cut(rest, " b/"); found {
+		return strings.TrimPrefix(before, "a/"), after
+	}
+	return rest, rest
+}
+
+// ParsePath extracts the path of a ---/+++ line, dropping the timestamp,
+// the a/ or b/ prefix and quoting. /dev/null becomes "".
+func ParsePath(value, prefix string) string {
+	value = strings.TrimSuffix(value, "\r")
+	if !strings.HasPrefix(value, `"`) {
+		if tab := strings.IndexByte(value, '\t'); tab >= 0 {
+			value = value[:tab]
+		}
+	}
+	value = unquotePatchPath(strings.TrimRight(value, " "))
+	if value == "/dev/null" {
+		return ""
+	}
+	return strings.TrimPrefix(value, prefix)
+}
+
+func unquotePatchPath(s string) string {
+	if strings.HasPrefix(s, `"`) {
+		if unquoted, _, err := cutQuoted(s); err == nil {
+			return unquoted
+		}
+	}
+	return s
+}
+
+// cutQuoted unquotes the C-style quoted string git writes for unusual paths
+// and returns the text after it.
+func cutQuoted(s string) (unquoted, rest string, err error) {
+	prefix, err := strconv.QuotedPrefix(s)
+	if err != nil {
+		return "", s, err
+	}
+	unquoted, err = strconv.Unquote(prefix)
+	return unquoted, s[len(prefix):], err
+}
+
+// parseHunk reads the hunk whose header is lines[i] and returns it with the
+// index of the first line after its body.
+func parseHunk(lines []string, i int, lenient bool) (*Hunk, int, error) {
+	m := hunkHeaderRegex.FindStringSubmatch(strings.TrimSuffix(lines[i], "\r"))
+	if m == nil {
+		return nil, i, fmt.Errorf("line %d: malformed hunk header %q", i+1, lines[i])
+	}
+	atoi := func(s string, def int) int {
+		if s == "" {
+			return def
+		}
+		n, _ := strconv.Atoi(s)
+		return n
+	}
+	h := &Hunk{
+		OldStart: atoi(m[1], 0), OldLines: atoi(m[2], 1),
+		NewStart: atoi(m[3], 0), NewLines: atoi(m[4], 1),
+		Section: m[5],
+		header:  lines[i],
+	}
+	if strings.HasSuffix(lines[i], "\r") {
+		h.Section += "\r"
+	}
+	h.parsedRanges = [4]int{h.OldStart, h.OldLines, h.NewStart, h.NewLines}
+	i++
+
+	if lenient {
+		for i < len(lines) && isLenientHunkLine(lines, i) {
+			h.Lines = append(h.Lines, newHunkLine(lines[i]))
+			i++
+		}
+		return h, i, nil
+	}
+
+	oldSeen, newSeen := 0, 0
+	for oldSeen < h.OldLines || newSeen < h.NewLines {
+		if i >= len(lines) {
+			return nil, i, fmt.Errorf("hunk %q is truncated: expected %d old and %d new lines, found %d and %d",
+				strings.TrimSpace(h.header), h.OldLines, h.NewLines, oldSeen, newSeen)
+		}
+		line := lines[i]
+		if line != "" && !strings.ContainsRune(" -+\\", rune(line[0])) {
+			return nil, i, fmt.Errorf("line %d: unexpected %q in hunk %q", i+1, line, strings.TrimSpace(h.header))
+		}
+		hl := newHunkLine(line)
+		switch hl.Kind {
+		case HunkLineContext:
+			oldSeen++
+			newSeen++
+		case HunkLineDelete:
+			oldSeen++
+		case HunkLineAdd:
+			newSeen++
+		}
+		h.Lines = append(h.Lines, hl)
+		i++
+	}
+	for i < len(lines) && strings.HasPrefix(lines[i], "\\") {
+		h.Lines = append(h.Lines, newHunkLine(lines[i]))
+		i++
+	}
+	return h, i, nil
+}
+
+func newHunkLine(line string) HunkLine {
+	if line == "" || line == "\r" {
+		return HunkLine{Kind: HunkLineContext, Text: line, bare: true}
+	}
+	return HunkLine{Kind: line[0], Text: line[1:]}
+}
+
+// isLenientHunkLine reports whether lines[i] continues a hunk body when the
+// header counts are not trusted. A blank line only counts as context when more
+// body lines follow it.
+func isLenientHunkLine(lines []string, i int) bool {
+	line := lines[i]
+	if strings.HasPrefix(line, "@@ ") || IsFileStart(lines, i) {
+		return false
+	}
+	if line == "" || line == "\r" {
+		for j := i + 1; j < len(lines); j++ {
+			if lines[j] != "" && lines[j] != "\r" {
+				return isLenientHunkLine(lines, j)
+			}
+		}
+		return false
+	}
+	return strings.ContainsRune(" -+\\", rune(line[0]))
+}
+
+// HeaderRanges returns the ranges of the hunk header as parsed, or zeros for
+// a hunk that was not parsed or whose header carried no line numbers.
+func (h *Hunk) HeaderRanges() (oldStart, oldLines, newStart, newLines int) {
+	return h.parsedRanges[0], h.parsedRanges[1], h.parsedRanges[2], h.parsedRanges[3]
+}
+
+// HeaderLine renders the hunk header, reusing the original text while the ranges are unchanged.
+func (h *Hunk) HeaderLine() string {
+	if h.header != "" && h.parsedRanges == [4]int{h.OldStart, h.OldLines, h.NewStart, h.NewLines} {
+		return h.header
+	}
+	return fmt.Sprintf("@@ -%s +%s @@%s", FormatRange(h.OldStart, h.OldLines), FormatRange(h.NewStart, h.NewLines), h.Section)
+}
+
+// IsBare reports whether the line is a context line written as an empty line,
+// as editors that strip trailing whitespace leave them.
+func (l HunkLine) IsBare() bool {
+	return l.bare
+}
+
+func (l HunkLine) String() string {
+	if l.bare {
+		return l.Text
+	}
+	return string(l.Kind) + l.Text
+}
+
+// RenderLines renders the hunk, including its trailer, one line per element.
+func (h *Hunk) RenderLines() []string {
+	out := make([]string, 0, len(h.Lines)+len(h.Trailer)+1)
+	out = append(out, h.HeaderLine())
+	for _, l := range h.Lines {
+		out = append(out, l.String())
+	}
+	return append(out, h.Trailer...)
+}
+
+// Path returns the path the file has after the patch, or before it for deletions.
+func (f *FilePatch) Path() string {
+	if f.NewPath != "" {
+		return f.NewPath
+	}
+	return f.OldPath
+}
+
+// HeaderLines returns the raw header, or synthesizes a git header from the fields.
+func (f *FilePatch) HeaderLines() []string {
+	if f.Header != nil {
+		return f.Header
+	}
+	oldPath, newPath := f.OldPath, f.NewPath
+	if oldPath == "" {
+		oldPath = newPath
+	}
+	if newPath == "" {
+		newPath = oldPath
+	}
+	header := []string{fmt.Sprintf("diff --git a/%s b/%s", oldPath, newPath)}
+	modeOr := func(mode string) string {
+		if mode == "" {
+			return defaultFileMode
+		}
+		return mode
+	}
+	switch {
+	case f.IsNew:
+		header = append(header, "new file mode "+modeOr(f.NewMode))
+	case f.IsDeleted:
+		header = append(header, "deleted file mode "+modeOr(f.OldMode))
+	case f.OldMode != "" && f.NewMode != "" && f.OldMode != f.NewMode:
+		header = append(header, "old mode "+f.OldMode, "new mode "+f.NewMode)
+	}
+	if (f.IsRename || f.IsCopy) && oldPath != newPath {
+		verb := "rename"
+		if f.IsCopy {
+			verb = "copy"
+		}
+		header = append(header, verb+" from "+oldPath, verb+" to "+newPath)
+	}
+	minus, plus := "a/"+oldPath, "b/"+newPath
+	if f.IsNew {
+		minus = "/dev/null"
+	}
+	if f.IsDeleted {
+		plus = "/dev/null"
+	}
+	switch {
+	case f.IsBinary:
+		header = append(header, fmt.Sprintf("Binary files %s and %s differ", minus, plus))
+	case len(f.Hunks) > 0:
+		header = append(header, "--- "+minus, "+++ "+plus)
+	}
+	return header
+}
+
+// lines renders the file diff.
+func (f *FilePatch) lines() []string {
+	out := append([]string(nil), f.HeaderLines()...)
+	for _, h := range f.Hunks {
+		out = append(out, h.RenderLines()...)
+	}
+	return out
+}
+
+// String renders the file diff as a standalone patch ending with a newline.
+func (f *FilePatch) String() string {
+	return strings.Join(f.lines(), "\n") + "\n"
+}
+
+// WithHunks returns a copy of the file diff restricted to the given hunks.
+func (f *FilePatch) WithHunks(hunks []*Hunk) *FilePatch {
+	copied := *f
+	copied.Hunks = hunks
+	return &copied
+}
+
+// String renders the patch; for a parsed patch this is exactly the parsed text.
+func (p *Patch) String() string {
+	var out []string
+	out = append(out, p.Preamble...)
+	for _, f := range p.Files {
+		out = append(out, f.lines()...)
+	}
+	if len(out) == 0 {
+		return ""
+	}
+	text := strings.Join(out, "\n")
+	if !p.NoFinalNewline {
+		text += "\n"
+	}
+	return text
+}
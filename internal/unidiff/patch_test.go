@@ -0,0 +1,147 @@
+package unidiff
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseRoundTrip(t *testing.T) {
+	tests := []struct {
+		name               string
+		diff               string
+		oldPath, newPath   string
+		hunks              int
+		isNew, isDeleted   bool
+		isRename, isCopy   bool
+		isBinary           bool
+		oldMode, newMode   string
+		wantPreambleLength int
+	}{
+		{
+			name:    "modify",
+			diff:    "diff --git a/main.go b/main.go\nindex 1111111..2222222 100644\n--- a/main.go\n+++ b/main.go\n@@ -1,3 +1,3 @@ package main\n import \"fmt\"\n-var x = 1\n+var x = 2\n func f() {}\n",
+			oldPath: "main.go", newPath: "main.go", hunks: 1,
+		},
+		{
+			name:    "two hunks without counts",
+			diff:    "--- a/a.txt\n+++ b/a.txt\n@@ -1 +1 @@\n-a\n+b\n@@ -10,2 +10,3 @@\n x\n+y\n z\n",
+			oldPath: "a.txt", newPath: "a.txt", hunks: 2,
+		},
+		{
+			name:    "new file",
+			diff:    "diff --git a/new.txt b/new.txt\nnew file mode 100644\nindex 0000000..3333333\n--- /dev/null\n+++ b/new.txt\n@@ -0,0 +1,2 @@\n+one\n+two\n",
+			newPath: "new.txt", hunks: 1, isNew: true, newMode: "100644",
+		},
+		{
+			name:    "deleted file",
+			diff:    "diff --git a/old.txt b/old.txt\ndeleted file mode 100755\nindex 3333333..0000000\n--- a/old.txt\n+++ /dev/null\n@@ -1 +0,0 @@\n-gone\n",
+			oldPath: "old.txt", hunks: 1, isDeleted: true, oldMode: "100755",
+		},
+		{
+			name:    "rename with changes",
+			diff:    "diff --git a/src/a.go b/src/b.go\nsimilarity index 90%\nrename from src/a.go\nrename to src/b.go\n--- a/src/a.go\n+++ b/src/b.go\n@@ -1,2 +1,2 @@\n package src\n-// a\n+// b\n",
+			oldPath: "src/a.go", newPath: "src/b.go", hunks: 1, isRename: true,
+		},
+		{
+			name:    "pure rename",
+			diff:    "diff --git a/x.txt b/y.txt\nsimilarity index 100%\nrename from x.txt\nrename to y.txt\n",
+			oldPath: "x.txt", newPath: "y.txt", isRename: true,
+		},
+		{
+			name:    "copy",
+			diff:    "diff --git a/x.txt b/z.txt\nsimilarity index 100%\ncopy from x.txt\ncopy to z.txt\n",
+			oldPath: "x.txt", newPath: "z.txt", isCopy: true,
+		},
+		{
+			name:    "mode change",
+			diff:    "diff --git a/run.sh b/run.sh\nold mode 100644\nnew mode 100755\n",
+			oldPath: "run.sh", newPath: "run.sh", oldMode: "100644", newMode: "100755",
+		},
+		{
+			name:    "binary",
+			diff:    "diff --git a/logo.png b/logo.png\nindex 4444444..5555555 100644\nBinary files a/logo.png and b/logo.png differ\n",
+			oldPath: "logo.png", newPath: "logo.png", isBinary: true,
+		},
+		{
+			name:    "quoted path with spaces",
+			diff:    "diff --git \"a/my file.txt\" \"b/my file.txt\"\n--- \"a/my file.txt\"\n+++ \"b/my file.txt\"\n@@ -1 +1 @@\n-a\n+b\n",
+			oldPath: "my file.txt", newPath: "my file.txt", hunks: 1,
+		},
+		{
+			name:    "no newline at end of file",
+			diff:    "--- a/a.txt\n+++ b/a.txt\n@@ -1 +1 @@\n-a\n\\ No newline at end of file\n+b\n\\ No newline at end of file\n",
+			oldPath: "a.txt", newPath: "a.txt", hunks: 1,
+		},
+		{
+			name:    "CRLF content",
+			diff:    "--- a/a.txt\n+++ b/a.txt\n@@ -1,2 +1,2 @@\n keep\r\n-a\r\n+b\r\n",
+			oldPath: "a.txt", newPath: "a.txt", hunks: 1,
+		},
+		{
+			name:    "prose around the diff and no final newline",
+			diff:    "Here is the fix:\n\n--- a/a.txt\n+++ b/a.txt\n@@ -1 +1 @@\n-a\n+b\n\nLet me know if it works.",
+			oldPath: "a.txt", newPath: "a.txt", hunks: 1, wantPreambleLength: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := Parse(tt.diff)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if got := p.String(); got != tt.diff {
+				t.Errorf("String() = %q, want %q", got, tt.diff)
+			}
+			if len(p.Preamble) != tt.wantPreambleLength {
+				t.Errorf("preamble has %d lines, want %d", len(p.Preamble), tt.wantPreambleLength)
+			}
+			if len(p.Files) != 1 {
+				t.Fatalf("parsed %d files, want 1", len(p.Files))
+			}
+			f := p.Files[0]
+			if f.OldPath != tt.oldPath || f.NewPath != tt.newPath {
+				t.Errorf("paths = %q -> %q, want %q -> %q", f.OldPath, f.NewPath, tt.oldPath, tt.newPath)
+			}
+			if len(f.Hunks) != tt.hunks {
+				t.Errorf("parsed %d hunks, want %d", len(f.Hunks), tt.hunks)
+			}
+			if f.IsNew != tt.isNew || f.IsDeleted != tt.isDeleted || f.IsRename != tt.isRename || f.IsCopy != tt.isCopy || f.IsBinary != tt.isBinary {
+				t.Errorf("flags new=%v deleted=%v rename=%v copy=%v binary=%v", f.IsNew, f.IsDeleted, f.IsRename, f.IsCopy, f.IsBinary)
+			}
+			if f.OldMode != tt.oldMode || f.NewMode != tt.newMode {
+				t.Errorf("modes = %q -> %q, want %q -> %q", f.OldMode, f.NewMode, tt.oldMode, tt.newMode)
+			}
+		})
+	}
+}
+
+func TestFilePatchSynthesizedHeader(t *testing.T) {
+	p, err := Parse("diff --git a/a.txt b/a.txt\nindex 1111111..2222222 100644\n--- a/a.txt\n+++ b/a.txt\n@@ -1,2 +1,2 @@\n x\n-a\n+b\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := p.Files[0]
+	f.Header, f.NewPath, f.IsRename = nil, "b.txt", true
+	f.Hunks[0].OldStart, f.Hunks[0].NewStart = 5, 6
+	want := "diff --git a/a.txt b/b.txt\nrename from a.txt\nrename to b.txt\n--- a/a.txt\n+++ b/b.txt\n@@ -5,2 +6,2 @@\n x\n-a\n+b\n"
+	if got := f.String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	if _, err := Parse(f.String()); err != nil {
+		t.Errorf("synthesized diff does not parse: %v", err)
+	}
+}
+
+func TestParseCounts(t *testing.T) {
+	miscounted := "--- a/a.txt\n+++ b/a.txt\n@@ -1,3 +1,3 @@\n-a\n+b\n"
+	if _, err := Parse(miscounted); err == nil {
+		t.Error("Parse accepted a hunk shorter than its header")
+	}
+	p, err := ParseLenient(miscounted)
+	if err != nil {
+		t.Fatalf("ParseLenient: %v", err)
+	}
+	if got := p.String(); !strings.Contains(got, "-a\n+b\n") {
+		t.Errorf("lenient parse lost the hunk body: %q", got)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// --- Context manifest ---
+
+// ContextManifestEntry describes one <file> block exactly as it was emitted.
+type ContextManifestEntry struct {
+	Path   string `json:"path"`
+	Size   int    `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// ContextManifest lists the files of a generated context and the hash of the
+// whole output (excluding the manifest header itself).
+type ContextManifest struct {
+	Files         []ContextManifestEntry `json:"files"`
+	ContextSHA256 string                 `json:"contextSha256"`
+	ContextSize   int                    `json:"contextSize"`
+}
+
+var manifestHeaderRegex = regexp.MustCompile(`\A<manifest sha256="([0-9a-f]{64})" files="(\d+)" size="(\d+)">\n((?s:.*?))</manifest>\n\n`)
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func newManifestEntry(path, body string) ContextManifestEntry {
+	return ContextManifestEntry{Path: path, Size: len(body), SHA256: sha256Hex(body)}
+}
+
+func newContextManifest(files []ContextManifestEntry, context string) *ContextManifest {
+	if files == nil {
+		files = []ContextManifestEntry{}
+	}
+	return &ContextManifest{Files: files, ContextSHA256: sha256Hex(context), ContextSize: len(context)}
+}
+
+// header renders the manifest in the form embedded at the top of a context,
+// one "sha256 size path" line per file (the sha256sum layout, path last).
+func (m *ContextManifest) header() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "<manifest sha256=\"%s\" files=\"%d\" size=\"%d\">\n", m.ContextSHA256, len(m.Files), m.ContextSize)
+	for _, f := range m.Files {
+		fmt.Fprintf(&b, "%s %d %s\n", f.SHA256, f.Size, f.Path)
+	}
+	b.WriteString("</manifest>\n\n")
+	return b.String()
+}
+
+// splitManifestHeader separates an embedded manifest from the context it describes.
+// ok is false when the text does not start with a manifest header.
+func splitManifestHeader(text string) (manifest *ContextManifest, body string, ok bool) {
+	m := manifestHeaderRegex.FindStringSubmatch(text)
+	if m == nil {
+		return nil, text, false
+	}
+	manifest = &ContextManifest{ContextSHA256: m[1], Files: []ContextManifestEntry{}}
+	manifest.ContextSize, _ = strconv.Atoi(m[3])
+	for _, line := range strings.Split(strings.TrimSuffix(m[4], "\n"), "\n") {
+		fields := strings.SplitN(line, " ", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		size, _ := strconv.Atoi(fields[1])
+		manifest.Files = append(manifest.Files, ContextManifestEntry{SHA256: fields[0], Size: size, Path: fields[2]})
+	}
+	return manifest, text[len(m[0]):], true
+}
+
+// VerifyContextManifest checks that a pasted context with an embedded manifest
+// header is byte-for-byte the context the manifest was generated for.
+func (a *App) VerifyContextManifest(contextText string) (*ContextManifest, error) {
+	manifest, body, ok := splitManifestHeader(contextText)
+	if !ok {
+		return nil, fmt.Errorf("context has no manifest header")
+	}
+	if actual := sha256Hex(body); actual != manifest.ContextSHA256 {
+		return manifest, fmt.Errorf("context hash mismatch: manifest says %s, content hashes to %s", manifest.ContextSHA256, actual)
+	}
+	return manifest, nil
+}
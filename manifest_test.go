@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testContext renders files of a flat project the way generateContextOutput
+// does, with the manifest header embedded when withManifest is set.
+// TestGenerateContextOutput checks it against the generator.
+func testContext(files []contextFile, withManifest bool) string {
+	var tree, contents strings.Builder
+	tree.WriteString("project/\n")
+	var entries []ContextManifestEntry
+	for i, f := range files {
+		branch := "├── "
+		if i == len(files)-1 {
+			branch = "└── "
+		}
+		tree.WriteString(branch + f.Path + "\n")
+		contents.WriteString("<file path=\"" + f.Path + "\">\n" + f.Body + "\n</file>\n")
+		entries = append(entries, newManifestEntry(f.Path, f.Body))
+	}
+	result := tree.String() + "\n" + strings.TrimRight(contents.String(), "\n")
+	if withManifest {
+		result = newContextManifest(entries, result).header() + result
+	}
+	return result
+}
+
+// generateTestContext writes files under dir and generates their context.
+func generateTestContext(t *testing.T, dir string, files map[string]string, opts ContextGenerationOptions) string {
+	t.Helper()
+	writeTestFiles(t, dir, files)
+	out, err := (&App{}).generateShotgunOutputWithProgress(context.Background(), dir, nil, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestGenerateContextOutput(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "project")
+	files := map[string]string{
+		"B.go":        "package b\n",
+		"a.go":        "package a\n",
+		"lib.go":      "package lib\n",
+		"lib_test.go": "package lib\n",
+		"lib/x.go":    "package lib\n",
+		"Zeta/z.txt":  "z",
+		"zeta.txt":    "Z",
+	}
+	out := generateTestContext(t, dir, files, ContextGenerationOptions{EmbedManifest: true})
+	if again := generateTestContext(t, dir, files, ContextGenerationOptions{EmbedManifest: true}); again != out {
+		t.Fatalf("two generations of the same tree differ:\n%s\n---\n%s", out, again)
+	}
+
+	_, body, ok := splitManifestHeader(out)
+	if !ok {
+		t.Fatalf("no manifest header in %q", out)
+	}
+	wantTree := "project/\n" +
+		"├── lib\n" +
+		"│   └── x.go\n" +
+		"├── Zeta\n" +
+		"│   └── z.txt\n" +
+		"├── a.go\n" +
+		"├── B.go\n" +
+		"├── lib.go\n" +
+		"├── lib_test.go\n" +
+		"└── zeta.txt\n\n"
+	if !strings.HasPrefix(body, wantTree) {
+		t.Errorf("tree =\n%s\nwant\n%s", body[:strings.Index(body, "<file")], wantTree)
+	}
+	var paths []string
+	for _, f := range parseContextFiles(out) {
+		paths = append(paths, f.Path)
+	}
+	if want := []string{"lib/x.go", "Zeta/z.txt", "a.go", "B.go", "lib.go", "lib_test.go", "zeta.txt"}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("file blocks = %v, want %v", paths, want)
+	}
+
+	flat := []contextFile{{Path: "a.go", Body: "package a\n"}, {Path: "b.txt", Body: "x"}}
+	flatDir := filepath.Join(t.TempDir(), "project")
+	got := generateTestContext(t, flatDir, map[string]string{"b.txt": "x", "a.go": "package a\n"}, ContextGenerationOptions{EmbedManifest: true})
+	if want := testContext(flat, true); got != want {
+		t.Errorf("testContext = %q, generator = %q", want, got)
+	}
+}
+
+func TestTreeEntryLess(t *testing.T) {
+	tests := []struct {
+		nameI  string
+		isDirI bool
+		nameJ  string
+		isDirJ bool
+		want   bool
+	}{
+		{"zeta", true, "a.go", false, true},
+		{"a.go", false, "zeta", true, false},
+		{"B.go", false, "a.go", false, false},
+		{"a.go", false, "B.go", false, true},
+		{"lib", true, "lib.go", false, true},
+		{"lib.go", false, "lib_test.go", false, true},
+		{"A.go", false, "a.go", false, true},
+		{"a.go", false, "A.go", false, false},
+		{"a.go", false, "a.go", false, false},
+	}
+	for _, tt := range tests {
+		if got := treeEntryLess(tt.nameI, tt.isDirI, tt.nameJ, tt.isDirJ); got != tt.want {
+			t.Errorf("treeEntryLess(%q, %v, %q, %v) = %v, want %v", tt.nameI, tt.isDirI, tt.nameJ, tt.isDirJ, got, tt.want)
+		}
+	}
+}
+
+func TestContextManifest(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "project")
+	text := generateTestContext(t, dir, map[string]string{"a.go": "package a\n", "dir/with space.txt": "x"}, ContextGenerationOptions{EmbedManifest: true})
+
+	manifest, body, ok := splitManifestHeader(text)
+	if !ok {
+		t.Fatalf("no manifest header in %q", text)
+	}
+	plain, err := (&App{}).generateShotgunOutputWithProgress(context.Background(), dir, nil, ContextGenerationOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body != plain {
+		t.Errorf("body after the header = %q, want the context without it", body)
+	}
+	want := []ContextManifestEntry{newManifestEntry("dir/with space.txt", "x"), newManifestEntry("a.go", "package a\n")}
+	if !reflect.DeepEqual(manifest.Files, want) {
+		t.Errorf("manifest files = %+v, want %+v", manifest.Files, want)
+	}
+	if manifest.ContextSize != len(body) || manifest.ContextSHA256 != sha256Hex(body) {
+		t.Errorf("manifest = %d bytes, %s; body is %d bytes, %s", manifest.ContextSize, manifest.ContextSHA256, len(body), sha256Hex(body))
+	}
+
+	a := &App{}
+	if _, err := a.VerifyContextManifest(text); err != nil {
+		t.Errorf("verify: %v", err)
+	}
+	if _, err := a.VerifyContextManifest(strings.Replace(text, "package a", "package b", 1)); err == nil {
+		t.Error("verify accepted an edited context")
+	}
+	if _, err := a.VerifyContextManifest(body); err == nil {
+		t.Error("verify accepted a context without a manifest")
+	}
+}
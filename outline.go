@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"path"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// --- Outline (skeleton) rendering ---
+
+// Render modes for file contents in the generated context.
+const (
+	RenderModeFull    = "full"    // Full source for every file
+	RenderModeOutline = "outline" // Full source for focus paths, signatures only for the rest
+)
+
+// outlineSource renders a skeleton of a source file: package/imports, type
+// declarations and function signatures. The second return value is false
+// when the language is not supported and the caller should keep full content.
+func outlineSource(relPath string, content []byte) (string, bool) {
+	switch strings.ToLower(path.Ext(relPath)) {
+	case ".go":
+		if outline, ok := outlineGo(content); ok {
+			return outline, true
+		}
+		// Unparseable Go still has braces, so the generic tokenizer gives a reasonable skeleton.
+		return outlineBraceLanguage(string(content), false), true
+	case ".py", ".pyi":
+		return outlinePython(string(content)), true
+	case ".rs":
+		// Rust lifetimes ('a) share the quote with char literals.
+		return outlineBraceLanguage(string(content), true), true
+	case ".js", ".jsx", ".mjs", ".cjs", ".ts", ".tsx", ".mts", ".cts",
+		".java", ".kt", ".kts", ".scala", ".cs", ".swift", ".dart",
+		".c", ".h", ".cc", ".cpp", ".cxx", ".hpp", ".hh", ".php":
+		return outlineBraceLanguage(string(content), false), true
+	}
+	return "", false
+}
+
+// isFocusPath reports whether relPath (forward slashes) is one of the focus
+// paths or lies inside a focus directory. Empty focus paths are ignored.
+func isFocusPath(relPath string, focusPaths []string) bool {
+	for _, p := range focusPaths {
+		if strings.TrimSpace(p) == "" {
+			continue
+		}
+		p = strings.TrimSuffix(path.Clean(strings.ReplaceAll(p, "\\", "/")), "/")
+		if p == "." || p == relPath || strings.HasPrefix(relPath, p+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// outlineGo uses go/parser to keep the package clause, imports, type
+// declarations and function signatures (bodies dropped).
+func outlineGo(content []byte) (string, bool) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", content, parser.ParseComments|parser.SkipObjectResolution)
+	if err != nil {
+		return "", false
+	}
+
+	var out bytes.Buffer
+	out.WriteString("package " + file.Name.Name + "\n")
+
+	cfg := printer.Config{Mode: printer.UseSpaces | printer.TabIndent, Tabwidth: 8}
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.GenDecl:
+			if d.Tok != token.IMPORT && d.Tok != token.TYPE {
+				continue
+			}
+			out.WriteString("\n")
+			if err := cfg.Fprint(&out, fset, d); err != nil {
+				return "", false
+			}
+			out.WriteString("\n")
+		case *ast.FuncDecl:
+			d.Body = nil
+			out.WriteString("\n")
+			if err := cfg.Fprint(&out, fset, d); err != nil {
+				return "", false
+			}
+			out.WriteString("\n")
+		}
+	}
+	return out.String(), true
+}
+
+var (
+	pythonDeclRegex     = regexp.MustCompile(`^\s*(import\s|from\s+\S+\s+import\s|class\s|def\s|async\s+def\s|@)`)
+	pythonConstantRegex = regexp.MustCompile(`^[A-Z_][A-Z0-9_]*\s*(:[^=]*)?=`)
+)
+
+// outlinePython keeps imports, decorators, class and def headers (including
+// multi-line signatures) and module-level constants. Function bodies become "...".
+func outlinePython(src string) string {
+	lines := strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n")
+	var out []string
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if !pythonDeclRegex.MatchString(line) && !pythonConstantRegex.MatchString(line) {
+			continue
+		}
+		// Follow bracketed continuations so multi-line signatures and imports stay intact.
+		depth := strings.Count(line, "(") + strings.Count(line, "[") - strings.Count(line, ")") - strings.Count(line, "]")
+		out = append(out, strings.TrimRight(line, " \t"))
+		last := line
+		for depth > 0 && i+1 < len(lines) {
+			i++
+			last = lines[i]
+			depth += strings.Count(last, "(") + strings.Count(last, "[") - strings.Count(last, ")") - strings.Count(last, "]")
+			out = append(out, strings.TrimRight(last, " \t"))
+		}
+		trimmed := strings.TrimSpace(line)
+		isDef := strings.HasPrefix(trimmed, "def ") || strings.HasPrefix(trimmed, "async ")
+		if isDef && strings.HasSuffix(strings.TrimSpace(last), ":") { // One-line bodies are already complete
+			indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+			out = append(out, indent+"    ...")
+		}
+	}
+	return strings.Join(out, "\n") + "\n"
+}
+
+// containerBlockRegex matches headers whose braces enclose declarations
+// (rather than statements), so their members remain visible in the outline.
+var containerBlockRegex = regexp.MustCompile(`\b(class|interface|enum|struct|trait|impl|namespace|module|mod|object|record|protocol|extension)\b|^\s*(export|import)(\s+type)?\s*$`)
+
+// outlineBraceLanguage is a lightweight tokenizer for C-family languages.
+// It tracks brace nesting (skipping strings and comments) and emits only lines
+// whose enclosing blocks are all declaration containers; function and other
+// statement bodies are collapsed to "{ ... }". With charQuotes, a single quote
+// only starts a char literal when one closes it, so lifetimes are left alone.
+func outlineBraceLanguage(src string, charQuotes bool) string {
+	lines := strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n")
+
+	var (
+		stack          []bool // true for container blocks
+		inBlockComment bool
+		inTemplate     bool
+		prevHeader     string
+		out            []string
+	)
+	visible := func() bool {
+		for _, isContainer := range stack {
+			if !isContainer {
+				return false
+			}
+		}
+		return true
+	}
+
+	for _, line := range lines {
+		wasVisible := visible()
+		startDepth := len(stack)
+		openedBody := false
+
+		for i := 0; i < len(line); i++ {
+			c := line[i]
+			switch {
+			case inBlockComment:
+				if c == '*' && i+1 < len(line) && line[i+1] == '/' {
+					inBlockComment = false
+					i++
+				}
+			case inTemplate:
+				if c == '\\' {
+					i++
+				} else if c == '`' {
+					inTemplate = false
+				}
+			case c == '/' && i+1 < len(line) && line[i+1] == '/':
+				i = len(line)
+			case c == '/' && i+1 < len(line) && line[i+1] == '*':
+				inBlockComment = true
+				i++
+			case c == '`':
+				inTemplate = true
+			case c == '\'' && charQuotes:
+				if end := charLiteralEnd(line, i); end > i {
+					i = end
+				}
+			case c == '"' || c == '\'':
+				// Plain string literals end at the closing quote or the end of the line.
+				for i++; i < len(line) && line[i] != c; i++ {
+					if line[i] == '\\' {
+						i++
+					}
+				}
+			case c == '{':
+				header := line[:i]
+				if strings.TrimSpace(header) == "" {
+					header = prevHeader // Allman style: the header is on the previous line
+				}
+				isContainer := containerBlockRegex.MatchString(header)
+				stack = append(stack, isContainer)
+				if !isContainer && len(stack) == startDepth+1 {
+					openedBody = true
+				}
+			case c == '}':
+				if len(stack) > 0 {
+					stack = stack[:len(stack)-1]
+				}
+				if len(stack) <= startDepth {
+					openedBody = false
+				}
+			}
+		}
+
+		if strings.TrimSpace(line) != "" {
+			prevHeader = line
+		}
+		if !wasVisible || strings.TrimSpace(line) == "" {
+			continue
+		}
+		emitted := strings.TrimRight(line, " \t")
+		if openedBody && len(stack) > startDepth {
+			emitted += " ... }"
+		}
+		out = append(out, emitted)
+	}
+	return strings.Join(out, "\n") + "\n"
+}
+
+// charLiteralEnd returns the index of the quote closing the char literal that
+// starts at line[start], or -1 when none does (a Rust lifetime or label).
+func charLiteralEnd(line string, start int) int {
+	i := start + 1
+	if i >= len(line) {
+		return -1
+	}
+	if line[i] == '\\' {
+		// Escapes are short: '\n', '\x7f', '\u{1F600}'
+		for j := i + 2; j < len(line) && j <= i+10; j++ {
+			if line[j] == '\'' {
+				return j
+			}
+		}
+		return -1
+	}
+	_, size := utf8.DecodeRuneInString(line[i:])
+	if i+size < len(line) && line[i+size] == '\'' {
+		return i + size
+	}
+	return -1
+}
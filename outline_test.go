@@ -0,0 +1,83 @@
+package main
+
+import "testing"
+
+func TestOutlineSource(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		content string
+		want    string // Empty means the language is not supported
+	}{
+		{
+			name:    "go",
+			path:    "store/store.go",
+			content: "package store\n\nimport \"fmt\"\n\nconst limit = 10\n\ntype Store struct {\n\titems []string\n}\n\nfunc (s *Store) Add(item string) error {\n\tif len(s.items) >= limit {\n\t\treturn fmt.Errorf(\"full\")\n\t}\n\ts.items = append(s.items, item)\n\treturn nil\n}\n",
+			want:    "package store\n\nimport \"fmt\"\n\ntype Store struct {\n\titems []string\n}\n\nfunc (s *Store) Add(item string) error\n",
+		},
+		{
+			name:    "go doc comments",
+			path:    "store/doc.go",
+			content: "package store\n\n// Store holds items.\ntype Store struct {\n\t// items are kept in order.\n\titems []string\n}\n\n// Add appends an item.\nfunc (s *Store) Add(item string) {\n\t// Not part of the outline\n\ts.items = append(s.items, item)\n}\n",
+			want:    "package store\n\n// Store holds items.\ntype Store struct {\n\t// items are kept in order.\n\titems []string\n}\n\n// Add appends an item.\nfunc (s *Store) Add(item string)\n",
+		},
+		{
+			name:    "unparseable go",
+			path:    "broken.go",
+			content: "package broken\n\nfunc f() {\n\treturn 1 +\n}\n",
+			want:    "package broken\nfunc f() { ... }\n",
+		},
+		{
+			name:    "python",
+			path:    "app/models.py",
+			content: "import os\nfrom typing import List\n\nMAX_ITEMS = 10\n\n@dataclass\nclass Store:\n    def add(self,\n            item: str) -> None:\n        self.items.append(item)\n\n    def size(self): return len(self.items)\n",
+			want:    "import os\nfrom typing import List\nMAX_ITEMS = 10\n@dataclass\nclass Store:\n    def add(self,\n            item: str) -> None:\n        ...\n    def size(self): return len(self.items)\n",
+		},
+		{
+			name:    "typescript",
+			path:    "web/store.ts",
+			content: "import { api } from './api'\n\nexport class Store {\n  private items: string[] = []\n\n  add(item: string): void {\n    if (item === '}') {\n      return\n    }\n    this.items.push(item)\n  }\n}\n\nexport function load(): Store {\n  return new Store()\n}\n",
+			want:    "import { api } from './api'\nexport class Store {\n  private items: string[] = []\n  add(item: string): void { ... }\n}\nexport function load(): Store { ... }\n",
+		},
+		{
+			name:    "rust lifetimes and chars",
+			path:    "src/lib.rs",
+			content: "pub struct Parser<'a> {\n    src: &'a str,\n}\n\nimpl<'a> Parser<'a> {\n    pub fn first(&self) -> Option<&'a str> {\n        if self.src.starts_with('{') || self.src.ends_with('\\'') {\n            return None;\n        }\n        'outer: loop { break 'outer; }\n        Some(self.src)\n    }\n\n    pub fn brace(&self) -> char { '}' }\n}\n\npub fn longest<'a>(x: &'a str, y: &'a str) -> &'a str {\n    x\n}\n",
+			want:    "pub struct Parser<'a> {\n    src: &'a str,\n}\nimpl<'a> Parser<'a> {\n    pub fn first(&self) -> Option<&'a str> { ... }\n    pub fn brace(&self) -> char { '}' }\n}\npub fn longest<'a>(x: &'a str, y: &'a str) -> &'a str { ... }\n",
+		},
+		{
+			name:    "unsupported",
+			path:    "README.md",
+			content: "# Title\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := outlineSource(tt.path, []byte(tt.content))
+			if ok != (tt.want != "") || got != tt.want {
+				t.Errorf("outline = %q, %v, want %q", got, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsFocusPath(t *testing.T) {
+	tests := []struct {
+		path  string
+		focus []string
+		want  bool
+	}{
+		{path: "src/a.go", focus: []string{"src/a.go"}, want: true},
+		{path: "src/a.go", focus: []string{"src"}, want: true},
+		{path: "src/a.go", focus: []string{`src\`}, want: true},
+		{path: "src/a.go", focus: []string{"."}, want: true},
+		{path: "srcx/a.go", focus: []string{"src"}, want: false},
+		{path: "src/a.go", focus: []string{"", "  ", "docs"}, want: false},
+		{path: "src/a.go", focus: nil, want: false},
+	}
+	for _, tt := range tests {
+		if got := isFocusPath(tt.path, tt.focus); got != tt.want {
+			t.Errorf("isFocusPath(%q, %q) = %v, want %v", tt.path, tt.focus, got, tt.want)
+		}
+	}
+}
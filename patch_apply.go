@@ -0,0 +1,471 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"shotgun_code/internal/unidiff"
+)
+
+// --- Applying unified diffs to the working tree ---
+
+// ApplyDiffOptions controls ApplyDiff.
+type ApplyDiffOptions struct {
+	DryRun bool `json:"dryRun"` // Check that every hunk applies without writing anything
+	// Fuzzy locates hunks that do not match exactly by context similarity,
+	// ignoring whitespace, and reads hunk bodies without trusting header counts.
+	Fuzzy bool `json:"fuzzy"`
+	Fuzz  int  `json:"fuzz"` // Context lines per hunk that may differ from the file in fuzzy mode
+}
+
+// HunkApplyResult reports where and whether one hunk applied.
+type HunkApplyResult struct {
+	Index      int     `json:"index"`    // 0-based position of the hunk in its file diff
+	OldStart   int     `json:"oldStart"` // As written in the hunk header
+	Applied    bool    `json:"applied"`
+	Line       int     `json:"line"`       // 1-based line of the old file where the hunk matched
+	Offset     int     `json:"offset"`     // Line minus the position the header announced
+	Confidence float64 `json:"confidence"` // 1 for an exact match, lower for a fuzzy one
+	Error      string  `json:"error,omitempty"`
+}
+
+// FileApplyResult reports the outcome for one file diff.
+type FileApplyResult struct {
+	Path    string            `json:"path"`
+	OldPath string            `json:"oldPath,omitempty"` // Set for renames
+	Action  string            `json:"action"`            // "modify", "create", "delete", "rename" or "copy"
+	Applied bool              `json:"applied"`
+	Hunks   []HunkApplyResult `json:"hunks"`
+	Error   string            `json:"error,omitempty"`
+}
+
+// ApplyDiffResult is the outcome of ApplyDiff. Application is all or nothing:
+// Applied is true only if every file was written.
+type ApplyDiffResult struct {
+	Applied    bool              `json:"applied"`
+	DryRun     bool              `json:"dryRun"`
+	RolledBack bool              `json:"rolledBack"` // A write failed and earlier writes were undone
+	Files      []FileApplyResult `json:"files"`
+	Error      string            `json:"error,omitempty"`
+}
+
+// fileState is the content of a path before or after the patch.
+type fileState struct {
+	exists  bool
+	content string
+	mode    fs.FileMode
+}
+
+// resolvePatchPath maps a patch path to a path under rootDir, refusing paths that escape it.
+func resolvePatchPath(rootDir, patchPath string) (string, error) {
+	if patchPath == "" {
+		return "", fmt.Errorf("empty path")
+	}
+	cleaned := path.Clean(strings.ReplaceAll(patchPath, `\`, "/"))
+	if path.IsAbs(cleaned) || filepath.IsAbs(patchPath) || cleaned == ".." || strings.HasPrefix(cleaned, "../") || cleaned == "." {
+		return "", fmt.Errorf("path %s is outside the project", patchPath)
+	}
+	return filepath.Join(rootDir, filepath.FromSlash(cleaned)), nil
+}
+
+// checkProjectRoot returns an error unless rootDir is an existing directory.
+func checkProjectRoot(rootDir string) error {
+	info, err := os.Stat(rootDir)
+	if err != nil {
+		return fmt.Errorf("invalid project root: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("invalid project root: %s is not a directory", rootDir)
+	}
+	return nil
+}
+
+// hunkSides returns the old and new lines of a hunk and whether either side
+// ends without a newline.
+func hunkSides(h *unidiff.Hunk) (oldLines, newLines []string, oldNoEOL, newNoEOL bool) {
+	var prev byte
+	for _, l := range h.Lines {
+		switch l.Kind {
+		case unidiff.HunkLineContext:
+			text := strings.TrimSuffix(l.Text, "\r")
+			oldLines = append(oldLines, text)
+			newLines = append(newLines, text)
+		case unidiff.HunkLineDelete:
+			oldLines = append(oldLines, strings.TrimSuffix(l.Text, "\r"))
+		case unidiff.HunkLineAdd:
+			newLines = append(newLines, strings.TrimSuffix(l.Text, "\r"))
+		case unidiff.HunkLineNoNewline:
+			oldNoEOL = oldNoEOL || prev != unidiff.HunkLineAdd
+			newNoEOL = newNoEOL || prev != unidiff.HunkLineDelete
+		}
+		prev = l.Kind
+	}
+	return oldLines, newLines, oldNoEOL, newNoEOL
+}
+
+// splitFileLines splits content into lines that keep a trailing "\r", so
+// untouched lines are written back byte for byte.
+func splitFileLines(content string) (lines []string, finalNewline bool) {
+	if content == "" {
+		return nil, true
+	}
+	finalNewline = strings.HasSuffix(content, "\n")
+	return strings.Split(strings.TrimSuffix(content, "\n"), "\n"), finalNewline
+}
+
+// matchesAt reports whether want matches lines starting at pos, ignoring "\r".
+func matchesAt(lines []string, pos int, want []string) bool {
+	if pos < 0 || pos+len(want) > len(lines) {
+		return false
+	}
+	for i, w := range want {
+		if strings.TrimSuffix(lines[pos+i], "\r") != w {
+			return false
+		}
+	}
+	return true
+}
+
+// locateHunkExact finds the position of old in lines at or after minPos that
+// is closest to expected.
+func locateHunkExact(lines []string, old []string, expected, minPos int) (int, bool) {
+	maxPos := len(lines) - len(old)
+	for delta := 0; expected-delta >= minPos || expected+delta <= maxPos; delta++ {
+		if p := expected - delta; p >= minPos && p <= maxPos && matchesAt(lines, p, old) {
+			return p, true
+		}
+		if p := expected + delta; delta > 0 && p >= minPos && p <= maxPos && matchesAt(lines, p, old) {
+			return p, true
+		}
+	}
+	return 0, false
+}
+
+// applyHunks applies the hunks of one file diff to content. It tries every
+// hunk so all failures are reported, and fails if any hunk does not apply.
+func applyHunks(content string, hunks []*unidiff.Hunk, opts ApplyDiffOptions) (string, []HunkApplyResult, error) {
+	lines, finalNewline := splitFileLines(content)
+	eol := ""
+	if len(lines) > 0 && strings.HasSuffix(lines[0], "\r") {
+		eol = "\r"
+	}
+
+	results := make([]HunkApplyResult, len(hunks))
+	var out []string
+	cursor, offset, failed := 0, 0, 0
+	for i, h := range hunks {
+		results[i] = HunkApplyResult{Index: i, OldStart: h.OldStart}
+		oldLines, _, oldNoEOL, newNoEOL := hunkSides(h)
+
+		expected := h.OldStart - 1
+		if len(oldLines) == 0 {
+			expected = h.OldStart // "-N,0" inserts after line N
+		}
+		expected = min(max(expected+offset, cursor), len(lines))
+		pos, ok := locateHunkExact(lines, oldLines, expected, cursor)
+		confidence := 1.0
+		if !ok && opts.Fuzzy {
+			pos, confidence, ok = locateHunkFuzzy(lines, h, expected, cursor, opts.Fuzz)
+		}
+		if !ok {
+			results[i].Error = "context does not match the file"
+			failed++
+			continue
+		}
+
+		var indents map[string]string
+		if confidence < 1 {
+			indents = fuzzyIndents(lines, h, pos)
+		}
+		out = append(out, lines[cursor:pos]...)
+		k := pos
+		for _, l := range h.Lines {
+			switch l.Kind {
+			case unidiff.HunkLineContext:
+				out = append(out, lines[k]) // Keep the file's own bytes for context
+				k++
+			case unidiff.HunkLineDelete:
+				k++
+			case unidiff.HunkLineAdd:
+				out = append(out, reindent(strings.TrimSuffix(l.Text, "\r"), indents)+eol)
+			}
+		}
+		cursor = k
+		if cursor == len(lines) {
+			switch {
+			case newNoEOL:
+				finalNewline = false
+			case oldNoEOL:
+				finalNewline = true
+			}
+		}
+		results[i].Applied = true
+		results[i].Line = pos + 1
+		results[i].Confidence = confidence
+		results[i].Offset = pos - (h.OldStart - 1)
+		if len(oldLines) == 0 {
+			results[i].Offset = pos - h.OldStart
+		}
+		offset = results[i].Offset
+	}
+	if failed > 0 {
+		return "", results, fmt.Errorf("%d of %d hunks failed", failed, len(hunks))
+	}
+	out = append(out, lines[cursor:]...)
+
+	if len(out) == 0 {
+		return "", results, nil
+	}
+	result := strings.Join(out, "\n")
+	if finalNewline {
+		result += "\n"
+	}
+	return result, results, nil
+}
+
+// parseFileMode converts a git mode such as "100755" to a permission mode.
+func parseFileMode(gitMode string, fallback fs.FileMode) fs.FileMode {
+	switch {
+	case strings.HasSuffix(gitMode, "755"):
+		return 0755
+	case strings.HasSuffix(gitMode, "644"):
+		return 0644
+	}
+	return fallback
+}
+
+// stagedPatch applies a patch in memory. Later file diffs see the result of
+// earlier ones, so a patch may touch the same file twice.
+type stagedPatch struct {
+	rootDir  string
+	original map[string]fileState // Disk state of every touched path
+	staged   map[string]fileState // Result of the patch
+	order    []string             // Touched paths in first-touch order
+}
+
+func (s *stagedPatch) read(absPath string) (fileState, error) {
+	if st, ok := s.staged[absPath]; ok {
+		return st, nil
+	}
+	st := fileState{mode: 0644}
+	info, err := os.Stat(absPath)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return st, err
+	case info.IsDir():
+		return st, fmt.Errorf("%s is a directory", absPath)
+	default:
+		data, err := os.ReadFile(absPath)
+		if err != nil {
+			return st, err
+		}
+		st = fileState{exists: true, content: string(data), mode: info.Mode().Perm()}
+	}
+	s.original[absPath] = st
+	s.order = append(s.order, absPath)
+	s.staged[absPath] = st
+	return st, nil
+}
+
+// stageFile applies one file diff to the staged state.
+func (s *stagedPatch) stageFile(f *unidiff.FilePatch, opts ApplyDiffOptions) FileApplyResult {
+	res := FileApplyResult{Path: f.Path(), Action: "modify", Hunks: []HunkApplyResult{}}
+	switch {
+	case f.IsNew:
+		res.Action = "create"
+	case f.IsDeleted:
+		res.Action = "delete"
+	case f.IsRename && f.OldPath != f.NewPath:
+		res.Action, res.OldPath = "rename", f.OldPath
+	case f.IsCopy && f.OldPath != f.NewPath:
+		res.Action, res.OldPath = "copy", f.OldPath
+	}
+	fail := func(format string, args ...any) FileApplyResult {
+		res.Error = fmt.Sprintf(format, args...)
+		return res
+	}
+	if f.IsBinary {
+		return fail("binary patches are not supported")
+	}
+
+	srcPath, err := resolvePatchPath(s.rootDir, f.OldPath)
+	if f.IsNew {
+		srcPath, err = resolvePatchPath(s.rootDir, f.NewPath)
+	}
+	if err != nil {
+		return fail("%v", err)
+	}
+	dstPath := srcPath
+	if res.Action == "rename" || res.Action == "copy" {
+		if dstPath, err = resolvePatchPath(s.rootDir, f.NewPath); err != nil {
+			return fail("%v", err)
+		}
+	}
+
+	src, err := s.read(srcPath)
+	if err != nil {
+		return fail("%v", err)
+	}
+	switch {
+	case f.IsNew && src.exists:
+		return fail("file already exists")
+	case !f.IsNew && !src.exists:
+		return fail("file does not exist")
+	}
+	if dstPath != srcPath {
+		dst, err := s.read(dstPath)
+		if err != nil {
+			return fail("%v", err)
+		}
+		if dst.exists {
+			return fail("%s target %s already exists", res.Action, f.NewPath)
+		}
+	}
+
+	content, hunkResults, err := applyHunks(src.content, f.Hunks, opts)
+	res.Hunks = hunkResults
+	if err != nil {
+		return fail("%v", err)
+	}
+	if f.IsDeleted {
+		if content != "" {
+			return fail("file still has content after removing the patched lines")
+		}
+		s.staged[srcPath] = fileState{}
+		res.Applied = true
+		return res
+	}
+
+	mode := src.mode
+	if f.NewMode != "" {
+		mode = parseFileMode(f.NewMode, mode)
+	}
+	if res.Action == "rename" {
+		s.staged[srcPath] = fileState{}
+	}
+	// A copy leaves the source as it is and creates the target from the patched content
+	s.staged[dstPath] = fileState{exists: true, content: content, mode: mode}
+	res.Applied = true
+	return res
+}
+
+// write makes the disk match the staged state. If a write fails, every path
+// already written is restored and rolledBack is true.
+func (s *stagedPatch) write() (rolledBack bool, err error) {
+	var written []string
+	for _, p := range s.order {
+		orig, st := s.original[p], s.staged[p]
+		if orig == st {
+			continue
+		}
+		if werr := writeFileState(p, st); werr != nil {
+			err = fmt.Errorf("failed to write %s: %w", p, werr)
+			break
+		}
+		written = append(written, p)
+	}
+	if err == nil {
+		return false, nil
+	}
+	for i := len(written) - 1; i >= 0; i-- {
+		if rerr := writeFileState(written[i], s.original[written[i]]); rerr != nil {
+			err = fmt.Errorf("%w; rollback of %s also failed: %v", err, written[i], rerr)
+		}
+	}
+	return true, err
+}
+
+func writeFileState(absPath string, st fileState) error {
+	if !st.exists {
+		if err := os.Remove(absPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(absPath), os.ModePerm); err != nil {
+		return err
+	}
+	return writeFileAtomic(absPath, []byte(st.content), st.mode)
+}
+
+// applyPatch stages every file diff and, unless this is a dry run or something
+// failed, writes the result.
+func applyPatch(rootDir string, patch *unidiff.Patch, opts ApplyDiffOptions) *ApplyDiffResult {
+	result := &ApplyDiffResult{DryRun: opts.DryRun, Files: []FileApplyResult{}}
+	staged := &stagedPatch{rootDir: rootDir, original: make(map[string]fileState), staged: make(map[string]fileState)}
+	failed := 0
+	for _, f := range patch.Files {
+		res := staged.stageFile(f, opts)
+		if !res.Applied {
+			failed++
+		}
+		result.Files = append(result.Files, res)
+	}
+	switch {
+	case len(patch.Files) == 0:
+		result.Error = "diff contains no file changes"
+	case failed > 0:
+		result.Error = fmt.Sprintf("%d of %d files do not apply; nothing was written", failed, len(patch.Files))
+	case opts.DryRun:
+	default:
+		rolledBack, err := staged.write()
+		result.RolledBack = rolledBack
+		if err != nil {
+			result.Error = err.Error()
+			for i := range result.Files {
+				result.Files[i].Applied = false
+			}
+			return result
+		}
+		result.Applied = true
+	}
+	return result
+}
+
+// ApplyDiff applies a unified diff to the files under rootDir. Every hunk must
+// match the current content (at any offset), or be similar enough in fuzzy
+// mode; if any file fails nothing is written, and if a write fails midway the
+// files already written are restored. Parse errors are returned as an error;
+// application problems are reported in the result. A response made of whole
+// <file path="..."> blocks is diffed against rootDir first.
+func (a *App) ApplyDiff(rootDir string, diff string, opts ApplyDiffOptions) (*ApplyDiffResult, error) {
+	if opts.Fuzz < 0 {
+		return nil, fmt.Errorf("fuzz must not be negative")
+	}
+	if err := checkProjectRoot(rootDir); err != nil {
+		return nil, err
+	}
+	if isFileResponse(diff) {
+		converted, err := fileResponseDiff(rootDir, diff)
+		if err != nil {
+			return nil, fmt.Errorf("failed to diff whole-file response: %w", err)
+		}
+		diff = converted.Diff
+	}
+	parse := unidiff.Parse
+	if opts.Fuzzy {
+		parse = unidiff.ParseLenient
+	}
+	patch, err := parse(diff)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse diff: %w", err)
+	}
+	result := applyPatch(rootDir, patch, opts)
+	switch {
+	case result.Applied:
+		runtime.LogInfof(a.ctx, "Applied diff to %d files in %s", len(result.Files), rootDir)
+		if a.symbolIndexer != nil {
+			a.symbolIndexer.Invalidate()
+		}
+	case result.Error != "":
+		runtime.LogWarningf(a.ctx, "Diff not applied to %s: %s", rootDir, result.Error)
+	}
+	return result, nil
+}
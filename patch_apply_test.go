@@ -0,0 +1,211 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"shotgun_code/internal/unidiff"
+)
+
+func writeTestFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// readTestFiles returns the content of every file under root.
+func readTestFiles(t *testing.T, root string) map[string]string {
+	t.Helper()
+	files := make(map[string]string)
+	err := filepath.WalkDir(root, func(p string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(root, p)
+		files[filepath.ToSlash(rel)] = string(data)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestApplyPatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		diff    string
+		opts    ApplyDiffOptions
+		applied bool
+		actions []string
+		want    map[string]string // Files after applying; nil means unchanged
+	}{
+		{
+			name:    "modify",
+			files:   map[string]string{"a.txt": "one\ntwo\nthree\n"},
+			diff:    "--- a/a.txt\n+++ b/a.txt\n@@ -1,3 +1,3 @@\n one\n-two\n+TWO\n three\n",
+			applied: true,
+			actions: []string{"modify"},
+			want:    map[string]string{"a.txt": "one\nTWO\nthree\n"},
+		},
+		{
+			name:    "create",
+			files:   map[string]string{"a.txt": "a\n"},
+			diff:    "diff --git a/dir/new.txt b/dir/new.txt\nnew file mode 100644\n--- /dev/null\n+++ b/dir/new.txt\n@@ -0,0 +1,2 @@\n+hello\n+world\n",
+			applied: true,
+			actions: []string{"create"},
+			want:    map[string]string{"a.txt": "a\n", "dir/new.txt": "hello\nworld\n"},
+		},
+		{
+			name:    "create over an existing file",
+			files:   map[string]string{"a.txt": "a\n"},
+			diff:    "diff --git a/a.txt b/a.txt\nnew file mode 100644\n--- /dev/null\n+++ b/a.txt\n@@ -0,0 +1 @@\n+b\n",
+			actions: []string{"create"},
+		},
+		{
+			name:    "delete",
+			files:   map[string]string{"a.txt": "a\n", "b.txt": "one\ntwo\n"},
+			diff:    "diff --git a/b.txt b/b.txt\ndeleted file mode 100644\n--- a/b.txt\n+++ /dev/null\n@@ -1,2 +0,0 @@\n-one\n-two\n",
+			applied: true,
+			actions: []string{"delete"},
+			want:    map[string]string{"a.txt": "a\n"},
+		},
+		{
+			name:    "delete with content left",
+			files:   map[string]string{"b.txt": "one\ntwo\nthree\n"},
+			diff:    "diff --git a/b.txt b/b.txt\ndeleted file mode 100644\n--- a/b.txt\n+++ /dev/null\n@@ -1,2 +0,0 @@\n-one\n-two\n",
+			actions: []string{"delete"},
+		},
+		{
+			name:    "rename with changes",
+			files:   map[string]string{"old.txt": "keep\nchange\n"},
+			diff:    "diff --git a/old.txt b/sub/new.txt\nsimilarity index 50%\nrename from old.txt\nrename to sub/new.txt\n--- a/old.txt\n+++ b/sub/new.txt\n@@ -1,2 +1,2 @@\n keep\n-change\n+changed\n",
+			applied: true,
+			actions: []string{"rename"},
+			want:    map[string]string{"sub/new.txt": "keep\nchanged\n"},
+		},
+		{
+			name:    "rename onto an existing file",
+			files:   map[string]string{"old.txt": "a\n", "new.txt": "b\n"},
+			diff:    "diff --git a/old.txt b/new.txt\nsimilarity index 100%\nrename from old.txt\nrename to new.txt\n",
+			actions: []string{"rename"},
+		},
+		{
+			name:    "copy",
+			files:   map[string]string{"src.txt": "keep\nchange\n"},
+			diff:    "diff --git a/src.txt b/dst.txt\nsimilarity index 50%\ncopy from src.txt\ncopy to dst.txt\n--- a/src.txt\n+++ b/dst.txt\n@@ -1,2 +1,2 @@\n keep\n-change\n+changed\n",
+			applied: true,
+			actions: []string{"copy"},
+			want:    map[string]string{"src.txt": "keep\nchange\n", "dst.txt": "keep\nchanged\n"},
+		},
+		{
+			name:    "one failing file writes nothing",
+			files:   map[string]string{"a.txt": "a\n", "b.txt": "b\n"},
+			diff:    "--- a/a.txt\n+++ b/a.txt\n@@ -1 +1 @@\n-a\n+A\n--- a/b.txt\n+++ b/b.txt\n@@ -1 +1 @@\n-x\n+X\n",
+			actions: []string{"modify", "modify"},
+		},
+		{
+			name:    "dry run",
+			files:   map[string]string{"a.txt": "a\n"},
+			diff:    "--- a/a.txt\n+++ b/a.txt\n@@ -1 +1 @@\n-a\n+A\n",
+			opts:    ApplyDiffOptions{DryRun: true},
+			actions: []string{"modify"},
+		},
+		{
+			name:    "path outside the project",
+			files:   map[string]string{"a.txt": "a\n"},
+			diff:    "--- a/../a.txt\n+++ b/../a.txt\n@@ -1 +1 @@\n-a\n+A\n",
+			actions: []string{"modify"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			writeTestFiles(t, root, tt.files)
+			patch, err := unidiff.Parse(tt.diff)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+
+			result := applyPatch(root, patch, tt.opts)
+			if result.Applied != tt.applied {
+				t.Errorf("Applied = %v, want %v (error %q)", result.Applied, tt.applied, result.Error)
+			}
+			if len(result.Files) != len(tt.actions) {
+				t.Fatalf("%d file results, want %d", len(result.Files), len(tt.actions))
+			}
+			for i, f := range result.Files {
+				if f.Action != tt.actions[i] {
+					t.Errorf("file %d action = %q, want %q", i, f.Action, tt.actions[i])
+				}
+			}
+
+			want := tt.want
+			if want == nil {
+				want = tt.files
+			}
+			got := readTestFiles(t, root)
+			if len(got) != len(want) {
+				t.Errorf("files after apply = %q, want %q", got, want)
+			}
+			for name, content := range want {
+				if got[name] != content {
+					t.Errorf("%s = %q, want %q", name, got[name], content)
+				}
+			}
+		})
+	}
+}
+
+func TestApplyHunksKeepsLineEndings(t *testing.T) {
+	tests := []struct {
+		name, content, diff, want string
+	}{
+		{
+			name:    "CRLF file, LF diff",
+			content: "one\r\ntwo\r\n",
+			diff:    "--- a/a\n+++ b/a\n@@ -1,2 +1,2 @@\n one\n-two\n+TWO\n",
+			want:    "one\r\nTWO\r\n",
+		},
+		{
+			name:    "add a final newline",
+			content: "one\ntwo",
+			diff:    "--- a/a\n+++ b/a\n@@ -1,2 +1,2 @@\n one\n-two\n\\ No newline at end of file\n+two\n",
+			want:    "one\ntwo\n",
+		},
+		{
+			name:    "remove the final newline",
+			content: "one\ntwo\n",
+			diff:    "--- a/a\n+++ b/a\n@@ -1,2 +1,2 @@\n one\n-two\n+two\n\\ No newline at end of file\n",
+			want:    "one\ntwo",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patch, err := unidiff.ParseLenient(tt.diff)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, _, err := applyHunks(tt.content, patch.Files[0].Hunks, ApplyDiffOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"strings"
+
+	"shotgun_code/internal/unidiff"
+)
+
+// --- Fuzzy hunk location for hand- or model-written diffs ---
+
+// normalizeWhitespace collapses runs of whitespace so lines that differ only
+// in indentation or spacing compare equal.
+func normalizeWhitespace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// locateHunkFuzzy finds the position at or after minPos where the old side of
+// h best matches lines. Deleted lines must match ignoring whitespace; up to
+// fuzz context lines may differ, but never all of them. Among candidates the
+// highest confidence wins, then the one closest to expected. Confidence is the
+// share of old lines that match, counting a whitespace-only difference as half.
+func locateHunkFuzzy(lines []string, h *unidiff.Hunk, expected, minPos, fuzz int) (pos int, confidence float64, ok bool) {
+	type oldLine struct {
+		text, normalized string
+		context          bool
+	}
+	var old []oldLine
+	for _, l := range h.Lines {
+		if l.Kind == unidiff.HunkLineContext || l.Kind == unidiff.HunkLineDelete {
+			text := strings.TrimSuffix(l.Text, "\r")
+			old = append(old, oldLine{text, normalizeWhitespace(text), l.Kind == unidiff.HunkLineContext})
+		}
+	}
+	if len(old) == 0 || len(old) > len(lines)-minPos {
+		return 0, 0, false
+	}
+
+	normalized := make([]string, len(lines))
+	for i, l := range lines[minPos:] {
+		normalized[minPos+i] = normalizeWhitespace(l)
+	}
+
+	bestScore, bestDist := -1.0, 0
+	for p := minPos; p+len(old) <= len(lines); p++ {
+		score, mismatches := 0.0, 0
+		for i, o := range old {
+			switch {
+			case strings.TrimSuffix(lines[p+i], "\r") == o.text:
+				score++
+			case normalized[p+i] == o.normalized:
+				score += 0.5
+			case o.context && mismatches < fuzz:
+				mismatches++
+			default:
+				score = -1
+			}
+			if score < 0 {
+				break
+			}
+		}
+		if score < 0 || mismatches == len(old) {
+			continue
+		}
+		dist := p - expected
+		if dist < 0 {
+			dist = -dist
+		}
+		if score > bestScore || score == bestScore && dist < bestDist {
+			pos, bestScore, bestDist = p, score, dist
+		}
+	}
+	if bestScore < 0 {
+		return 0, 0, false
+	}
+	return pos, bestScore / float64(len(old)), true
+}
+
+func leadingWhitespace(s string) string {
+	return s[:len(s)-len(strings.TrimLeft(s, " \t"))]
+}
+
+// fuzzyIndents maps the indentation used by the old lines of h to the
+// indentation of the file lines they matched at pos, so added lines can follow
+// the file's style when the patch drifted (for example spaces for tabs).
+func fuzzyIndents(lines []string, h *unidiff.Hunk, pos int) map[string]string {
+	indents := make(map[string]string)
+	k := pos
+	for _, l := range h.Lines {
+		if l.Kind != unidiff.HunkLineContext && l.Kind != unidiff.HunkLineDelete {
+			continue
+		}
+		fileLine := strings.TrimSuffix(lines[k], "\r")
+		patchLine := strings.TrimSuffix(l.Text, "\r")
+		if fileLine != patchLine && normalizeWhitespace(fileLine) == normalizeWhitespace(patchLine) {
+			indents[leadingWhitespace(patchLine)] = leadingWhitespace(fileLine)
+		}
+		k++
+	}
+	return indents
+}
+
+// reindent replaces the indentation of an added line if it appears in indents.
+func reindent(line string, indents map[string]string) string {
+	indent := leadingWhitespace(line)
+	if to, ok := indents[indent]; ok {
+		return to + line[len(indent):]
+	}
+	return line
+}
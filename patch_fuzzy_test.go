@@ -0,0 +1,145 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"shotgun_code/internal/unidiff"
+)
+
+func TestLocateHunkFuzzy(t *testing.T) {
+	tests := []struct {
+		name       string
+		file       string
+		hunk       string // Hunk body
+		expected   int
+		fuzz       int
+		ok         bool
+		pos        int
+		confidence float64
+	}{
+		{
+			name: "exact", file: "a\nb\nc\n", hunk: " a\n-b\n+B\n c\n",
+			ok: true, pos: 0, confidence: 1,
+		},
+		{
+			name: "indentation differs", file: "x\n\tfoo()\n\tbar()\n", hunk: "     foo()\n-    bar()\n+    baz()\n",
+			ok: true, pos: 1, confidence: 0.5,
+		},
+		{
+			name: "one context line differs", file: "a\nb\nc\n", hunk: " a\n X\n-c\n+C\n", fuzz: 1,
+			ok: true, pos: 0, confidence: 2.0 / 3,
+		},
+		{
+			name: "context differs without fuzz", file: "a\nb\nc\n", hunk: " a\n X\n-c\n+C\n",
+		},
+		{
+			name: "deleted line differs", file: "a\nb\nc\n", hunk: " a\n-X\n+C\n c\n", fuzz: 2,
+		},
+		{
+			name: "all context differs", file: "a\nb\n", hunk: " X\n+new\n", fuzz: 1,
+		},
+		{
+			name: "closest to expected on a tie", file: "}\nx\n}\nx\n}\n", hunk: " }\n-x\n", expected: 2,
+			ok: true, pos: 2, confidence: 1,
+		},
+		{
+			name: "better match wins over distance", file: "  a\n  b\nz\na\nb\n", hunk: " a\n-b\n",
+			ok: true, pos: 3, confidence: 1,
+		},
+		{
+			name: "hunk longer than the file", file: "a\n", hunk: " a\n-b\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patch, err := unidiff.ParseLenient("--- a/f\n+++ b/f\n@@ -1 +1 @@\n" + tt.hunk)
+			if err != nil {
+				t.Fatal(err)
+			}
+			lines, _ := splitFileLines(tt.file)
+			pos, confidence, ok := locateHunkFuzzy(lines, patch.Files[0].Hunks[0], tt.expected, 0, tt.fuzz)
+			if ok != tt.ok {
+				t.Fatalf("ok = %v, want %v", ok, tt.ok)
+			}
+			if !ok {
+				return
+			}
+			if pos != tt.pos || math.Abs(confidence-tt.confidence) > 1e-9 {
+				t.Errorf("got pos %d confidence %.3f, want pos %d confidence %.3f", pos, confidence, tt.pos, tt.confidence)
+			}
+		})
+	}
+}
+
+func TestApplyHunksFuzzy(t *testing.T) {
+	tests := []struct {
+		name       string
+		content    string
+		diff       string
+		fuzz       int
+		want       string
+		line       int
+		offset     int
+		confidence float64
+	}{
+		{
+			name:    "offset",
+			content: "new\nlines\nabove\na\nb\nc\n",
+			diff:    "@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+			want:    "new\nlines\nabove\na\nB\nc\n",
+			line:    4, offset: 3, confidence: 1,
+		},
+		{
+			name:    "tabs for spaces",
+			content: "func f() {\n\tx := 1\n\treturn\n}\n",
+			diff:    "@@ -1,4 +1,5 @@\n func f() {\n     x := 1\n+    y := 2\n     return\n }\n",
+			want:    "func f() {\n\tx := 1\n\ty := 2\n\treturn\n}\n",
+			line:    1, confidence: 0.75,
+		},
+		{
+			name:    "stale context with fuzz",
+			content: "a\nchanged\nc\nd\n",
+			diff:    "@@ -1,4 +1,4 @@\n a\n b\n-c\n+C\n d\n",
+			fuzz:    1,
+			want:    "a\nchanged\nC\nd\n",
+			line:    1, confidence: 0.75,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patch, err := unidiff.ParseLenient("--- a/f\n+++ b/f\n" + tt.diff)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, results, err := applyHunks(tt.content, patch.Files[0].Hunks, ApplyDiffOptions{Fuzzy: true, Fuzz: tt.fuzz})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+			r := results[0]
+			if r.Line != tt.line || r.Offset != tt.offset || math.Abs(r.Confidence-tt.confidence) > 1e-9 {
+				t.Errorf("line %d offset %d confidence %.3f, want line %d offset %d confidence %.3f",
+					r.Line, r.Offset, r.Confidence, tt.line, tt.offset, tt.confidence)
+			}
+		})
+	}
+}
+
+func TestApplyHunksExactFailsWhereFuzzyApplies(t *testing.T) {
+	patch, err := unidiff.ParseLenient("--- a/f\n+++ b/f\n@@ -1,2 +1,2 @@\n     x\n-    y\n+    z\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := "\tx\n\ty\n"
+	if _, results, err := applyHunks(content, patch.Files[0].Hunks, ApplyDiffOptions{}); err == nil || results[0].Applied {
+		t.Errorf("exact apply accepted a whitespace mismatch")
+	}
+	got, _, err := applyHunks(content, patch.Files[0].Hunks, ApplyDiffOptions{Fuzzy: true})
+	if err != nil || !strings.Contains(got, "\tz\n") {
+		t.Errorf("fuzzy apply = %q, %v", got, err)
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// --- Selection profiles ---
+
+// SelectionProfile is a named, reusable file selection for a project.
+type SelectionProfile struct {
+	Name          string                   `json:"name"`
+	IncludedPaths []string                 `json:"includedPaths"`
+	ExcludedPaths []string                 `json:"excludedPaths"`
+	Patterns      []string                 `json:"patterns"`    // Extra ignore-style patterns applied on top of the project rules
+	Options       ContextGenerationOptions `json:"options"`     // Output format (render mode, transforms, ...)
+	TokenBudget   int                      `json:"tokenBudget"` // 0 means no budget
+	UpdatedAt     time.Time                `json:"updatedAt"`
+}
+
+// ProjectProfiles holds the selection profiles of one project root.
+type ProjectProfiles struct {
+	Profiles       []SelectionProfile `json:"profiles"`
+	DefaultProfile string             `json:"defaultProfile,omitempty"`
+}
+
+// profileKey normalizes a project root so the same repo always maps to the same entry.
+func profileKey(rootDir string) string {
+	return filepath.Clean(rootDir)
+}
+
+// projectProfiles returns the profiles of a project root, adding an empty
+// entry when create is set.
+func (s *AppSettings) projectProfiles(rootDir string, create bool) *ProjectProfiles {
+	key := profileKey(rootDir)
+	pp := s.SelectionProfiles[key]
+	if pp == nil && create {
+		if s.SelectionProfiles == nil {
+			s.SelectionProfiles = make(map[string]*ProjectProfiles)
+		}
+		pp = &ProjectProfiles{}
+		s.SelectionProfiles[key] = pp
+	}
+	return pp
+}
+
+func (pp *ProjectProfiles) find(name string) int {
+	for i, p := range pp.Profiles {
+		if p.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// saveSelectionProfile creates or replaces the profile with the same name.
+func (s *AppSettings) saveSelectionProfile(rootDir string, profile SelectionProfile) {
+	pp := s.projectProfiles(rootDir, true)
+	if i := pp.find(profile.Name); i >= 0 {
+		pp.Profiles[i] = profile
+	} else {
+		pp.Profiles = append(pp.Profiles, profile)
+	}
+}
+
+// loadSelectionProfile returns a copy of a saved profile.
+func (s *AppSettings) loadSelectionProfile(rootDir string, name string) (*SelectionProfile, error) {
+	pp := s.projectProfiles(rootDir, false)
+	if pp == nil {
+		return nil, fmt.Errorf("no selection profiles saved for %s", rootDir)
+	}
+	i := pp.find(name)
+	if i < 0 {
+		return nil, fmt.Errorf("selection profile '%s' not found", name)
+	}
+	profile := pp.Profiles[i]
+	return &profile, nil
+}
+
+// renameSelectionProfile renames a profile, keeping it the default if it was.
+func (s *AppSettings) renameSelectionProfile(rootDir string, oldName string, newName string) error {
+	pp := s.projectProfiles(rootDir, false)
+	if pp == nil || pp.find(oldName) < 0 {
+		return fmt.Errorf("selection profile '%s' not found", oldName)
+	}
+	if oldName == newName {
+		return nil
+	}
+	if pp.find(newName) >= 0 {
+		return fmt.Errorf("selection profile '%s' already exists", newName)
+	}
+
+	i := pp.find(oldName)
+	pp.Profiles[i].Name = newName
+	pp.Profiles[i].UpdatedAt = time.Now()
+	if pp.DefaultProfile == oldName {
+		pp.DefaultProfile = newName
+	}
+	return nil
+}
+
+// deleteSelectionProfile removes a profile and clears it as default. The
+// project entry goes away with its last profile.
+func (s *AppSettings) deleteSelectionProfile(rootDir string, name string) error {
+	pp := s.projectProfiles(rootDir, false)
+	if pp == nil || pp.find(name) < 0 {
+		return fmt.Errorf("selection profile '%s' not found", name)
+	}
+	i := pp.find(name)
+	pp.Profiles = append(pp.Profiles[:i], pp.Profiles[i+1:]...)
+	if pp.DefaultProfile == name {
+		pp.DefaultProfile = ""
+	}
+	if len(pp.Profiles) == 0 {
+		delete(s.SelectionProfiles, profileKey(rootDir))
+	}
+	return nil
+}
+
+// setDefaultSelectionProfile marks a profile as the default, or clears the
+// default for an empty name. It reports whether there was anything to change.
+func (s *AppSettings) setDefaultSelectionProfile(rootDir string, name string) (bool, error) {
+	pp := s.projectProfiles(rootDir, false)
+	if name != "" && (pp == nil || pp.find(name) < 0) {
+		return false, fmt.Errorf("selection profile '%s' not found", name)
+	}
+	if pp == nil {
+		return false, nil
+	}
+	pp.DefaultProfile = name
+	return true, nil
+}
+
+// defaultSelectionProfile returns a copy of the project's default profile, or nil.
+func (s *AppSettings) defaultSelectionProfile(rootDir string) *SelectionProfile {
+	pp := s.projectProfiles(rootDir, false)
+	if pp == nil || pp.DefaultProfile == "" {
+		return nil
+	}
+	if i := pp.find(pp.DefaultProfile); i >= 0 {
+		profile := pp.Profiles[i]
+		return &profile
+	}
+	return nil
+}
+
+// ListSelectionProfiles returns the saved profiles for a project, sorted by name.
+func (a *App) ListSelectionProfiles(rootDir string) []SelectionProfile {
+	pp := a.settings.projectProfiles(rootDir, false)
+	if pp == nil {
+		return []SelectionProfile{}
+	}
+	profiles := append([]SelectionProfile(nil), pp.Profiles...)
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].Name < profiles[j].Name })
+	return profiles
+}
+
+// SaveSelectionProfile creates or replaces the profile with the same name.
+func (a *App) SaveSelectionProfile(rootDir string, profile SelectionProfile) error {
+	profile.Name = strings.TrimSpace(profile.Name)
+	if profile.Name == "" {
+		return fmt.Errorf("profile name is empty")
+	}
+	profile.UpdatedAt = time.Now()
+
+	a.settings.saveSelectionProfile(rootDir, profile)
+	if err := a.saveSettings(); err != nil {
+		return fmt.Errorf("failed to save selection profile: %w", err)
+	}
+	runtime.LogInfof(a.ctx, "Selection profile '%s' saved for %s", profile.Name, rootDir)
+	return nil
+}
+
+// LoadSelectionProfile returns a saved profile by name.
+func (a *App) LoadSelectionProfile(rootDir string, name string) (*SelectionProfile, error) {
+	return a.settings.loadSelectionProfile(rootDir, name)
+}
+
+// RenameSelectionProfile renames a profile, keeping it the default if it was.
+func (a *App) RenameSelectionProfile(rootDir string, oldName string, newName string) error {
+	newName = strings.TrimSpace(newName)
+	if newName == "" {
+		return fmt.Errorf("profile name is empty")
+	}
+	if err := a.settings.renameSelectionProfile(rootDir, oldName, newName); err != nil || oldName == newName {
+		return err
+	}
+	if err := a.saveSettings(); err != nil {
+		return fmt.Errorf("failed to save renamed selection profile: %w", err)
+	}
+	return nil
+}
+
+// DeleteSelectionProfile removes a profile (and clears it as default).
+func (a *App) DeleteSelectionProfile(rootDir string, name string) error {
+	if err := a.settings.deleteSelectionProfile(rootDir, name); err != nil {
+		return err
+	}
+	if err := a.saveSettings(); err != nil {
+		return fmt.Errorf("failed to save settings after deleting selection profile: %w", err)
+	}
+	return nil
+}
+
+// SetDefaultSelectionProfile marks the profile applied when the project is opened.
+// An empty name clears the default.
+func (a *App) SetDefaultSelectionProfile(rootDir string, name string) error {
+	changed, err := a.settings.setDefaultSelectionProfile(rootDir, name)
+	if err != nil || !changed {
+		return err
+	}
+	if err := a.saveSettings(); err != nil {
+		return fmt.Errorf("failed to save default selection profile: %w", err)
+	}
+	return nil
+}
+
+// GetDefaultSelectionProfile returns the project's default profile, or nil if none is set.
+func (a *App) GetDefaultSelectionProfile(rootDir string) *SelectionProfile {
+	return a.settings.defaultSelectionProfile(rootDir)
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// reloadSettings saves and loads settings as a restart would.
+func reloadSettings(t *testing.T, s AppSettings) AppSettings {
+	t.Helper()
+	data, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reloaded, _, err := decodeSettings(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return reloaded
+}
+
+func TestSelectionProfilesRoundTrip(t *testing.T) {
+	var s AppSettings
+	backend := SelectionProfile{
+		Name:          "backend",
+		IncludedPaths: []string{"cmd", "internal"},
+		ExcludedPaths: []string{"frontend"},
+		Patterns:      []string{"*_test.go"},
+		Options:       ContextGenerationOptions{RenderMode: RenderModeOutline, FocusPaths: []string{"internal/api"}, Transforms: []string{TransformStripComments}},
+		TokenBudget:   50000,
+		UpdatedAt:     time.Date(2024, 5, 10, 12, 0, 0, 0, time.UTC),
+	}
+	s.saveSelectionProfile("/src/app/", backend)
+	s.saveSelectionProfile("/src/app", SelectionProfile{Name: "web", ExcludedPaths: []string{"cmd"}})
+	if changed, err := s.setDefaultSelectionProfile("/src/app", "backend"); err != nil || !changed {
+		t.Fatalf("set default = %v, %v", changed, err)
+	}
+
+	s = reloadSettings(t, s)
+	got, err := s.loadSelectionProfile("/src/app", "backend")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(*got, backend) {
+		t.Errorf("loaded profile = %+v, want %+v", *got, backend)
+	}
+	if def := s.defaultSelectionProfile("/src/app/"); def == nil || def.Name != "backend" {
+		t.Errorf("default profile = %+v, want backend", def)
+	}
+
+	// Switching the default and replacing a profile by name
+	if _, err := s.setDefaultSelectionProfile("/src/app", "web"); err != nil {
+		t.Fatal(err)
+	}
+	s.saveSelectionProfile("/src/app", SelectionProfile{Name: "web", Patterns: []string{"*.css"}})
+	s = reloadSettings(t, s)
+	if def := s.defaultSelectionProfile("/src/app"); def == nil || def.Name != "web" || !reflect.DeepEqual(def.Patterns, []string{"*.css"}) {
+		t.Errorf("default profile = %+v, want the replaced web profile", def)
+	}
+	if _, err := s.setDefaultSelectionProfile("/src/app", "missing"); err == nil {
+		t.Error("a missing profile was made the default")
+	}
+	if changed, err := s.setDefaultSelectionProfile("/src/other", ""); changed || err != nil {
+		t.Errorf("clearing the default of a project without profiles = %v, %v; want nothing to change", changed, err)
+	}
+
+	if err := s.renameSelectionProfile("/src/app", "web", "backend"); err == nil {
+		t.Error("a profile was renamed over another")
+	}
+	if err := s.renameSelectionProfile("/src/app", "web", "frontend"); err != nil {
+		t.Fatal(err)
+	}
+	if def := s.defaultSelectionProfile("/src/app"); def == nil || def.Name != "frontend" {
+		t.Errorf("default after rename = %+v, want frontend", def)
+	}
+
+	if err := s.deleteSelectionProfile("/src/app", "backend"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.deleteSelectionProfile("/src/app", "backend"); err == nil {
+		t.Error("a deleted profile was deleted again")
+	}
+	a := &App{settings: reloadSettings(t, s)}
+	if got := profileNames(a.settings.SelectionProfiles["/src/app"]); !reflect.DeepEqual(got, []string{"frontend"}) {
+		t.Errorf("profiles after delete = %v, want [frontend]", got)
+	}
+	if listed := a.ListSelectionProfiles("/src/app"); len(listed) != 1 || listed[0].Name != "frontend" {
+		t.Errorf("listed profiles = %+v", listed)
+	}
+}
+
+func TestDeleteActiveSelectionProfile(t *testing.T) {
+	var s AppSettings
+	s.saveSelectionProfile("/src/app", SelectionProfile{Name: "a"})
+	s.saveSelectionProfile("/src/app", SelectionProfile{Name: "b"})
+	if _, err := s.setDefaultSelectionProfile("/src/app", "b"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.deleteSelectionProfile("/src/app", "b"); err != nil {
+		t.Fatal(err)
+	}
+	s = reloadSettings(t, s)
+	if pp := s.SelectionProfiles["/src/app"]; pp == nil || pp.DefaultProfile != "" {
+		t.Errorf("project profiles = %+v, want no default", pp)
+	}
+	if def := s.defaultSelectionProfile("/src/app"); def != nil {
+		t.Errorf("default profile = %+v, want none", def)
+	}
+
+	if err := s.deleteSelectionProfile("/src/app", "a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.SelectionProfiles["/src/app"]; ok {
+		t.Error("the project entry outlived its last profile")
+	}
+	if listed := (&App{settings: s}).ListSelectionProfiles("/src/app"); listed == nil || len(listed) != 0 {
+		t.Errorf("listed profiles = %v, want an empty list", listed)
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// --- Layered prompt rules ---
+
+// Prompt rule layers, merged in this order: global, then project, then one
+// layer per language found in the selection (most files first).
+const (
+	PromptRulesScopeGlobal   = "global"
+	PromptRulesScopeProject  = "project"
+	PromptRulesScopeLanguage = "language"
+)
+
+// PromptRulesLayer is one non-empty source of rules.
+type PromptRulesLayer struct {
+	Scope string `json:"scope"`
+	Key   string `json:"key"` // Project root or language; empty for the global layer
+	Rules string `json:"rules"`
+}
+
+// DetectedLanguage counts the selected files of one language.
+type DetectedLanguage struct {
+	Language string `json:"language"`
+	Files    int    `json:"files"`
+}
+
+// PromptRulesPreview shows the layers that apply to a selection and their merged text.
+type PromptRulesPreview struct {
+	Languages []DetectedLanguage `json:"languages"`
+	Layers    []PromptRulesLayer `json:"layers"`
+	Merged    string             `json:"merged"`
+}
+
+// languageExts maps the languages used as rule layer keys to their file extensions.
+var languageExts = map[string][]string{
+	"go":         {".go"},
+	"python":     {".py", ".pyi"},
+	"javascript": {".js", ".jsx", ".mjs", ".cjs"},
+	"typescript": {".ts", ".tsx", ".mts", ".cts"},
+	"vue":        {".vue"},
+	"rust":       {".rs"},
+	"java":       {".java"},
+	"kotlin":     {".kt", ".kts"},
+	"scala":      {".scala"},
+	"c":          {".c", ".h"},
+	"cpp":        {".cc", ".cpp", ".cxx", ".hpp", ".hh"},
+	"csharp":     {".cs"},
+	"swift":      {".swift"},
+	"ruby":       {".rb"},
+	"php":        {".php"},
+	"shell":      {".sh", ".bash", ".zsh"},
+	"sql":        {".sql"},
+	"lua":        {".lua"},
+	"css":        {".css", ".scss", ".less"},
+	"html":       {".html", ".htm"},
+}
+
+var languageByExt = func() map[string]string {
+	byExt := make(map[string]string)
+	for lang, exts := range languageExts {
+		for _, ext := range exts {
+			byExt[ext] = lang
+		}
+	}
+	return byExt
+}()
+
+// languageForPath returns the language of a source file, or "" if it is not recognized.
+func languageForPath(relPath string) string {
+	return languageByExt[strings.ToLower(path.Ext(filepath.ToSlash(relPath)))]
+}
+
+// detectSelectionLanguages counts the languages of the files that would be
+// included in the context for rootDir with the given exclusions.
+func (a *App) detectSelectionLanguages(rootDir string, excludedPaths []string) ([]DetectedLanguage, error) {
+	cr, err := a.contextRootFor(WorkspaceRoot{Alias: filepath.Base(rootDir), RootDir: filepath.Clean(rootDir), ExcludedPaths: excludedPaths})
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int)
+	err = filepath.WalkDir(cr.dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil // Unreadable entries are skipped, as in context generation
+		}
+		if p == cr.dir {
+			return nil
+		}
+		relPath, _ := filepath.Rel(cr.dir, p)
+		if d.Name() == ".git" || cr.isExcluded(relPath, d.IsDir()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if lang := languageForPath(relPath); !d.IsDir() && lang != "" {
+			counts[lang]++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan %s for languages: %w", rootDir, err)
+	}
+
+	languages := make([]DetectedLanguage, 0, len(counts))
+	for lang, n := range counts {
+		languages = append(languages, DetectedLanguage{Language: lang, Files: n})
+	}
+	sort.Slice(languages, func(i, j int) bool {
+		if languages[i].Files != languages[j].Files {
+			return languages[i].Files > languages[j].Files
+		}
+		return languages[i].Language < languages[j].Language
+	})
+	return languages, nil
+}
+
+// mergePromptRules joins the layers in order. Language layers get a heading so
+// the model knows which files they apply to; the placeholder global rules are
+// dropped as soon as any other layer exists.
+func mergePromptRules(layers []PromptRulesLayer) string {
+	var parts []string
+	for _, layer := range layers {
+		rules := strings.TrimSpace(layer.Rules)
+		if layer.Scope == PromptRulesScopeGlobal && rules == defaultCustomPromptRulesContent && len(layers) > 1 {
+			continue
+		}
+		if layer.Scope == PromptRulesScopeLanguage {
+			rules = fmt.Sprintf("For %s files:\n%s", layer.Key, rules)
+		}
+		parts = append(parts, rules)
+	}
+	if len(parts) == 0 {
+		return defaultCustomPromptRulesContent
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// PreviewPromptRules returns the rule layers that apply to the current
+// selection and the merged rules that will be used in the prompt.
+func (a *App) PreviewPromptRules(rootDir string, excludedPaths []string) (*PromptRulesPreview, error) {
+	languages, err := a.detectSelectionLanguages(rootDir, excludedPaths)
+	if err != nil {
+		return nil, err
+	}
+
+	var layers []PromptRulesLayer
+	addLayer := func(scope, key, rules string) {
+		if strings.TrimSpace(rules) != "" {
+			layers = append(layers, PromptRulesLayer{Scope: scope, Key: key, Rules: rules})
+		}
+	}
+	addLayer(PromptRulesScopeGlobal, "", a.GetCustomPromptRules())
+	addLayer(PromptRulesScopeProject, profileKey(rootDir), a.settings.ProjectPromptRules[profileKey(rootDir)])
+	for _, lang := range languages {
+		addLayer(PromptRulesScopeLanguage, lang.Language, a.settings.LanguagePromptRules[lang.Language])
+	}
+	if layers == nil {
+		layers = []PromptRulesLayer{}
+	}
+	return &PromptRulesPreview{Languages: languages, Layers: layers, Merged: mergePromptRules(layers)}, nil
+}
+
+// GetProjectPromptRules returns the prompt rules of a project root.
+func (a *App) GetProjectPromptRules(rootDir string) string {
+	return a.settings.ProjectPromptRules[profileKey(rootDir)]
+}
+
+// SetProjectPromptRules saves the prompt rules of a project root. Empty rules remove the layer.
+func (a *App) SetProjectPromptRules(rootDir string, rules string) error {
+	key := profileKey(rootDir)
+	if strings.TrimSpace(rules) == "" {
+		delete(a.settings.ProjectPromptRules, key)
+	} else {
+		if a.settings.ProjectPromptRules == nil {
+			a.settings.ProjectPromptRules = make(map[string]string)
+		}
+		a.settings.ProjectPromptRules[key] = rules
+	}
+	if err := a.saveSettings(); err != nil {
+		return fmt.Errorf("failed to save project prompt rules: %w", err)
+	}
+	runtime.LogInfof(a.ctx, "Project prompt rules saved for %s", key)
+	return nil
+}
+
+// GetLanguagePromptRules returns the prompt rules of every language that has some.
+func (a *App) GetLanguagePromptRules() map[string]string {
+	rules := make(map[string]string, len(a.settings.LanguagePromptRules))
+	for lang, r := range a.settings.LanguagePromptRules {
+		rules[lang] = r
+	}
+	return rules
+}
+
+// SetLanguagePromptRules saves the prompt rules of a language (as reported in
+// PromptRulesPreview.Languages). Empty rules remove the layer.
+func (a *App) SetLanguagePromptRules(language string, rules string) error {
+	language = strings.ToLower(strings.TrimSpace(language))
+	if language == "" {
+		return fmt.Errorf("language is empty")
+	}
+	// Rules under any other key would never be applied. Stored ones, e.g. from
+	// an imported bundle, can still be removed.
+	_, stored := a.settings.LanguagePromptRules[language]
+	if _, known := languageExts[language]; !known && !(stored && strings.TrimSpace(rules) == "") {
+		return fmt.Errorf("unknown language %q", language)
+	}
+	if strings.TrimSpace(rules) == "" {
+		delete(a.settings.LanguagePromptRules, language)
+	} else {
+		if a.settings.LanguagePromptRules == nil {
+			a.settings.LanguagePromptRules = make(map[string]string)
+		}
+		a.settings.LanguagePromptRules[language] = rules
+	}
+	if err := a.saveSettings(); err != nil {
+		return fmt.Errorf("failed to save %s prompt rules: %w", language, err)
+	}
+	runtime.LogInfof(a.ctx, "Prompt rules saved for language %s", language)
+	return nil
+}
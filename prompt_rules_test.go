@@ -0,0 +1,92 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMergePromptRules(t *testing.T) {
+	tests := []struct {
+		name   string
+		layers []PromptRulesLayer
+		want   string
+	}{
+		{name: "no layers", want: defaultCustomPromptRulesContent},
+		{
+			name:   "placeholder alone",
+			layers: []PromptRulesLayer{{Scope: PromptRulesScopeGlobal, Rules: defaultCustomPromptRulesContent}},
+			want:   defaultCustomPromptRulesContent,
+		},
+		{
+			name: "placeholder dropped for other layers",
+			layers: []PromptRulesLayer{
+				{Scope: PromptRulesScopeGlobal, Rules: defaultCustomPromptRulesContent},
+				{Scope: PromptRulesScopeProject, Key: "/src/app", Rules: "Use tabs."},
+			},
+			want: "Use tabs.",
+		},
+		{
+			name: "all layers in order",
+			layers: []PromptRulesLayer{
+				{Scope: PromptRulesScopeGlobal, Rules: "Be brief.\n"},
+				{Scope: PromptRulesScopeProject, Key: "/src/app", Rules: "  Use tabs."},
+				{Scope: PromptRulesScopeLanguage, Key: "go", Rules: "Wrap errors."},
+				{Scope: PromptRulesScopeLanguage, Key: "python", Rules: "Use type hints."},
+			},
+			want: "Be brief.\n\nUse tabs.\n\nFor go files:\nWrap errors.\n\nFor python files:\nUse type hints.",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mergePromptRules(tt.layers); got != tt.want {
+				t.Errorf("merged = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetectSelectionLanguages(t *testing.T) {
+	root := t.TempDir()
+	writeTestFiles(t, root, map[string]string{
+		".gitignore":       "build/\n",
+		"main.go":          "",
+		"util.go":          "",
+		"cmd/tool/main.go": "",
+		"scripts/run.py":   "",
+		"scripts/GEN.PY":   "",
+		"web/app.ts":       "",
+		"web/legacy.js":    "",
+		"build/out.js":     "",
+		"README.md":        "",
+		".git/hooks/a.sh":  "",
+	})
+
+	a := &App{useGitignore: true}
+	got, err := a.detectSelectionLanguages(root, []string{"web/legacy.js"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []DetectedLanguage{{Language: "go", Files: 3}, {Language: "python", Files: 2}, {Language: "typescript", Files: 1}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("languages = %+v, want %+v", got, want)
+	}
+
+	if _, err := a.detectSelectionLanguages(root+"/missing", nil); err == nil {
+		t.Error("a missing root was scanned")
+	}
+}
+
+func TestSetLanguagePromptRulesKeys(t *testing.T) {
+	a := &App{settings: AppSettings{LanguagePromptRules: map[string]string{"golang": "From an old bundle."}}}
+	for _, language := range []string{"", "  ", "golang ", "Go Lang", "markdown"} {
+		if err := a.SetLanguagePromptRules(language, "Rules."); err == nil {
+			t.Errorf("rules for %q were accepted", language)
+		}
+	}
+	if err := a.SetLanguagePromptRules("klingon", ""); err == nil {
+		t.Error("removing rules of an unknown language that has none succeeded")
+	}
+	if a.settings.LanguagePromptRules["golang"] != "From an old bundle." || len(a.settings.LanguagePromptRules) != 1 {
+		t.Errorf("language rules = %v, want them unchanged", a.settings.LanguagePromptRules)
+	}
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// --- Prompt templates ---
+
+// Templates whose name starts with this prefix are partials: they can be
+// included with {{template "_name" .}} but are not offered as prompts.
+const promptPartialPrefix = "_"
+
+const promptTemplateFileExt = ".tmpl"
+
+// PromptTemplate is a named text/template used to compose the Step 2 prompt.
+type PromptTemplate struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Body        string    `json:"body"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+// PromptVariables are the values available to a template as {{.Task}}, {{.Rules}}, etc.
+type PromptVariables struct {
+	Task    string            `json:"task"`
+	Rules   string            `json:"rules"`
+	Context string            `json:"context"` // Full generated context
+	Tree    string            `json:"tree"`    // File tree only; derived from Context when empty
+	Date    string            `json:"date"`    // Defaults to today (YYYY-MM-DD)
+	Vars    map[string]string `json:"vars"`    // User-defined variables, {{.Vars.name}}
+}
+
+// RenderedPrompt is a composed prompt with its token accounting.
+type RenderedPrompt struct {
+	Prompt         string         `json:"prompt"`
+	TotalTokens    int            `json:"totalTokens"`
+	TemplateTokens int            `json:"templateTokens"` // Tokens contributed by the template text and partials
+	VariableTokens map[string]int `json:"variableTokens"` // Tokens per variable, counting every use
+}
+
+var defaultPromptTemplates = []PromptTemplate{
+	{
+		Name:        "_context",
+		Description: "Project files and rules shared by the built-in templates",
+		Body: `## Rules
+{{.Rules}}
+
+## Project files
+{{.Context}}
+`,
+	},
+	{
+		Name:        "bug fix",
+		Description: "Find the root cause of a bug and fix it with a unified diff",
+		Body: `You are a senior engineer. Find the root cause of the bug described below and fix it.
+Answer with a short explanation followed by a single git-style unified diff.
+
+## Bug
+{{.Task}}
+
+{{template "_context" .}}`,
+	},
+	{
+		Name:        "refactor",
+		Description: "Refactor without changing behavior",
+		Body: `You are a senior engineer. Refactor the code as described below without changing its behavior.
+Answer with a single git-style unified diff.
+
+## Refactoring
+{{.Task}}
+
+{{template "_context" .}}`,
+	},
+	{
+		Name:        "write tests",
+		Description: "Add tests following the project's conventions",
+		Body: `You are a senior engineer. Write tests for the code described below, following the conventions of the existing tests.
+Answer with a single git-style unified diff.
+
+## What to test
+{{.Task}}
+
+{{template "_context" .}}`,
+	},
+}
+
+// promptTemplates returns the stored templates, or the built-in ones if none were ever saved.
+func (a *App) promptTemplates() []PromptTemplate {
+	if a.settings.PromptTemplates == nil {
+		return defaultPromptTemplates
+	}
+	return a.settings.PromptTemplates
+}
+
+func findPromptTemplate(templates []PromptTemplate, name string) int {
+	for i, t := range templates {
+		if t.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func validatePromptTemplateName(name string) error {
+	if name == "" {
+		return fmt.Errorf("template name is empty")
+	}
+	if strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+		return fmt.Errorf("invalid template name '%s'", name)
+	}
+	return nil
+}
+
+// parsePromptTemplates compiles every template into one set so they can include each other.
+func parsePromptTemplates(templates []PromptTemplate) (*template.Template, error) {
+	set := template.New("").Option("missingkey=zero")
+	for _, t := range templates {
+		if _, err := set.New(t.Name).Parse(t.Body); err != nil {
+			return nil, fmt.Errorf("template '%s': %w", t.Name, err)
+		}
+	}
+	return set, nil
+}
+
+// contextTree returns the file tree that precedes the first <file> block of a context.
+func contextTree(context string) string {
+	_, body, _ := splitManifestHeader(context)
+	if loc := contextFileStartRegex.FindStringIndex(body); loc != nil {
+		body = body[:loc[0]]
+	}
+	return strings.TrimRight(body, "\n")
+}
+
+// ListPromptTemplates returns all templates, including partials, sorted by name.
+func (a *App) ListPromptTemplates() []PromptTemplate {
+	templates := append([]PromptTemplate(nil), a.promptTemplates()...)
+	sort.Slice(templates, func(i, j int) bool { return templates[i].Name < templates[j].Name })
+	return templates
+}
+
+// SavePromptTemplate creates or replaces the template with the same name.
+// The whole set is compiled first so a broken template is never saved.
+func (a *App) SavePromptTemplate(t PromptTemplate) error {
+	t.Name = strings.TrimSpace(t.Name)
+	if err := validatePromptTemplateName(t.Name); err != nil {
+		return err
+	}
+	t.UpdatedAt = time.Now()
+
+	templates := append([]PromptTemplate(nil), a.promptTemplates()...)
+	if i := findPromptTemplate(templates, t.Name); i >= 0 {
+		templates[i] = t
+	} else {
+		templates = append(templates, t)
+	}
+	if _, err := parsePromptTemplates(templates); err != nil {
+		return err
+	}
+	a.settings.PromptTemplates = templates
+	if err := a.saveSettings(); err != nil {
+		return fmt.Errorf("failed to save prompt template: %w", err)
+	}
+	runtime.LogInfof(a.ctx, "Saved prompt template '%s'", t.Name)
+	return nil
+}
+
+// DeletePromptTemplate removes a template. Templates that include it fail to render until fixed.
+func (a *App) DeletePromptTemplate(name string) error {
+	templates := append([]PromptTemplate(nil), a.promptTemplates()...)
+	i := findPromptTemplate(templates, name)
+	if i < 0 {
+		return fmt.Errorf("prompt template '%s' not found", name)
+	}
+	a.settings.PromptTemplates = append(templates[:i], templates[i+1:]...)
+	if err := a.saveSettings(); err != nil {
+		return fmt.Errorf("failed to save settings after deleting prompt template: %w", err)
+	}
+	return nil
+}
+
+// ResetPromptTemplates restores the built-in templates, dropping custom ones.
+func (a *App) ResetPromptTemplates() error {
+	a.settings.PromptTemplates = nil
+	return a.saveSettings()
+}
+
+// RenderPromptTemplate composes a prompt from a template and reports how many
+// tokens the template itself and each variable contribute.
+func (a *App) RenderPromptTemplate(name string, vars PromptVariables) (*RenderedPrompt, error) {
+	templates := a.promptTemplates()
+	if findPromptTemplate(templates, name) < 0 {
+		return nil, fmt.Errorf("prompt template '%s' not found", name)
+	}
+	if strings.HasPrefix(name, promptPartialPrefix) {
+		return nil, fmt.Errorf("'%s' is a partial and cannot be rendered on its own", name)
+	}
+	set, err := parsePromptTemplates(templates)
+	if err != nil {
+		return nil, err
+	}
+	if vars.Tree == "" {
+		vars.Tree = contextTree(vars.Context)
+	}
+	if vars.Date == "" {
+		vars.Date = time.Now().Format("2006-01-02")
+	}
+
+	render := func(v PromptVariables) (string, error) {
+		var b strings.Builder
+		if err := set.ExecuteTemplate(&b, name, v); err != nil {
+			return "", fmt.Errorf("failed to render prompt template '%s': %w", name, err)
+		}
+		return b.String(), nil
+	}
+	prompt, err := render(vars)
+	if err != nil {
+		return nil, err
+	}
+
+	// Attribute tokens from a second render in which every non-empty variable
+	// is a short marker, so the context is rendered only once. Empty variables
+	// stay empty so {{if}} takes the same branches as in the real prompt.
+	values := map[string]string{"task": vars.Task, "rules": vars.Rules, "context": vars.Context, "tree": vars.Tree, "date": vars.Date}
+	for key, value := range vars.Vars {
+		values["vars."+key] = value
+	}
+	marker := func(key string) string {
+		if values[key] == "" {
+			return ""
+		}
+		return "\x00" + key + "\x00"
+	}
+	marked := PromptVariables{
+		Task:    marker("task"),
+		Rules:   marker("rules"),
+		Context: marker("context"),
+		Tree:    marker("tree"),
+		Date:    marker("date"),
+		Vars:    make(map[string]string, len(vars.Vars)),
+	}
+	for key := range vars.Vars {
+		marked.Vars[key] = marker("vars." + key)
+	}
+	skeleton, err := render(marked)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &RenderedPrompt{
+		Prompt:         prompt,
+		TotalTokens:    estimateTokens(prompt),
+		VariableTokens: make(map[string]int, len(values)),
+	}
+	for key, value := range values {
+		uses := 0
+		if m := marker(key); m != "" {
+			uses = strings.Count(skeleton, m)
+			skeleton = strings.ReplaceAll(skeleton, m, "")
+		}
+		result.VariableTokens[key] = uses * estimateTokens(value)
+	}
+	result.TemplateTokens = estimateTokens(skeleton)
+	return result, nil
+}
+
+// ExportPromptTemplates writes every template to destDir as <name>.tmpl.
+func (a *App) ExportPromptTemplates(destDir string) error {
+	if err := os.MkdirAll(destDir, os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create export directory %s: %w", destDir, err)
+	}
+	for _, t := range a.promptTemplates() {
+		p := filepath.Join(destDir, t.Name+promptTemplateFileExt)
+		if err := os.WriteFile(p, []byte(t.Body), 0644); err != nil {
+			return fmt.Errorf("failed to export prompt template '%s': %w", t.Name, err)
+		}
+	}
+	runtime.LogInfof(a.ctx, "Exported %d prompt templates to %s", len(a.promptTemplates()), destDir)
+	return nil
+}
+
+// ImportPromptTemplates reads template files, naming each after its file name
+// without extension, and saves them, replacing templates with the same name.
+func (a *App) ImportPromptTemplates(paths []string) ([]PromptTemplate, error) {
+	templates := append([]PromptTemplate(nil), a.promptTemplates()...)
+	imported := make([]PromptTemplate, 0, len(paths))
+	for _, p := range paths {
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read prompt template %s: %w", p, err)
+		}
+		name := strings.TrimSuffix(filepath.Base(p), filepath.Ext(p))
+		if err := validatePromptTemplateName(name); err != nil {
+			return nil, err
+		}
+		t := PromptTemplate{Name: name, Body: string(data), UpdatedAt: time.Now()}
+		if i := findPromptTemplate(templates, name); i >= 0 {
+			t.Description = templates[i].Description
+			templates[i] = t
+		} else {
+			templates = append(templates, t)
+		}
+		imported = append(imported, t)
+	}
+	if _, err := parsePromptTemplates(templates); err != nil {
+		return nil, err
+	}
+	a.settings.PromptTemplates = templates
+	if err := a.saveSettings(); err != nil {
+		return nil, fmt.Errorf("failed to save imported prompt templates: %w", err)
+	}
+	return imported, nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRenderPromptTemplate(t *testing.T) {
+	a := &App{settings: AppSettings{PromptTemplates: []PromptTemplate{
+		{Name: "_rules", Body: "{{if .Rules}}Rules: {{.Rules}}{{end}}"},
+		{Name: "twice", Body: "Do {{.Task}}, then {{.Task}} again.\n{{template \"_rules\" .}}\nIn {{.Vars.lang}}{{.Vars.missing}}.\n{{.Tree}}"},
+		{Name: "unknown field", Body: "{{.Task}} {{.Deadline}}"},
+	}}}
+	vars := PromptVariables{
+		Task:    "add a flag",
+		Context: "project/\n└── a.go\n\n<file path=\"a.go\">\npackage a\n</file>",
+		Date:    "2024-05-10",
+		Vars:    map[string]string{"lang": "Go", "unused": "never rendered"},
+	}
+
+	got, err := a.RenderPromptTemplate("twice", vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantPrompt := "Do add a flag, then add a flag again.\n\nIn Go.\nproject/\n└── a.go"
+	if got.Prompt != wantPrompt {
+		t.Errorf("prompt = %q, want %q", got.Prompt, wantPrompt)
+	}
+	wantTokens := map[string]int{
+		"task":        2 * estimateTokens("add a flag"),
+		"rules":       0,
+		"context":     0,
+		"tree":        estimateTokens("project/\n└── a.go"),
+		"date":        0,
+		"vars.lang":   estimateTokens("Go"),
+		"vars.unused": 0,
+	}
+	if !reflect.DeepEqual(got.VariableTokens, wantTokens) {
+		t.Errorf("variable tokens = %v, want %v", got.VariableTokens, wantTokens)
+	}
+	skeleton := "Do , then  again.\n\nIn .\n"
+	if got.TemplateTokens != estimateTokens(skeleton) || got.TotalTokens != estimateTokens(wantPrompt) {
+		t.Errorf("template tokens = %d, total = %d; want %d and %d", got.TemplateTokens, got.TotalTokens, estimateTokens(skeleton), estimateTokens(wantPrompt))
+	}
+
+	if _, err := a.RenderPromptTemplate("unknown field", vars); err == nil || !strings.Contains(err.Error(), "Deadline") {
+		t.Errorf("unknown field: err = %v, want a render error naming it", err)
+	}
+	if _, err := a.RenderPromptTemplate("missing", vars); err == nil {
+		t.Error("a missing template was rendered")
+	}
+	if _, err := a.RenderPromptTemplate("_rules", vars); err == nil {
+		t.Error("a partial was rendered on its own")
+	}
+}
+
+func TestPromptTemplatesEmptyList(t *testing.T) {
+	if got := (&App{}).promptTemplates(); !reflect.DeepEqual(got, defaultPromptTemplates) {
+		t.Errorf("templates without settings = %v, want the built-in ones", got)
+	}
+
+	a := &App{settings: AppSettings{PromptTemplates: []PromptTemplate{}}}
+	data, err := json.Marshal(a.settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings, _, err := decodeSettings(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reloaded := &App{settings: settings}
+	if got := reloaded.promptTemplates(); got == nil || len(got) != 0 {
+		t.Errorf("templates after deleting all and reloading = %v, want none", got)
+	}
+	if got := reloaded.ListPromptTemplates(); len(got) != 0 {
+		t.Errorf("listed templates = %v, want none", got)
+	}
+}
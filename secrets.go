@@ -0,0 +1,184 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/adrg/xdg"
+)
+
+// --- Encrypted secret store ---
+
+// Secret names used by the app.
+const secretAgentAPIKey = "agentConfig.apiKey"
+
+// SecretStore keeps secrets such as API keys out of settings.json. Values are
+// encrypted with AES-256-GCM under a random key kept in the XDG data dir, apart
+// from the config dir, so settings files, backups and exported bundles never
+// carry a usable secret. It does not protect against someone who can read
+// both files as the current user.
+type SecretStore struct {
+	mu       sync.Mutex
+	path     string // Encrypted secrets, next to settings.json
+	keyPath  string
+	log      diffSplitLog
+	contents map[string]string // Decrypted cache, nil until first load
+}
+
+// errSecretsKeyMissing is returned by key when secrets exist but their key does not.
+var errSecretsKeyMissing = errors.New("secrets key is missing")
+
+func NewSecretStore(log diffSplitLog) (*SecretStore, error) {
+	path, err := xdg.ConfigFile("shotgun-code/secrets.enc")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get secrets file path: %w", err)
+	}
+	keyPath, err := xdg.DataFile("shotgun-code/secrets.key")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get secrets key path: %w", err)
+	}
+	return &SecretStore{path: path, keyPath: keyPath, log: log}, nil
+}
+
+// key returns the encryption key. A missing key is only created when there
+// are no secrets yet; a new key could never decrypt existing ones.
+func (s *SecretStore) key() ([]byte, error) {
+	key, err := os.ReadFile(s.keyPath)
+	if err == nil {
+		if len(key) != 32 {
+			return nil, fmt.Errorf("secrets key %s is corrupt", s.keyPath)
+		}
+		return key, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read secrets key: %w", err)
+	}
+	if _, err := os.Stat(s.path); !os.IsNotExist(err) {
+		return nil, errSecretsKeyMissing
+	}
+	key = make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, fmt.Errorf("failed to generate secrets key: %w", err)
+	}
+	if err := writeFileAtomic(s.keyPath, key, 0600); err != nil {
+		return nil, fmt.Errorf("failed to write secrets key: %w", err)
+	}
+	return key, nil
+}
+
+func (s *SecretStore) aead() (cipher.AEAD, error) {
+	key, err := s.key()
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// load decrypts the secrets file into the cache. Callers must hold s.mu.
+func (s *SecretStore) load() error {
+	if s.contents != nil {
+		return nil
+	}
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		s.contents = make(map[string]string)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read secrets: %w", err)
+	}
+	gcm, err := s.aead()
+	if err != nil && !errors.Is(err, errSecretsKeyMissing) {
+		return err
+	}
+	var contents map[string]string
+	if err == nil {
+		contents, err = s.decrypt(gcm, data)
+	}
+	if err != nil {
+		// Keep the unreadable file for recovery and start over, rather than
+		// failing every secret lookup from now on
+		backupPath := fmt.Sprintf("%s.unreadable-%s", s.path, time.Now().Format("20060102-150405"))
+		if renameErr := os.Rename(s.path, backupPath); renameErr != nil {
+			return fmt.Errorf("%v; failed to move the secrets file aside: %w", err, renameErr)
+		}
+		s.log.Warningf("%v. Moved the secrets file to %s and starting with no secrets.", err, backupPath)
+		contents = make(map[string]string)
+	}
+	s.contents = contents
+	return nil
+}
+
+// decrypt opens the contents of the secrets file.
+func (s *SecretStore) decrypt(gcm cipher.AEAD, data []byte) (map[string]string, error) {
+	if len(data) < gcm.NonceSize() {
+		return nil, fmt.Errorf("secrets file %s is corrupt", s.path)
+	}
+	nonce, sealed := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+	plain, err := gcm.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt secrets (was the key replaced?): %w", err)
+	}
+	contents := make(map[string]string)
+	if err := json.Unmarshal(plain, &contents); err != nil {
+		return nil, fmt.Errorf("failed to parse secrets: %w", err)
+	}
+	return contents, nil
+}
+
+// Get returns a secret, or "" if it is not set.
+func (s *SecretStore) Get(name string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		return "", err
+	}
+	return s.contents[name], nil
+}
+
+// Set stores a secret; an empty value deletes it.
+func (s *SecretStore) Set(name, value string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		return err
+	}
+	if s.contents[name] == value {
+		return nil
+	}
+	if value == "" {
+		delete(s.contents, name)
+	} else {
+		s.contents[name] = value
+	}
+
+	plain, err := json.Marshal(s.contents)
+	if err != nil {
+		return fmt.Errorf("failed to marshal secrets: %w", err)
+	}
+	gcm, err := s.aead()
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	if err := writeFileAtomic(s.path, gcm.Seal(nonce, nonce, plain, nil), 0600); err != nil {
+		s.contents = nil // Reload from disk next time; the change was not saved
+		return fmt.Errorf("failed to write secrets: %w", err)
+	}
+	return nil
+}
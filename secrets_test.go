@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func testSecretStore(dir string) *SecretStore {
+	return &SecretStore{path: filepath.Join(dir, "secrets.enc"), keyPath: filepath.Join(dir, "data", "secrets.key"), log: discardLog{}}
+}
+
+func TestSecretStoreRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "data"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	s := testSecretStore(dir)
+	if got, err := s.Get(secretAgentAPIKey); got != "" || err != nil {
+		t.Fatalf("empty store: Get = %q, %v", got, err)
+	}
+	if err := s.Set(secretAgentAPIKey, "sk-123"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Set("other", "x"); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(s.path)
+	if err != nil || bytes.Contains(data, []byte("sk-123")) {
+		t.Fatalf("secrets file holds the plain secret (%v)", err)
+	}
+
+	reopened := testSecretStore(dir)
+	if got, err := reopened.Get(secretAgentAPIKey); got != "sk-123" || err != nil {
+		t.Errorf("after reopening: Get = %q, %v; want the stored secret", got, err)
+	}
+	if err := reopened.Set("other", ""); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := testSecretStore(dir).Get("other"); got != "" {
+		t.Errorf("deleted secret = %q, want none", got)
+	}
+}
+
+func TestSecretStoreUnreadable(t *testing.T) {
+	tests := []struct {
+		name   string
+		damage func(t *testing.T, s *SecretStore)
+	}{
+		{
+			name: "wrong key",
+			damage: func(t *testing.T, s *SecretStore) {
+				if err := os.WriteFile(s.keyPath, bytes.Repeat([]byte{7}, 32), 0600); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name: "missing key",
+			damage: func(t *testing.T, s *SecretStore) {
+				if err := os.Remove(s.keyPath); err != nil {
+					t.Fatal(err)
+				}
+				if _, err := s.key(); !errors.Is(err, errSecretsKeyMissing) {
+					t.Errorf("key = %v, want no new key while secrets exist", err)
+				}
+				if _, err := os.Stat(s.keyPath); !os.IsNotExist(err) {
+					t.Error("a new key was written over existing secrets")
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := os.Mkdir(filepath.Join(dir, "data"), 0700); err != nil {
+				t.Fatal(err)
+			}
+			if err := testSecretStore(dir).Set(secretAgentAPIKey, "sk-123"); err != nil {
+				t.Fatal(err)
+			}
+			s := testSecretStore(dir)
+			tt.damage(t, s)
+			sealed, err := os.ReadFile(s.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got, err := s.Get(secretAgentAPIKey); got != "" || err != nil {
+				t.Fatalf("Get = %q, %v; want an empty store", got, err)
+			}
+			backups, _ := filepath.Glob(s.path + ".unreadable-*")
+			if len(backups) != 1 {
+				t.Fatalf("backups = %v, want one", backups)
+			}
+			if data, err := os.ReadFile(backups[0]); err != nil || !bytes.Equal(data, sealed) {
+				t.Errorf("backup differs from the unreadable secrets (%v)", err)
+			}
+
+			if err := s.Set(secretAgentAPIKey, "sk-456"); err != nil {
+				t.Fatal(err)
+			}
+			if got, err := testSecretStore(dir).Get(secretAgentAPIKey); got != "sk-456" || err != nil {
+				t.Errorf("after starting over: Get = %q, %v", got, err)
+			}
+		})
+	}
+}
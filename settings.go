@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// --- Settings schema versioning ---
+
+// currentSettingsVersion is the schema version written by saveSettings.
+// Files without a version field are version 0.
+const currentSettingsVersion = 1
+
+// settingsMigrations[v] upgrades a raw settings document from version v to v+1.
+// Migrations operate on the decoded JSON object so renamed or restructured
+// fields can still be read after AppSettings has changed.
+var settingsMigrations = []func(doc map[string]any) error{
+	migrateSettingsV0,
+}
+
+// migrateSettingsV0 upgrades files written before versioning existed. Those
+// only ever held the two rule strings, and some lacked the prompt rules.
+func migrateSettingsV0(doc map[string]any) error {
+	if v, exists := doc["customIgnoreRules"]; exists && v != nil {
+		if _, ok := v.(string); !ok {
+			return fmt.Errorf("customIgnoreRules has unexpected type %T", v)
+		}
+	}
+	if rules, ok := doc["customPromptRules"].(string); !ok || rules == "" {
+		doc["customPromptRules"] = defaultCustomPromptRulesContent
+	}
+	return nil
+}
+
+// decodeSettings parses a settings file of any known version into the current
+// schema. It reports the version the file was written with.
+func decodeSettings(data []byte) (settings AppSettings, fromVersion int, err error) {
+	var doc map[string]any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return settings, 0, fmt.Errorf("invalid settings JSON: %w", err)
+	}
+	if doc == nil {
+		return settings, 0, fmt.Errorf("settings file does not contain a JSON object")
+	}
+	if v, ok := doc["version"]; ok {
+		n, isNumber := v.(float64)
+		if !isNumber || n < 0 || n != float64(int(n)) {
+			return settings, 0, fmt.Errorf("invalid settings version %v", v)
+		}
+		fromVersion = int(n)
+	}
+
+	for v := fromVersion; v < currentSettingsVersion; v++ {
+		if err := settingsMigrations[v](doc); err != nil {
+			return settings, fromVersion, fmt.Errorf("migrating settings from version %d: %w", v, err)
+		}
+	}
+	if fromVersion < currentSettingsVersion {
+		doc["version"] = currentSettingsVersion
+	}
+
+	migrated, err := json.Marshal(doc)
+	if err != nil {
+		return settings, fromVersion, fmt.Errorf("re-encoding migrated settings: %w", err)
+	}
+	if err := json.Unmarshal(migrated, &settings); err != nil {
+		return settings, fromVersion, fmt.Errorf("invalid settings: %w", err)
+	}
+	return settings, fromVersion, nil
+}
+
+// backupSettingsFile copies the settings file next to itself with the given
+// suffix and a timestamp, returning the backup path.
+func backupSettingsFile(configPath, suffix string) (string, error) {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return "", err
+	}
+	backupPath := fmt.Sprintf("%s.%s-%s", configPath, suffix, time.Now().Format("20060102-150405"))
+	if err := writeFileAtomic(backupPath, data, 0644); err != nil {
+		return "", err
+	}
+	return backupPath, nil
+}
+
+// backupSettingsFileOnce is backupSettingsFile for backups that only need to be
+// taken once, such as of a file written by a newer release. It returns "" if a
+// backup with the suffix already exists.
+func backupSettingsFileOnce(configPath, suffix string) (string, error) {
+	existing, err := filepath.Glob(configPath + "." + suffix + "-*")
+	if err != nil {
+		return "", err
+	}
+	if len(existing) > 0 {
+		return "", nil
+	}
+	return backupSettingsFile(configPath, suffix)
+}
+
+// writeFileAtomic writes data to a temporary file in the same directory and
+// renames it over path, so readers never observe a partially written file.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) (err error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+	if _, err = tmp.Write(data); err != nil {
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// --- Settings bundles (team-shared configuration) ---
+
+const settingsBundleFormat = "shotgun-code-settings-bundle"
+
+// Merge modes for ImportSettings.
+const (
+	SettingsMergeKeepMine  = "mine"   // Conflicts keep the local value; new items are added
+	SettingsMergeTakeTheir = "theirs" // Conflicts take the bundle's value; new items are added
+	SettingsMergeUnion     = "union"  // Rule texts are merged line by line; other conflicts keep the local value
+)
+
+// SettingsBundle is the shareable part of the settings. Machine-specific state
+// (ignore toggles, agent config, UI state) and secrets are never exported.
+type SettingsBundle struct {
+	Format              string                      `json:"format"`
+	Version             int                         `json:"version"` // Settings schema version of the exporting app
+	ExportedAt          time.Time                   `json:"exportedAt"`
+	CustomIgnoreRules   string                      `json:"customIgnoreRules"`
+	CustomPromptRules   string                      `json:"customPromptRules"`
+	ProjectPromptRules  map[string]string           `json:"projectPromptRules,omitempty"` // Keyed by project name
+	LanguagePromptRules map[string]string           `json:"languagePromptRules,omitempty"`
+	PromptTemplates     []PromptTemplate            `json:"promptTemplates"`
+	SelectionProfiles   map[string]*ProjectProfiles `json:"selectionProfiles,omitempty"` // Keyed by project name
+}
+
+// bundleProjectName is the portable key of a project root in a bundle: the
+// name of the root directory, which is the same on every machine that clones
+// the repo. Older bundles keyed by absolute root map to the same name.
+func bundleProjectName(rootKey string) string {
+	return path.Base(path.Clean(strings.ReplaceAll(rootKey, `\`, "/")))
+}
+
+// byProjectName re-keys a map of project roots by project name. When two roots
+// share a name, the first in sorted order is kept.
+func byProjectName[V any](byRoot map[string]V) map[string]V {
+	if len(byRoot) == 0 {
+		return nil
+	}
+	roots := make([]string, 0, len(byRoot))
+	for root := range byRoot {
+		roots = append(roots, root)
+	}
+	sort.Strings(roots)
+	byName := make(map[string]V, len(roots))
+	for _, root := range roots {
+		name := bundleProjectName(root)
+		if _, exists := byName[name]; !exists {
+			byName[name] = byRoot[root]
+		}
+	}
+	return byName
+}
+
+// settingsBundle returns the shareable part of the current settings.
+func (a *App) settingsBundle() SettingsBundle {
+	return SettingsBundle{
+		Format:              settingsBundleFormat,
+		Version:             currentSettingsVersion,
+		ExportedAt:          time.Now().UTC(),
+		CustomIgnoreRules:   a.settings.CustomIgnoreRules,
+		CustomPromptRules:   a.GetCustomPromptRules(),
+		ProjectPromptRules:  byProjectName(a.settings.ProjectPromptRules),
+		LanguagePromptRules: a.settings.LanguagePromptRules,
+		PromptTemplates:     a.settings.PromptTemplates,
+		SelectionProfiles:   byProjectName(a.settings.SelectionProfiles),
+	}
+}
+
+// ExportSettings writes the shareable settings to destPath as a JSON bundle.
+// Project-specific entries are keyed by project name, not by local path.
+func (a *App) ExportSettings(destPath string) error {
+	data, err := json.MarshalIndent(a.settingsBundle(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal settings bundle: %w", err)
+	}
+	if err := writeFileAtomic(destPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write settings bundle to %s: %w", destPath, err)
+	}
+	runtime.LogInfof(a.ctx, "Exported settings bundle to %s", destPath)
+	return nil
+}
+
+// ImportSettings merges a bundle written by ExportSettings into the current
+// settings using one of the SettingsMerge* modes, then saves and applies them.
+// projectRoots maps project names of the bundle to local project roots; other
+// names go to the one known local root with that directory name, if any.
+// Project entries that match no local root are skipped.
+func (a *App) ImportSettings(srcPath string, mode string, projectRoots map[string]string) error {
+	data, err := os.ReadFile(srcPath)
+	if err != nil {
+		return fmt.Errorf("failed to read settings bundle %s: %w", srcPath, err)
+	}
+	var bundle SettingsBundle
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		return fmt.Errorf("invalid settings bundle %s: %w", srcPath, err)
+	}
+	if bundle.Format != settingsBundleFormat {
+		return fmt.Errorf("%s is not a settings bundle", srcPath)
+	}
+	if bundle.Version > currentSettingsVersion {
+		runtime.LogWarningf(a.ctx, "Settings bundle version %d is newer than supported version %d; unknown fields are ignored.", bundle.Version, currentSettingsVersion)
+	}
+	merged, unmatched, err := a.mergeSettingsBundle(bundle, mode, projectRoots)
+	if err != nil {
+		return err
+	}
+	if len(unmatched) > 0 {
+		runtime.LogWarningf(a.ctx, "Settings bundle entries for projects %s match no local project root and were skipped.", strings.Join(unmatched, ", "))
+	}
+
+	if err := a.writeSettings(&merged); err != nil {
+		return fmt.Errorf("failed to save imported settings: %w", err)
+	}
+	a.settings = merged
+	compileErr := a.compileCustomIgnorePatterns()
+	runtime.LogInfof(a.ctx, "Imported settings bundle %s (merge mode: %s)", srcPath, mode)
+
+	// The valid ignore rules are active even if some lines are invalid, so
+	// rescan before reporting the compile error
+	var rescanErr error
+	if a.fileWatcher != nil && a.fileWatcher.rootDir != "" {
+		rescanErr = a.fileWatcher.RefreshIgnoresAndRescan()
+	}
+	if compileErr != nil {
+		return fmt.Errorf("settings imported, but failed to compile custom ignore patterns: %w", compileErr)
+	}
+	return rescanErr
+}
+
+// mergeSettingsBundle merges bundle into a copy of the current settings. It
+// returns the bundle's project names that could not be mapped to a local root.
+func (a *App) mergeSettingsBundle(bundle SettingsBundle, mode string, projectRoots map[string]string) (merged AppSettings, unmatched []string, err error) {
+	switch mode {
+	case SettingsMergeKeepMine, SettingsMergeTakeTheir, SettingsMergeUnion:
+	default:
+		return merged, nil, fmt.Errorf("unknown merge mode '%s'", mode)
+	}
+	if _, err := parsePromptTemplates(bundle.PromptTemplates); err != nil {
+		return merged, nil, fmt.Errorf("settings bundle has an invalid prompt template: %w", err)
+	}
+
+	localRoots := a.localProjectRoots(projectRoots)
+	projectPromptRules, unmatchedRules := byLocalRoot(bundle.ProjectPromptRules, localRoots)
+	selectionProfiles, unmatchedProfiles := byLocalRoot(bundle.SelectionProfiles, localRoots)
+	unmatched = append(unmatchedRules, unmatchedProfiles...)
+	sort.Strings(unmatched)
+	unmatched = slices.Compact(unmatched)
+
+	merged = a.settings
+	merged.CustomIgnoreRules = mergeRuleText(a.settings.CustomIgnoreRules, bundle.CustomIgnoreRules, "", mode)
+	merged.CustomPromptRules = mergeRuleText(a.GetCustomPromptRules(), bundle.CustomPromptRules, defaultCustomPromptRulesContent, mode)
+	merged.ProjectPromptRules = mergeRuleMaps(a.settings.ProjectPromptRules, projectPromptRules, mode)
+	merged.LanguagePromptRules = mergeRuleMaps(a.settings.LanguagePromptRules, bundle.LanguagePromptRules, mode)
+	if bundle.PromptTemplates != nil {
+		merged.PromptTemplates = mergePromptTemplateLists(a.promptTemplates(), bundle.PromptTemplates, mode)
+		if _, err := parsePromptTemplates(merged.PromptTemplates); err != nil {
+			return merged, nil, fmt.Errorf("merged prompt templates do not compile: %w", err)
+		}
+	}
+	merged.SelectionProfiles = mergeSelectionProfiles(a.settings.SelectionProfiles, selectionProfiles, mode)
+	return merged, unmatched, nil
+}
+
+// localProjectRoots maps project names to local roots: the explicit mapping
+// first, then every root the settings know about or that is open, as long as
+// only one of them has that name.
+func (a *App) localProjectRoots(projectRoots map[string]string) map[string]string {
+	candidates := make(map[string]map[string]bool)
+	addRoot := func(root string) {
+		if root == "" {
+			return
+		}
+		name := bundleProjectName(root)
+		if candidates[name] == nil {
+			candidates[name] = make(map[string]bool)
+		}
+		candidates[name][profileKey(root)] = true
+	}
+	for root := range a.settings.SelectionProfiles {
+		addRoot(root)
+	}
+	for root := range a.settings.ProjectPromptRules {
+		addRoot(root)
+	}
+	if a.fileWatcher != nil {
+		addRoot(a.fileWatcher.rootDir)
+	}
+
+	roots := make(map[string]string, len(candidates)+len(projectRoots))
+	for name, set := range candidates {
+		if len(set) == 1 {
+			for root := range set {
+				roots[name] = root
+			}
+		}
+	}
+	for name, root := range projectRoots {
+		if strings.TrimSpace(root) != "" {
+			roots[name] = profileKey(root)
+		}
+	}
+	return roots
+}
+
+// byLocalRoot re-keys a map of bundle project names by local root and returns
+// the names with no local root.
+func byLocalRoot[V any](byName map[string]V, localRoots map[string]string) (map[string]V, []string) {
+	byRoot := make(map[string]V, len(byName))
+	var unmatched []string
+	for key, v := range byName {
+		name := bundleProjectName(key)
+		root, ok := localRoots[name]
+		if !ok {
+			unmatched = append(unmatched, name)
+			continue
+		}
+		byRoot[root] = v
+	}
+	return byRoot, unmatched
+}
+
+// mergeRuleText merges two rule texts. Empty text and the placeholder never win
+// over real rules. In union mode lines of theirs not already in mine are appended.
+func mergeRuleText(mine, theirs, placeholder, mode string) string {
+	isEmpty := func(s string) bool {
+		s = strings.TrimSpace(s)
+		return s == "" || s == placeholder
+	}
+	switch {
+	case isEmpty(theirs):
+		return mine
+	case isEmpty(mine):
+		return theirs
+	}
+	switch mode {
+	case SettingsMergeTakeTheir:
+		return theirs
+	case SettingsMergeUnion:
+		seen := make(map[string]bool)
+		for _, line := range strings.Split(mine, "\n") {
+			seen[strings.TrimSpace(line)] = true
+		}
+		var added []string
+		for _, line := range strings.Split(strings.ReplaceAll(theirs, "\r\n", "\n"), "\n") {
+			trimmed := strings.TrimSpace(line)
+			if trimmed != "" && !seen[trimmed] {
+				seen[trimmed] = true
+				added = append(added, line)
+			}
+		}
+		if len(added) == 0 {
+			return mine
+		}
+		return strings.TrimRight(mine, "\n") + "\n" + strings.Join(added, "\n")
+	default:
+		return mine
+	}
+}
+
+func mergeRuleMaps(mine, theirs map[string]string, mode string) map[string]string {
+	if len(mine) == 0 && len(theirs) == 0 {
+		return mine
+	}
+	merged := make(map[string]string, len(mine)+len(theirs))
+	for k, v := range mine {
+		merged[k] = v
+	}
+	for k, v := range theirs {
+		merged[k] = mergeRuleText(merged[k], v, "", mode)
+	}
+	return merged
+}
+
+func mergePromptTemplateLists(mine, theirs []PromptTemplate, mode string) []PromptTemplate {
+	merged := append([]PromptTemplate(nil), mine...)
+	for _, t := range theirs {
+		i := findPromptTemplate(merged, t.Name)
+		switch {
+		case i < 0:
+			merged = append(merged, t)
+		case mode == SettingsMergeTakeTheir:
+			merged[i] = t
+		}
+	}
+	return merged
+}
+
+func mergeSelectionProfiles(mine, theirs map[string]*ProjectProfiles, mode string) map[string]*ProjectProfiles {
+	if len(theirs) == 0 {
+		return mine
+	}
+	merged := make(map[string]*ProjectProfiles, len(mine)+len(theirs))
+	for root, pp := range mine {
+		if pp == nil {
+			continue
+		}
+		copied := *pp
+		copied.Profiles = append([]SelectionProfile(nil), pp.Profiles...)
+		merged[root] = &copied
+	}
+	for root, theirPP := range theirs {
+		if theirPP == nil {
+			continue
+		}
+		key := profileKey(root)
+		pp := merged[key]
+		if pp == nil {
+			pp = &ProjectProfiles{}
+			merged[key] = pp
+		}
+		for _, p := range theirPP.Profiles {
+			i := pp.find(p.Name)
+			switch {
+			case i < 0:
+				pp.Profiles = append(pp.Profiles, p)
+			case mode == SettingsMergeTakeTheir:
+				pp.Profiles[i] = p
+			}
+		}
+		if pp.DefaultProfile == "" || (mode == SettingsMergeTakeTheir && theirPP.DefaultProfile != "") {
+			pp.DefaultProfile = theirPP.DefaultProfile
+		}
+	}
+	return merged
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// roundTripBundle exports the settings of from and decodes them as an import would.
+func roundTripBundle(t *testing.T, from *App) SettingsBundle {
+	t.Helper()
+	data, err := json.Marshal(from.settingsBundle())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var bundle SettingsBundle
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		t.Fatal(err)
+	}
+	return bundle
+}
+
+func profileNames(pp *ProjectProfiles) []string {
+	if pp == nil {
+		return nil
+	}
+	var names []string
+	for _, p := range pp.Profiles {
+		names = append(names, p.Name)
+	}
+	return names
+}
+
+func TestSettingsBundleAcrossRootPaths(t *testing.T) {
+	lead := &App{settings: AppSettings{
+		SelectionProfiles: map[string]*ProjectProfiles{
+			"/home/lead/src/app":   {Profiles: []SelectionProfile{{Name: "backend"}}, DefaultProfile: "backend"},
+			"/home/lead/src/tools": {Profiles: []SelectionProfile{{Name: "cli"}}},
+		},
+		ProjectPromptRules: map[string]string{
+			`C:\src\app`: "Use tabs.",
+		},
+	}}
+	bundle := roundTripBundle(t, lead)
+	if _, ok := bundle.SelectionProfiles["app"]; !ok {
+		t.Fatalf("bundle profiles = %v, want them keyed by project name", bundle.SelectionProfiles)
+	}
+
+	mate := &App{settings: AppSettings{
+		SelectionProfiles: map[string]*ProjectProfiles{
+			"/Users/mate/work/app": {Profiles: []SelectionProfile{{Name: "mine"}}},
+		},
+	}}
+
+	merged, unmatched, err := mate.mergeSettingsBundle(bundle, SettingsMergeKeepMine, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pp := merged.SelectionProfiles["/Users/mate/work/app"]
+	if got, want := profileNames(pp), []string{"mine", "backend"}; !reflect.DeepEqual(got, want) || pp.DefaultProfile != "backend" {
+		t.Errorf("profiles = %v (default %q), want %v (default \"backend\")", got, pp.DefaultProfile, want)
+	}
+	if got := merged.ProjectPromptRules["/Users/mate/work/app"]; got != "Use tabs." {
+		t.Errorf("project prompt rules = %q, want the lead's rules", got)
+	}
+	if want := []string{"tools"}; !reflect.DeepEqual(unmatched, want) {
+		t.Errorf("unmatched = %v, want %v", unmatched, want)
+	}
+	if len(merged.SelectionProfiles) != 1 {
+		t.Errorf("merged profiles for %d roots, want only the local one", len(merged.SelectionProfiles))
+	}
+
+	merged, unmatched, err = mate.mergeSettingsBundle(bundle, SettingsMergeKeepMine, map[string]string{"tools": "/Users/mate/tools"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := profileNames(merged.SelectionProfiles["/Users/mate/tools"]); !reflect.DeepEqual(got, []string{"cli"}) || len(unmatched) != 0 {
+		t.Errorf("remapped profiles = %v, unmatched = %v, want [cli] and none", got, unmatched)
+	}
+}
+
+func TestMergeSettingsBundleModes(t *testing.T) {
+	mine := AppSettings{
+		CustomIgnoreRules:   "*.log\nbuild/",
+		CustomPromptRules:   defaultCustomPromptRulesContent,
+		LanguagePromptRules: map[string]string{"go": "Use gofmt."},
+		PromptTemplates:     []PromptTemplate{{Name: "dev", Body: "mine"}},
+		SelectionProfiles: map[string]*ProjectProfiles{
+			"/src/app": {Profiles: []SelectionProfile{{Name: "api", Patterns: []string{"mine"}}}, DefaultProfile: "api"},
+		},
+	}
+	bundle := SettingsBundle{
+		Format:              settingsBundleFormat,
+		Version:             currentSettingsVersion,
+		CustomIgnoreRules:   "build/\n*.tmp",
+		CustomPromptRules:   "Be brief.",
+		LanguagePromptRules: map[string]string{"go": "Wrap errors.", "python": "Use type hints."},
+		PromptTemplates:     []PromptTemplate{{Name: "dev", Body: "theirs"}, {Name: "review", Body: "review"}},
+		SelectionProfiles: map[string]*ProjectProfiles{
+			"app": {Profiles: []SelectionProfile{{Name: "api", Patterns: []string{"theirs"}}, {Name: "web"}}, DefaultProfile: "web"},
+		},
+	}
+
+	tests := []struct {
+		mode      string
+		ignore    string
+		goRules   string
+		devBody   string
+		apiSource string
+		defaultP  string
+	}{
+		{mode: SettingsMergeKeepMine, ignore: "*.log\nbuild/", goRules: "Use gofmt.", devBody: "mine", apiSource: "mine", defaultP: "api"},
+		{mode: SettingsMergeTakeTheir, ignore: "build/\n*.tmp", goRules: "Wrap errors.", devBody: "theirs", apiSource: "theirs", defaultP: "web"},
+		{mode: SettingsMergeUnion, ignore: "*.log\nbuild/\n*.tmp", goRules: "Use gofmt.\nWrap errors.", devBody: "mine", apiSource: "mine", defaultP: "api"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			a := &App{settings: mine}
+			merged, _, err := a.mergeSettingsBundle(bundle, tt.mode, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if merged.CustomIgnoreRules != tt.ignore {
+				t.Errorf("ignore rules = %q, want %q", merged.CustomIgnoreRules, tt.ignore)
+			}
+			// The placeholder never wins over real rules
+			if merged.CustomPromptRules != "Be brief." {
+				t.Errorf("prompt rules = %q, want the bundle's", merged.CustomPromptRules)
+			}
+			if merged.LanguagePromptRules["go"] != tt.goRules || merged.LanguagePromptRules["python"] != "Use type hints." {
+				t.Errorf("language rules = %q, want go %q and the bundle's python rules", merged.LanguagePromptRules, tt.goRules)
+			}
+			if len(merged.PromptTemplates) != 2 || merged.PromptTemplates[0].Body != tt.devBody || merged.PromptTemplates[1].Name != "review" {
+				t.Errorf("templates = %+v, want dev %q and review", merged.PromptTemplates, tt.devBody)
+			}
+			pp := merged.SelectionProfiles["/src/app"]
+			if got := profileNames(pp); !reflect.DeepEqual(got, []string{"api", "web"}) || pp.Profiles[0].Patterns[0] != tt.apiSource || pp.DefaultProfile != tt.defaultP {
+				t.Errorf("profiles = %+v, want api from %s, web, default %q", pp, tt.apiSource, tt.defaultP)
+			}
+			if a.settings.CustomIgnoreRules != mine.CustomIgnoreRules || len(a.settings.SelectionProfiles["/src/app"].Profiles) != 1 {
+				t.Error("merging changed the current settings")
+			}
+		})
+	}
+
+	if _, _, err := (&App{settings: mine}).mergeSettingsBundle(bundle, "both", nil); err == nil {
+		t.Error("an unknown merge mode was accepted")
+	}
+	broken := bundle
+	broken.PromptTemplates = []PromptTemplate{{Name: "bad", Body: "{{.Task"}}
+	if _, _, err := (&App{settings: mine}).mergeSettingsBundle(broken, SettingsMergeKeepMine, nil); err == nil {
+		t.Error("a bundle with an invalid template was accepted")
+	}
+}
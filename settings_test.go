@@ -0,0 +1,119 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDecodeSettings(t *testing.T) {
+	tests := []struct {
+		name        string
+		data        string
+		fromVersion int
+		ignore      string
+		prompt      string
+		wantErr     bool
+	}{
+		{
+			name:   "version 0",
+			data:   `{"customIgnoreRules":"*.log","customPromptRules":"Be brief."}`,
+			ignore: "*.log", prompt: "Be brief.",
+		},
+		{
+			name:   "version 0 without prompt rules",
+			data:   `{"customIgnoreRules":"*.log"}`,
+			ignore: "*.log", prompt: defaultCustomPromptRulesContent,
+		},
+		{
+			name:        "current version",
+			data:        `{"version":1,"customIgnoreRules":"*.tmp","customPromptRules":"","useGitignore":false}`,
+			fromVersion: 1,
+			ignore:      "*.tmp",
+		},
+		{
+			name:        "newer version keeps known fields",
+			data:        `{"version":7,"customIgnoreRules":"*.tmp","customPromptRules":"x","futureField":true}`,
+			fromVersion: 7,
+			ignore:      "*.tmp", prompt: "x",
+		},
+		{name: "invalid JSON", data: `{"customIgnoreRules":`, wantErr: true},
+		{name: "not an object", data: `["a"]`, wantErr: true},
+		{name: "null", data: `null`, wantErr: true},
+		{name: "fractional version", data: `{"version":1.5}`, wantErr: true},
+		{name: "version 0 with wrong rule type", data: `{"customIgnoreRules":3}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			settings, fromVersion, err := decodeSettings([]byte(tt.data))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("settings = %+v, want an error", settings)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fromVersion != tt.fromVersion || settings.CustomIgnoreRules != tt.ignore || settings.CustomPromptRules != tt.prompt {
+				t.Errorf("version %d, settings %+v; want version %d, ignore %q, prompt %q", fromVersion, settings, tt.fromVersion, tt.ignore, tt.prompt)
+			}
+			if want := max(tt.fromVersion, currentSettingsVersion); settings.Version != want {
+				t.Errorf("settings version = %d, want %d", settings.Version, want)
+			}
+		})
+	}
+
+	settings, _, err := decodeSettings([]byte(`{"version":1,"useGitignore":false}`))
+	if err != nil || settings.UseGitignore == nil || *settings.UseGitignore || settings.UseCustomIgnore != nil {
+		t.Errorf("ignore toggles = %v, %v (%v), want false and unset", settings.UseGitignore, settings.UseCustomIgnore, err)
+	}
+}
+
+func TestBackupSettingsFile(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "settings.json")
+	if err := writeFileAtomic(configPath, []byte(`{"customIgnoreRules":"old"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFileAtomic(configPath, []byte(`{"customIgnoreRules":"*.log"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	backupPath, err := backupSettingsFile(configPath, "v0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(filepath.Base(backupPath), "settings.json.v0-") {
+		t.Errorf("backup path = %s, want settings.json.v0-<timestamp>", backupPath)
+	}
+	data, err := os.ReadFile(backupPath)
+	if err != nil || string(data) != `{"customIgnoreRules":"*.log"}` {
+		t.Errorf("backup = %q (%v), want the current settings", data, err)
+	}
+	if info, err := os.Stat(configPath); err != nil || info.Mode().Perm() != 0644 {
+		t.Errorf("settings file mode = %v (%v), want 0644", info.Mode().Perm(), err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("directory holds %d files, want the settings and one backup without temporary files", len(entries))
+	}
+	if _, err := backupSettingsFile(filepath.Join(dir, "missing.json"), "corrupt"); err == nil {
+		t.Error("backing up a missing file succeeded")
+	}
+
+	if first, err := backupSettingsFileOnce(configPath, "v7"); err != nil || first == "" {
+		t.Fatalf("first newer-version backup = %q, %v", first, err)
+	}
+	if again, err := backupSettingsFileOnce(configPath, "v7"); err != nil || again != "" {
+		t.Errorf("second newer-version backup = %q, %v; want none", again, err)
+	}
+	if other, err := backupSettingsFileOnce(configPath, "v8"); err != nil || other == "" {
+		t.Errorf("backup for another version = %q, %v; want a new one", other, err)
+	}
+}
@@ -3,364 +3,508 @@ package main
 import (
 	"context"
 	"fmt"
-	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"shotgun_code/internal/unidiff"
 )
 
 // --- Shotgun Diff Splitting ---
 
-// SplitShotgunDiff parses a Git diff string and splits it into multiple
-// smaller Git diff strings, each not exceeding approxLineLimit lines.
-// It tries to split between file diffs first, then between hunks if a single file diff is too large.
-func (a *App) SplitShotgunDiff(gitDiffText string, approxLineLimit int) ([]string, error) {
-	runtime.LogInfof(a.ctx, "SplitShotgunDiff called with line limit: %d for git diff text", approxLineLimit)
-
-	if strings.TrimSpace(gitDiffText) == "" {
-		return []string{}, nil
-	}
-
-	// Regex to find the start of a file diff block.
-	// Go's regex engine (RE2) does not support lookarounds like (?=).
-	// We will find the start indices of each file block and split manually.
-	fileDiffStartRegex := regexp.MustCompile(`(?m)^diff --git `)
-	startIndices := fileDiffStartRegex.FindAllStringIndex(gitDiffText, -1)
+// DiffSplitOptions sets the size limits for SplitShotgunDiffWithOptions. A
+// limit of 0 or less is not applied.
+type DiffSplitOptions struct {
+	LineLimit  int    `json:"lineLimit"`  // Approximate: merged splits may exceed it by 20%, splits flagged Oversize by more
+	TokenLimit int    `json:"tokenLimit"` // Estimated tokens (see estimateTokens); only splits flagged Oversize exceed it
+	RootDir    string `json:"rootDir"`    // Project a whole-file response is diffed against; required for such responses
+}
 
-	var fileDiffBlocks []string
+// diffSize is the size of a piece of diff text in lines and estimated tokens.
+type diffSize struct {
+	lines, tokens int
+}
 
-	if len(startIndices) == 0 {
-		// If no "diff --git" is found, treat the whole input as a single block
-		runtime.LogWarning(a.ctx, fmt.Sprintf("SplitShotgunDiff: No 'diff --git' blocks found in input. Treating as single block."))
-		if strings.TrimSpace(gitDiffText) != "" {
-			fileDiffBlocks = append(fileDiffBlocks, gitDiffText)
-		}
-	} else {
-		// Split the text based on the start indices
-		for i := 0; i < len(startIndices); i++ {
-			start := startIndices[i][0]
-			end := len(gitDiffText)
-			if i+1 < len(startIndices) {
-				end = startIndices[i+1][0]
-			}
-			block := gitDiffText[start:end]
-			block = strings.TrimSpace(block)
-			if block != "" {
-				fileDiffBlocks = append(fileDiffBlocks, block)
-			}
-		}
-	}
+func measureDiff(text string) diffSize {
+	return diffSize{lines: strings.Count(text, "\n") + 1, tokens: estimateTokens(text)}
+}
 
-	var splitDiffs []string
-	var currentSplitContent strings.Builder
-	currentSplitLines := 0
+// diffSeparator is the newline that joins two pieces of diff text. It is
+// counted as a whole line and token, so summed sizes never underestimate the
+// joined text.
+var diffSeparator = diffSize{lines: 1, tokens: 1}
 
-	hunkHeaderRegex := regexp.MustCompile(`^@@ .* @@`)
+func (s diffSize) plus(o diffSize) diffSize {
+	return diffSize{lines: s.lines + o.lines, tokens: s.tokens + o.tokens}
+}
 
-	for _, fileBlock := range fileDiffBlocks {
-		// fileBlock is already trimmed by the splitting logic above, but continue check is fine
-		if fileBlock == "" { continue }
+func (o DiffSplitOptions) limited() bool {
+	return o.LineLimit > 0 || o.TokenLimit > 0
+}
 
-		fileBlockLines := strings.Split(fileBlock, "\n")
-		numLinesInFileBlock := len(fileBlockLines)
+// exceeds reports whether s is over either limit. Without any limit every
+// piece counts as too large, so each hunk becomes its own split.
+func (o DiffSplitOptions) exceeds(s diffSize) bool {
+	if !o.limited() {
+		return true
+	}
+	return (o.LineLimit > 0 && s.lines > o.LineLimit) || (o.TokenLimit > 0 && s.tokens > o.TokenLimit)
+}
 
-		// Check if the fileBlock itself is too large
-		if numLinesInFileBlock > approxLineLimit {
-			// If there's pending content in currentSplitContent, finalize it
-			if currentSplitContent.Len() > 0 {
-				splitDiffs = append(splitDiffs, currentSplitContent.String())
-				currentSplitContent.Reset()
-				currentSplitLines = 0
-			}
+// DiffSplit is one part of a split diff, with what the UI shows about it.
+type DiffSplit struct {
+	ID       string   `json:"id"` // Derived from the diff text, so the same split keeps its ID across runs
+	Diff     string   `json:"diff"`
+	Files    []string `json:"files"`   // In diff order
+	Added    int      `json:"added"`   // Added lines
+	Removed  int      `json:"removed"` // Removed lines
+	Hunks    int      `json:"hunks"`
+	Lines    int      `json:"lines"`
+	Tokens   int      `json:"tokens"`   // Estimated, see estimateTokens
+	Oversize bool     `json:"oversize"` // Over the limits: it holds a single piece that cannot be cut, such as a large new file
+}
 
-			// This fileBlock is too large, needs to be split by hunks
-			// Extract file header (lines before the first hunk)
-			firstHunkIndex := -1
-			for i, line := range fileBlockLines {
-				if hunkHeaderRegex.MatchString(line) {
-					firstHunkIndex = i
-					break
+// newDiffSplit describes the diff text of a split made of the given file diffs.
+func newDiffSplit(diff string, files []*unidiff.FilePatch) DiffSplit {
+	size := measureDiff(diff)
+	split := DiffSplit{ID: sha256Hex(diff)[:12], Diff: diff, Files: []string{}, Lines: size.lines, Tokens: size.tokens}
+	for _, f := range files {
+		split.Files = append(split.Files, f.Path())
+		split.Hunks += len(f.Hunks)
+		for _, h := range f.Hunks {
+			for _, l := range h.Lines {
+				switch l.Kind {
+				case unidiff.HunkLineAdd:
+					split.Added++
+				case unidiff.HunkLineDelete:
+					split.Removed++
 				}
 			}
+		}
+	}
+	return split
+}
 
-			if firstHunkIndex == -1 { // No hunks found, but block is large? Unusual. Treat as one large piece.
-				runtime.LogWarning(a.ctx, fmt.Sprintf("SplitShotgunDiff: Large file block without hunks in '%s'. Treating as single block.", getPathFromDiffHeader(fileBlockLines[0])))
-				splitDiffs = append(splitDiffs, fileBlock+"\n") // Add newline for consistency if it's a full block
-				continue
-			}
+func diffSplitTexts(splits []DiffSplit, err error) ([]string, error) {
+	if err != nil {
+		return nil, err
+	}
+	texts := make([]string, len(splits))
+	for i, s := range splits {
+		texts[i] = s.Diff
+	}
+	return texts, nil
+}
+
+// SplitShotgunDiff parses a Git diff string and splits it into multiple
+// smaller Git diff strings, each not exceeding approxLineLimit lines.
+// It tries to split between file diffs first, then between hunks if a single file diff is too large.
+// Whole-file responses need a project root, see SplitShotgunDiffWithOptions.
+func (a *App) SplitShotgunDiff(gitDiffText string, approxLineLimit int) ([]string, error) {
+	return a.SplitShotgunDiffWithOptions(gitDiffText, DiffSplitOptions{LineLimit: approxLineLimit})
+}
 
-			fileHeader := strings.Join(fileBlockLines[:firstHunkIndex], "\n") + "\n"
-			numLinesInHeader := firstHunkIndex
+// SplitShotgunDiffWithOptions splits a diff into smaller diffs within a line
+// and/or token limit. It splits between file diffs first, then between hunks,
+// and finally inside hunks that are too large on their own, at blank lines in
+// unchanged context (see splitOversizedHunk). A piece that cannot be cut, such
+// as a large new file, becomes a split of its own flagged DiffSplit.Oversize.
+// Related pieces prefer the same split: hunks of one file, a test and the file
+// it tests, then files of one directory (see affinityKeys). Each split keeps
+// the order of the original diff, and splits are ordered by where they start.
+// The diff is repaired first (see repairDiff), as model output is often malformed.
+// A response made of whole <file path="..."> blocks is first diffed against opts.RootDir.
+func (a *App) SplitShotgunDiffWithOptions(gitDiffText string, opts DiffSplitOptions) ([]string, error) {
+	return diffSplitTexts(a.SplitShotgunDiffDetailed(gitDiffText, opts))
+}
 
-			var currentFileSplitHunks strings.Builder
-			currentFileSplitHunkLines := 0
+// SplitShotgunDiffDetailed splits a diff like SplitShotgunDiffWithOptions and
+// describes each split: its files, added and removed lines, hunks, and an ID
+// the UI can use to track which splits have been applied.
+func (a *App) SplitShotgunDiffDetailed(gitDiffText string, opts DiffSplitOptions) ([]DiffSplit, error) {
+	return splitDiff(gitDiffText, opts, runtimeLog{a.ctx})
+}
 
-			hunkStartIndex := firstHunkIndex
-			for hunkStartIndex < len(fileBlockLines) {
-				// Find the end of the current hunk
-				hunkEndIndex := hunkStartIndex + 1
-				for hunkEndIndex < len(fileBlockLines) && !hunkHeaderRegex.MatchString(fileBlockLines[hunkEndIndex]) {
-					hunkEndIndex++
-				}
-				
-				currentHunkContent := strings.Join(fileBlockLines[hunkStartIndex:hunkEndIndex], "\n")
-				numLinesInCurrentHunk := hunkEndIndex - hunkStartIndex
-
-				// If this single hunk (plus header) is larger than limit, it gets its own split
-				if numLinesInHeader + numLinesInCurrentHunk > approxLineLimit && currentFileSplitHunkLines == 0 {
-					splitDiffs = append(splitDiffs, fileHeader + currentHunkContent + "\n")
-					hunkStartIndex = hunkEndIndex
-					continue
-				}
+// diffSplitLog receives the progress messages of splitDiff.
+type diffSplitLog interface {
+	Infof(format string, args ...interface{})
+	Warningf(format string, args ...interface{})
+}
 
-				// If adding this hunk exceeds the limit (for this file's partial split)
-				if currentFileSplitHunkLines > 0 && (numLinesInHeader + currentFileSplitHunkLines + numLinesInCurrentHunk > approxLineLimit) {
-					splitDiffs = append(splitDiffs, fileHeader + currentFileSplitHunks.String())
-					currentFileSplitHunks.Reset()
-					currentFileSplitHunkLines = 0
-				}
+// runtimeLog writes to the Wails log of ctx.
+type runtimeLog struct{ ctx context.Context }
 
-				currentFileSplitHunks.WriteString(currentHunkContent + "\n")
-				currentFileSplitHunkLines += numLinesInCurrentHunk
-				hunkStartIndex = hunkEndIndex
-			}
+func (l runtimeLog) Infof(format string, args ...interface{}) {
+	runtime.LogInfof(l.ctx, format, args...)
+}
 
-			// Add any remaining hunks for the current file
-			if currentFileSplitHunks.Len() > 0 {
-				splitDiffs = append(splitDiffs, fileHeader + currentFileSplitHunks.String())
-			}
+func (l runtimeLog) Warningf(format string, args ...interface{}) {
+	runtime.LogWarningf(l.ctx, format, args...)
+}
 
-		} else { // File block is not too large by itself
-			// If adding this fileBlock would exceed the limit for the current_split
-			if currentSplitLines > 0 && (currentSplitLines + numLinesInFileBlock > approxLineLimit) {
-				splitDiffs = append(splitDiffs, currentSplitContent.String())
-				currentSplitContent.Reset()
-				currentSplitLines = 0
-			}
-			currentSplitContent.WriteString(fileBlock + "\n") // Add newline between file blocks
-			currentSplitLines += numLinesInFileBlock
-		}
-	}
+// splitDiff implements SplitShotgunDiffDetailed, logging to log.
+func splitDiff(gitDiffText string, opts DiffSplitOptions, log diffSplitLog) ([]DiffSplit, error) {
+	log.Infof("SplitShotgunDiff called with line limit: %d, token limit: %d for git diff text", opts.LineLimit, opts.TokenLimit)
 
-	// Add any remaining content as the final split
-	if currentSplitContent.Len() > 0 {
-		splitDiffs = append(splitDiffs, currentSplitContent.String())
+	if strings.TrimSpace(gitDiffText) == "" {
+		return []DiffSplit{}, nil
 	}
-	
-	// Trim trailing newlines from each split diff for consistency and prepare for potential merging
-	initialSplitDiffs := make([]string, 0, len(splitDiffs))
-	initialSplitSizes := make([]int, 0, len(splitDiffs))
-	for _, sDiff := range splitDiffs {
-		trimmedDiff := strings.TrimSpace(sDiff)
-		if trimmedDiff != "" {
-			initialSplitDiffs = append(initialSplitDiffs, trimmedDiff)
-			initialSplitSizes = append(initialSplitSizes, len(strings.Split(trimmedDiff, "\n")))
+
+	if isFileResponse(gitDiffText) {
+		if opts.RootDir == "" {
+			return nil, fmt.Errorf("a response with whole files needs a project root to diff against")
+		}
+		if err := checkProjectRoot(opts.RootDir); err != nil {
+			return nil, err
+		}
+		converted, err := fileResponseDiff(opts.RootDir, gitDiffText)
+		if err != nil {
+			return nil, fmt.Errorf("failed to diff whole-file response: %w", err)
+		}
+		log.Infof("SplitShotgunDiff: converted whole-file response with %d file(s) to a diff", len(converted.Files))
+		gitDiffText = converted.Diff
+		if gitDiffText == "" {
+			return []DiffSplit{}, nil
 		}
 	}
 
-	// --- Advanced Merging Logic ---
-	// If approxLineLimit is not positive, merging logic is skipped.
-	if approxLineLimit <= 0 {
-		runtime.LogInfof(a.ctx, "approxLineLimit is %d, skipping merge step. Returning %d initial splits.", approxLineLimit, len(initialSplitDiffs))
-		return initialSplitDiffs, nil
+	gitDiffText, repairs := repairDiff(gitDiffText)
+	for _, r := range repairs {
+		log.Infof("SplitShotgunDiff: repaired diff (%s) %s: %s", r.Kind, r.File, r.Message)
 	}
 
-	// If there's 0 or 1 split, no merging is possible or needed.
-	if len(initialSplitDiffs) <= 1 {
-		runtime.LogInfof(a.ctx, "Only %d initial split(s), no merging needed. Returning as is.", len(initialSplitDiffs))
-		return initialSplitDiffs, nil
+	// Hunk bodies are read by prefix rather than trusting the header counts,
+	// since diffs pasted from a model are often miscounted.
+	patch, err := unidiff.ParseLenient(gitDiffText)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse diff: %w", err)
+	}
+
+	if len(patch.Files) == 0 {
+		// If no file diff is found, treat the whole input as a single block
+		log.Warningf("SplitShotgunDiff: No file diffs found in input. Treating as single block.")
+		return []DiffSplit{newDiffSplit(strings.Trim(gitDiffText, "\n"), nil)}, nil
 	}
 
-	runtime.LogInfof(a.ctx, "Starting advanced merge step for %d initial splits with approxLineLimit %d.", len(initialSplitDiffs), approxLineLimit)
+	units := diffUnits(patch, opts, log)
+
+	initialGroups := initialDiffGroups(units, opts)
 
 	// Allow merged splits to be up to 20% larger than the user's approximate line limit.
-	maxAllowedLines := int(float64(approxLineLimit) * 1.20)
-	runtime.LogInfof(a.ctx, "Max allowed lines per merged split: %d", maxAllowedLines)
+	// The token limit is usually a hard model budget and gets no slack.
+	maxAllowed := DiffSplitOptions{LineLimit: int(float64(opts.LineLimit) * 1.20), TokenLimit: opts.TokenLimit}
 
-	// This is a modified bin packing problem approach:
-	// 1. Initialize splitsToMerge list with initial splits
-	// 2. Define a cost function to evaluate merged solutions
-	// 3. Try various combinations, picking the best solution
+	// --- Advanced Merging Logic ---
+	// If no limit is positive, merging logic is skipped.
+	if !opts.limited() {
+		log.Infof("No positive limit, skipping merge step. Returning %d initial splits.", len(initialGroups))
+		return renderDiffGroups(initialGroups, maxAllowed, log), nil
+	}
 
-	type MergeGroup struct {
-		Splits    []string
-		LineCount int
+	// If there's 0 or 1 split, no merging is possible or needed.
+	if len(initialGroups) <= 1 {
+		log.Infof("Only %d initial split(s), no merging needed. Returning as is.", len(initialGroups))
+		return renderDiffGroups(initialGroups, maxAllowed, log), nil
 	}
 
+	log.Infof("Starting advanced merge step for %d initial splits with line limit %d, token limit %d.", len(initialGroups), opts.LineLimit, opts.TokenLimit)
+	log.Infof("Max allowed lines per merged split: %d", maxAllowed.LineLimit)
+
 	// First, identify large splits that must be their own group as they're already close to or exceeding the limit
-	var largeSplits []MergeGroup
-	var smallSplits []int // Indices of small splits we'll try to recombine
-	
-	for i, size := range initialSplitSizes {
-		if size >= approxLineLimit { // Already close to or above line limit - keep as is
-			largeSplits = append(largeSplits, MergeGroup{
-				Splits:    []string{initialSplitDiffs[i]},
-				LineCount: size,
-			})
-			runtime.LogInfof(a.ctx, "Split %d with %d lines kept as standalone group (already large)", i, size)
+	var largeSplits []*diffGroup
+	var smallSplits []*diffGroup // Small splits we'll try to recombine
+
+	for i, group := range initialGroups {
+		size := group.size
+		if (opts.LineLimit > 0 && size.lines >= opts.LineLimit) || (opts.TokenLimit > 0 && size.tokens >= opts.TokenLimit) { // Already close to or above a limit - keep as is
+			largeSplits = append(largeSplits, group)
+			log.Infof("Split %d with %d lines (~%d tokens) kept as standalone group (already large)", i, size.lines, size.tokens)
 		} else {
-			smallSplits = append(smallSplits, i)
+			smallSplits = append(smallSplits, group)
 		}
 	}
 
 	// If no small splits, return the identified large splits as-is
 	if len(smallSplits) == 0 {
-		runtime.LogInfof(a.ctx, "No small splits to merge, returning %d large splits as-is", len(largeSplits))
-		result := make([]string, len(largeSplits))
-		for i, group := range largeSplits {
-			result[i] = group.Splits[0] // Each large split is its own group with one split
-		}
-		return result, nil
+		log.Infof("No small splits to merge, returning %d large splits as-is", len(largeSplits))
+		return renderDiffGroups(largeSplits, maxAllowed, log), nil
 	}
 
-	// For small splits, try to find the optimal combination
-	smallSplitData := make([]struct {
-		Content   string
-		LineCount int
-	}, len(smallSplits))
-	
-	for i, idx := range smallSplits {
-		smallSplitData[i].Content = initialSplitDiffs[idx]
-		smallSplitData[i].LineCount = initialSplitSizes[idx]
+	// Pack the small splits into as few groups as possible (see packDiffGroups)
+	currentSolution := packDiffGroups(smallSplits, maxAllowed)
+	log.Infof("Packed %d small splits into %d groups with score %.2f",
+		len(smallSplits), len(currentSolution), diffGroupsScore(currentSolution, maxAllowed))
+
+	// Combine the large splits and the optimized small splits
+	finalGroups := append(largeSplits, currentSolution...)
+	log.Infof("Final solution: %d groups (%d large, %d optimized small groups)",
+		len(finalGroups), len(largeSplits), len(currentSolution))
+	for i, group := range finalGroups {
+		log.Infof("Group %d: %d units, %d lines (~%d tokens)", i, len(group.units), group.size.lines, group.size.tokens)
 	}
 
-	// Helper function to calculate solution score (lower is better)
-	// Prefers fewer groups and groups closer to maxAllowedLines in size
-	calculateSolutionScore := func(solution []MergeGroup) float64 {
-		if len(solution) == 0 {
-			return float64(1<<31 - 1) // Maximum value, invalid solution
+	mergedSplitsResult := renderDiffGroups(finalGroups, maxAllowed, log)
+	log.Infof("Split git diff: %d initial splits, merged into %d final splits. Target line limit ~%d (merged max %d), token limit %d.",
+		len(initialGroups), len(mergedSplitsResult), opts.LineLimit, maxAllowed.LineLimit, opts.TokenLimit)
+	return mergedSplitsResult, nil
+}
+
+// diffUnit is a part of a diff that is never divided further: a whole file
+// diff, or a run of hunks of a file too large for one split.
+type diffUnit struct {
+	file      *unidiff.FilePatch // Restricted to the unit's hunks
+	fileIndex int                // Position of the file in the diff
+	hunkIndex int                // Position of the unit's first hunk in the file
+	size      diffSize
+}
+
+func newDiffUnit(file *unidiff.FilePatch, fileIndex, hunkIndex int) diffUnit {
+	return diffUnit{file: file, fileIndex: fileIndex, hunkIndex: hunkIndex, size: measureDiff(strings.Trim(file.String(), "\n"))}
+}
+
+// diffUnits cuts a diff into units. A file diff within the limits is one unit;
+// a larger one is split between hunks, and hunks too large on their own are
+// cut into sub-hunks first.
+func diffUnits(patch *unidiff.Patch, opts DiffSplitOptions, log diffSplitLog) []diffUnit {
+	var units []diffUnit
+	for fileIndex, filePatch := range patch.Files {
+		whole := newDiffUnit(filePatch, fileIndex, 0)
+		if !opts.exceeds(whole.size) {
+			units = append(units, whole)
+			continue
+		}
+		if len(filePatch.Hunks) == 0 { // No hunks found, but block is large? Unusual. Treat as one large piece.
+			log.Warningf("SplitShotgunDiff: Large file block without hunks in '%s'. Treating as single block.", filePatch.Path())
+			units = append(units, whole)
+			continue
+		}
+
+		headerSize := measureDiff(strings.Join(filePatch.HeaderLines(), "\n"))
+		var hunks []*unidiff.Hunk
+		for _, hunk := range filePatch.Hunks {
+			pieces := splitOversizedHunk(hunk, headerSize, opts)
+			if len(pieces) > 1 {
+				log.Infof("SplitShotgunDiff: Split oversized hunk %q in '%s' into %d sub-hunks.", hunk.HeaderLine(), filePatch.Path(), len(pieces))
+			}
+			hunks = append(hunks, pieces...)
 		}
-		
-		score := float64(len(solution)) * 1000 // Base score is number of groups * 1000
-		
-		// Add penalties for uneven groups and groups far below the limit
-		for _, group := range solution {
-			// Penalty for how far the group is from the ideal size (maxAllowedLines)
-			// We prefer groups to be closer to maxAllowedLines, but not over
-			utilization := float64(group.LineCount) / float64(maxAllowedLines)
-			if utilization > 1.0 {
-				// Severe penalty for exceeding max allowed lines
-				score += 10000 * (utilization - 1.0)
-			} else {
-				// Penalty for underutilization
-				score += 100 * (1.0 - utilization)
+
+		// Consecutive hunks are packed into runs within the limits; a hunk too
+		// large for the limits with the header gets a run of its own
+		runStart := 0
+		var runSize diffSize
+		for i, hunk := range hunks {
+			hunkSize := measureDiff(strings.Join(hunk.RenderLines(), "\n"))
+			if i > runStart && opts.exceeds(headerSize.plus(runSize).plus(diffSeparator).plus(hunkSize)) {
+				units = append(units, newDiffUnit(filePatch.WithHunks(hunks[runStart:i]), fileIndex, runStart))
+				runStart, runSize = i, diffSize{}
 			}
+			runSize = runSize.plus(diffSeparator).plus(hunkSize)
 		}
-		
-		return score
+		units = append(units, newDiffUnit(filePatch.WithHunks(hunks[runStart:]), fileIndex, runStart))
 	}
+	return units
+}
 
-	// Create initial solution with each small split in its own group
-	initialSolution := make([]MergeGroup, len(smallSplitData))
-	for i, data := range smallSplitData {
-		initialSolution[i] = MergeGroup{
-			Splits:    []string{data.Content},
-			LineCount: data.LineCount,
+// initialDiffGroups packs the units into initial splits in affinity order, so
+// that a file's hunks, a test and its implementation, and files of one
+// directory tend to share a split.
+func initialDiffGroups(units []diffUnit, opts DiffSplitOptions) []*diffGroup {
+	var groups []*diffGroup
+	current := newDiffGroup()
+	for _, unit := range affinityOrder(units) {
+		if len(current.units) > 0 && opts.exceeds(current.size.plus(diffSeparator).plus(unit.size)) {
+			groups = append(groups, current)
+			current = newDiffGroup()
 		}
+		current.add(unit)
 	}
+	if len(current.units) > 0 {
+		groups = append(groups, current)
+	}
+	return groups
+}
+
+// diffGroup is a set of units that goes into one split.
+type diffGroup struct {
+	units    []diffUnit
+	size     diffSize
+	keys     affinityKeys
+	affinity int // Sum of the affinities of the merges that built the group
+}
+
+func newDiffGroup() *diffGroup {
+	return &diffGroup{keys: newAffinityKeys()}
+}
+
+func (g *diffGroup) add(unit diffUnit) {
+	if len(g.units) > 0 {
+		g.size = g.size.plus(diffSeparator)
+	}
+	g.units = append(g.units, unit)
+	g.size = g.size.plus(unit.size)
+	g.keys.add(unit)
+}
+
+// merge returns a new group holding the units of g and o.
+func (g *diffGroup) merge(o *diffGroup) *diffGroup {
+	return &diffGroup{
+		units:    append(append([]diffUnit(nil), g.units...), o.units...),
+		size:     g.size.plus(diffSeparator).plus(o.size),
+		keys:     g.keys.union(o.keys),
+		affinity: g.affinity + o.affinity + g.keys.affinity(o.keys),
+	}
+}
 
-	// Apply a greedy bottom-up algorithm to merge small splits
-	// Try to select pairs of groups to merge, prioritizing those that give the best improvement in score
-	currentSolution := initialSolution
-	
-	for {
-		bestScore := calculateSolutionScore(currentSolution)
-		var bestMerge struct {
-			GroupIndex1 int
-			GroupIndex2 int
-			NewScore    float64
+// sortedUnits returns the units in the order of the original diff.
+func (g *diffGroup) sortedUnits() []diffUnit {
+	units := append([]diffUnit(nil), g.units...)
+	sort.SliceStable(units, func(i, j int) bool {
+		if units[i].fileIndex != units[j].fileIndex {
+			return units[i].fileIndex < units[j].fileIndex
 		}
-		bestMerge.NewScore = bestScore
-		mergeFound := false
-		
-		// Try combining each pair of groups
-		for i := 0; i < len(currentSolution); i++ {
-			for j := i + 1; j < len(currentSolution); j++ {
-				// Check if merging is valid (doesn't exceed limits)
-				// +1 for the newline separator between diffs
-				combinedLineCount := currentSolution[i].LineCount + currentSolution[j].LineCount + 1
-				if combinedLineCount <= maxAllowedLines {
-					// Try the merge and evaluate
-					newSolution := make([]MergeGroup, 0, len(currentSolution) - 1)
-					
-					// Add the merged group
-					merged := MergeGroup{
-						Splits:    append(append([]string{}, currentSolution[i].Splits...), currentSolution[j].Splits...),
-						LineCount: combinedLineCount,
-					}
-					newSolution = append(newSolution, merged)
-					
-					// Add all other groups
-					for k := 0; k < len(currentSolution); k++ {
-						if k != i && k != j {
-							newSolution = append(newSolution, currentSolution[k])
-						}
-					}
-					
-					newScore := calculateSolutionScore(newSolution)
-					if newScore < bestMerge.NewScore {
-						bestMerge.GroupIndex1 = i
-						bestMerge.GroupIndex2 = j
-						bestMerge.NewScore = newScore
-						mergeFound = true
-					}
-				}
+		return units[i].hunkIndex < units[j].hunkIndex
+	})
+	return units
+}
+
+// render returns the split: the units in the order of the original diff, with
+// units of the same file combined into one file diff.
+func (g *diffGroup) render() DiffSplit {
+	units := g.sortedUnits()
+	var files []*unidiff.FilePatch
+	var blocks []string
+	for i := 0; i < len(units); {
+		file := units[i].file
+		j := i + 1
+		if j < len(units) && units[j].fileIndex == units[i].fileIndex {
+			hunks := append([]*unidiff.Hunk(nil), file.Hunks...)
+			for ; j < len(units) && units[j].fileIndex == units[i].fileIndex; j++ {
+				hunks = append(hunks, units[j].file.Hunks...)
 			}
+			file = file.WithHunks(hunks)
 		}
-		
-		// If no improvement was found, stop
-		if !mergeFound || bestMerge.NewScore >= bestScore {
-			break
+		files = append(files, file)
+		blocks = append(blocks, strings.Trim(file.String(), "\n"))
+		i = j
+	}
+	return newDiffSplit(strings.Join(blocks, "\n"), files)
+}
+
+// renderDiffGroups renders the groups, ordered by where each starts in the
+// original diff, and flags and logs the splits over maxAllowed.
+func renderDiffGroups(groups []*diffGroup, maxAllowed DiffSplitOptions, log diffSplitLog) []DiffSplit {
+	ordered := make([][]diffUnit, len(groups))
+	for i, g := range groups {
+		ordered[i] = g.sortedUnits()
+	}
+	indexes := make([]int, len(groups))
+	for i := range indexes {
+		indexes[i] = i
+	}
+	sort.SliceStable(indexes, func(x, y int) bool {
+		a, b := ordered[indexes[x]][0], ordered[indexes[y]][0]
+		if a.fileIndex != b.fileIndex {
+			return a.fileIndex < b.fileIndex
 		}
-		
-		// Apply the best merge
-		i, j := bestMerge.GroupIndex1, bestMerge.GroupIndex2
-		if i > j {
-			i, j = j, i // Ensure i < j to simplify logic below
+		return a.hunkIndex < b.hunkIndex
+	})
+	result := make([]DiffSplit, 0, len(groups))
+	for _, i := range indexes {
+		split := groups[i].render()
+		if maxAllowed.limited() && maxAllowed.exceeds(diffSize{lines: split.Lines, tokens: split.Tokens}) {
+			split.Oversize = true
+			log.Warningf("SplitShotgunDiff: split %s (%s) has %d lines (~%d tokens), over the limits; it cannot be cut further.",
+				split.ID, strings.Join(split.Files, ", "), split.Lines, split.Tokens)
 		}
-		
-		// Merge group j into group i
-		combinedLineCount := currentSolution[i].LineCount + currentSolution[j].LineCount + 1
-		currentSolution[i].Splits = append(currentSolution[i].Splits, currentSolution[j].Splits...)
-		currentSolution[i].LineCount = combinedLineCount
-		
-		// Remove group j
-		currentSolution = append(currentSolution[:j], currentSolution[j+1:]...)
-		
-		runtime.LogInfof(a.ctx, "Merged two groups, solution now has %d groups with score %.2f", 
-			len(currentSolution), bestMerge.NewScore)
+		result = append(result, split)
 	}
+	return result
+}
 
-	// Combine the large splits and the optimized small splits
-	finalGroups := append(largeSplits, currentSolution...)
-	runtime.LogInfof(a.ctx, "Final solution: %d groups (%d large, %d optimized small groups)", 
-		len(finalGroups), len(largeSplits), len(currentSolution))
+// splitOversizedHunk cuts a hunk that is over the limits, together with its
+// file header, into consecutive sub-hunks with correct ranges. Cuts are made
+// only between two unchanged context lines with changes on both sides, so each
+// sub-hunk keeps leading and trailing context (git apply anchors a hunk without
+// trailing context to the end of the file). A cut right after a blank line is
+// preferred. A hunk with no such place, like a new file, is returned whole.
+func splitOversizedHunk(h *unidiff.Hunk, headerSize diffSize, opts DiffSplitOptions) []*unidiff.Hunk {
+	hunkHeaderSize := measureDiff(h.HeaderLine())
+	if !opts.limited() || !opts.exceeds(headerSize.plus(diffSeparator).plus(measureDiff(strings.Join(h.RenderLines(), "\n")))) {
+		return []*unidiff.Hunk{h}
+	}
 
-	// Build the final result strings
-	mergedSplitsResult := make([]string, len(finalGroups))
-	for i, group := range finalGroups {
-		if len(group.Splits) == 1 {
-			// Single split, no need to join
-			mergedSplitsResult[i] = group.Splits[0]
-		} else {
-			// Multiple splits, join with newlines
-			mergedSplitsResult[i] = strings.Join(group.Splits, "\n")
+	// Prefix sums of line sizes and of changed lines
+	sizes := make([]diffSize, len(h.Lines)+1)
+	changes := make([]int, len(h.Lines)+1)
+	for i, l := range h.Lines {
+		sizes[i+1] = sizes[i].plus(diffSize{lines: 1, tokens: estimateTokens(l.String() + "\n")}) // With its newline
+		changes[i+1] = changes[i]
+		if l.Kind == unidiff.HunkLineDelete || l.Kind == unidiff.HunkLineAdd {
+			changes[i+1]++
 		}
-		runtime.LogInfof(a.ctx, "Group %d: %d splits, %d lines", i, len(group.Splits), group.LineCount)
+	}
+	fits := func(start, end int) bool {
+		body := diffSize{lines: sizes[end].lines - sizes[start].lines, tokens: sizes[end].tokens - sizes[start].tokens}
+		return !opts.exceeds(headerSize.plus(diffSeparator).plus(hunkHeaderSize).plus(diffSeparator).plus(body))
+	}
+	canCut := func(start, i int) bool {
+		return h.Lines[i-1].Kind == unidiff.HunkLineContext && h.Lines[i].Kind == unidiff.HunkLineContext &&
+			changes[i] > changes[start] && changes[len(h.Lines)] > changes[i]
 	}
 
-	runtime.LogInfof(a.ctx, "Split git diff: %d initial splits, merged into %d final splits. Target line limit ~%d (merged max %d).",
-		len(initialSplitDiffs), len(mergedSplitsResult), approxLineLimit, maxAllowedLines)
-	return mergedSplitsResult, nil
-}
+	var pieces []*unidiff.Hunk
+	oldStart, newStart := h.OldStart, h.NewStart
+	for start := 0; start < len(h.Lines); {
+		end := len(h.Lines)
+		if !fits(start, end) {
+			cut, blankCut := -1, -1
+			for i := start + 1; i < len(h.Lines); i++ {
+				if !canCut(start, i) {
+					continue
+				}
+				if !fits(start, i) {
+					if cut < 0 {
+						cut = i // Nothing fits; keep the piece as small as possible
+					}
+					break
+				}
+				cut = i
+				if strings.TrimSpace(h.Lines[i-1].Text) == "" {
+					blankCut = i
+				}
+			}
+			// A blank-line cut wins unless it would leave the piece less than half full
+			if blankCut > 0 && blankCut-start >= (cut-start)/2 {
+				cut = blankCut
+			}
+			if cut > 0 {
+				end = cut
+			}
+		}
 
-// Helper to get a/path from "diff --git a/path b/path"
-func getPathFromDiffHeader(diffHeaderLine string) string {
-	parts := strings.Fields(diffHeaderLine)
-	if len(parts) >= 3 {
-		return parts[2] // a/path
+		piece := &unidiff.Hunk{OldStart: oldStart, NewStart: newStart, Section: h.Section, Lines: h.Lines[start:end]}
+		for _, l := range piece.Lines {
+			switch l.Kind {
+			case unidiff.HunkLineContext:
+				piece.OldLines++
+				piece.NewLines++
+			case unidiff.HunkLineDelete:
+				piece.OldLines++
+			case unidiff.HunkLineAdd:
+				piece.NewLines++
+			}
+		}
+		oldStart += piece.OldLines
+		newStart += piece.NewLines
+		pieces = append(pieces, piece)
+		start = end
 	}
-	return "unknown_file"
+	if len(pieces) == 1 {
+		return []*unidiff.Hunk{h}
+	}
+	pieces[len(pieces)-1].Trailer = h.Trailer
+	return pieces
 }
 
 // StartupTest initializes the app for testing
@@ -372,4 +516,4 @@ func (a *App) StartupTest(ctx context.Context) {
 	a.settings.CustomIgnoreRules = defaultCustomIgnoreRulesContent
 	a.settings.CustomPromptRules = defaultCustomPromptRulesContent
 	_ = a.compileCustomIgnorePatterns()
-} 
\ No newline at end of file
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"shotgun_code/internal/unidiff"
+)
+
+func gitRun(t *testing.T, dir, stdin string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Stdin = strings.NewReader(stdin)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return string(out)
+}
+
+// goSource returns a file of n functions separated by blank lines, with the
+// bodies of the functions in changed altered.
+func goSource(n int, changed map[int]bool) string {
+	var b strings.Builder
+	b.WriteString("package pkg\n")
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, "\nfunc f%d() int {\n\tx := %d\n\ty := x * 2\n", i, i)
+		if changed[i] {
+			fmt.Fprintf(&b, "\tlog(%d)\n\treturn x + y + 1\n}\n", i)
+		} else {
+			b.WriteString("\treturn x + y\n}\n")
+		}
+	}
+	return b.String()
+}
+
+// splitTestRepo creates a repository holding the base tree and returns it with
+// a diff -M of the changed tree: edits spread over a large file, a large hunk,
+// tests next to their files, many small files, a large new file, a deletion
+// and a rename.
+func splitTestRepo(t *testing.T) (dir, diff string) {
+	dir = t.TempDir()
+	gitRun(t, dir, "", "init", "-q")
+	gitRun(t, dir, "", "config", "user.email", "test@example.com")
+	gitRun(t, dir, "", "config", "user.name", "test")
+
+	base := map[string]string{
+		"pkg/big.go":      goSource(60, nil),
+		"pkg/big_test.go": goSource(10, nil),
+		"pkg/dense.go":    goSource(40, nil),
+		"old/gone.txt":    strings.Repeat("obsolete\n", 20),
+		"old/moved.go":    goSource(8, nil),
+	}
+	for i := 0; i < 30; i++ {
+		base[fmt.Sprintf("web/w%d/file%d.js", i%4, i)] = fmt.Sprintf("export const v%d = %d;\nexport const name = 'w%d';\n", i, i, i)
+	}
+	writeTestFiles(t, dir, base)
+	gitRun(t, dir, "", "add", "-A")
+	gitRun(t, dir, "", "commit", "-q", "-m", "base")
+
+	dense := make(map[int]bool)
+	for i := 5; i < 35; i++ {
+		dense[i] = true // One hunk over many blank context lines
+	}
+	changed := map[string]string{
+		"pkg/big.go":      goSource(60, map[int]bool{1: true, 15: true, 30: true, 31: true, 58: true}),
+		"pkg/big_test.go": goSource(10, map[int]bool{2: true}),
+		"pkg/dense.go":    goSource(40, dense),
+		"pkg/new.go":      goSource(50, nil),
+		"new/moved.go":    goSource(8, map[int]bool{3: true}),
+	}
+	for i := 0; i < 30; i += 2 {
+		changed[fmt.Sprintf("web/w%d/file%d.js", i%4, i)] = fmt.Sprintf("export const v%d = %d;\nexport const name = 'changed';\n", i, i*10)
+	}
+	writeTestFiles(t, dir, changed)
+	gitRun(t, dir, "", "rm", "-q", "old/gone.txt", "old/moved.go")
+	gitRun(t, dir, "", "add", "-A")
+	diff = gitRun(t, dir, "", "diff", "--cached", "-M")
+	gitRun(t, dir, "", "reset", "-q", "--hard")
+	return dir, diff
+}
+
+func TestSplitDiffSplitsApply(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+	dir, diff := splitTestRepo(t)
+
+	for _, opts := range []DiffSplitOptions{
+		{},
+		{LineLimit: 10},
+		{LineLimit: 40},
+		{LineLimit: 200},
+		{TokenLimit: 150},
+		{TokenLimit: 1000},
+		{LineLimit: 60, TokenLimit: 400},
+	} {
+		t.Run(fmt.Sprintf("lines %d tokens %d", opts.LineLimit, opts.TokenLimit), func(t *testing.T) {
+			splits, err := splitDiff(diff, opts, discardLog{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			maxAllowed := DiffSplitOptions{LineLimit: opts.LineLimit * 6 / 5, TokenLimit: opts.TokenLimit}
+			ids := make(map[string]bool)
+			for i, s := range splits {
+				size := measureDiff(s.Diff)
+				if over := maxAllowed.limited() && maxAllowed.exceeds(size); over != s.Oversize {
+					t.Errorf("split %d has %d lines (~%d tokens), Oversize = %v", i, size.lines, size.tokens, s.Oversize)
+				}
+				if s.Oversize && s.Hunks > 1 {
+					t.Errorf("split %d is oversize with %d hunks", i, s.Hunks)
+				}
+				if ids[s.ID] {
+					t.Errorf("split %d repeats ID %s", i, s.ID)
+				}
+				ids[s.ID] = true
+				if _, err := unidiff.Parse(s.Diff + "\n"); err != nil {
+					t.Errorf("split %d does not parse strictly: %v", i, err)
+				}
+				gitRun(t, dir, s.Diff+"\n", "apply", "--check", "-")
+			}
+
+			// The splits applied one after the other give the whole diff
+			for _, s := range splits {
+				gitRun(t, dir, s.Diff+"\n", "apply", "-")
+			}
+			gitRun(t, dir, "", "add", "-A")
+			if got := gitRun(t, dir, "", "diff", "--cached", "-M"); got != diff {
+				t.Errorf("applying every split gives a different diff:\n%s", got)
+			}
+			gitRun(t, dir, "", "reset", "-q", "--hard")
+			gitRun(t, dir, "", "clean", "-q", "-fd")
+
+			again, err := splitDiff(diff, opts, discardLog{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(again) != len(splits) {
+				t.Fatalf("second split gave %d splits, first %d", len(again), len(splits))
+			}
+			for i := range again {
+				if again[i].ID != splits[i].ID {
+					t.Errorf("split %d ID changed from %s to %s", i, splits[i].ID, again[i].ID)
+				}
+			}
+		})
+	}
+}
+
+func TestSplitDiffKeepsRelatedFilesTogether(t *testing.T) {
+	diff := ""
+	for _, name := range []string{"a/x.go", "b/y.go", "a/x_test.go", "c/z.go", "b/y_test.go"} {
+		diff += fmt.Sprintf("diff --git a/%[1]s b/%[1]s\n--- a/%[1]s\n+++ b/%[1]s\n@@ -1 +1 @@\n-old\n+new\n", name)
+	}
+	splits, err := splitDiff(diff, DiffSplitOptions{LineLimit: 14}, discardLog{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	splitOf := make(map[string]int)
+	for i, s := range splits {
+		for _, f := range s.Files {
+			splitOf[f] = i
+		}
+	}
+	if splitOf["a/x.go"] != splitOf["a/x_test.go"] || splitOf["b/y.go"] != splitOf["b/y_test.go"] {
+		t.Errorf("tests split from their files: %v", splitOf)
+	}
+}
+
+func TestSplitDiffDescribesSplits(t *testing.T) {
+	diff := "diff --git a/a.go b/a.go\n--- a/a.go\n+++ b/a.go\n@@ -1,2 +1,3 @@\n x\n-a\n+b\n+c\n@@ -9 +10 @@\n-d\n+e\n" +
+		"diff --git a/b.go b/b.go\nnew file mode 100644\n--- /dev/null\n+++ b/b.go\n@@ -0,0 +1 @@\n+new\n"
+	splits, err := splitDiff(diff, DiffSplitOptions{LineLimit: 100}, discardLog{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(splits) != 1 {
+		t.Fatalf("%d splits, want 1", len(splits))
+	}
+	s := splits[0]
+	if strings.Join(s.Files, ",") != "a.go,b.go" || s.Added != 4 || s.Removed != 2 || s.Hunks != 3 {
+		t.Errorf("files %v added %d removed %d hunks %d, want [a.go b.go] 4 2 3", s.Files, s.Added, s.Removed, s.Hunks)
+	}
+	if s.Lines != strings.Count(diff, "\n") || s.ID != sha256Hex(s.Diff)[:12] {
+		t.Errorf("lines %d ID %s for %q", s.Lines, s.ID, s.Diff)
+	}
+	if empty, err := splitDiff(" \n", DiffSplitOptions{LineLimit: 10}, discardLog{}); err != nil || len(empty) != 0 {
+		t.Errorf("blank input gave %v, %v", empty, err)
+	}
+}
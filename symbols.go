@@ -0,0 +1,319 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	gitignore "github.com/sabhiram/go-gitignore"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// --- Symbol index (reverse-dependency lookup) ---
+
+// SymbolReferences lists the files that declare and the files that use an identifier.
+type SymbolReferences struct {
+	Identifier   string   `json:"identifier"`
+	DefinedIn    []string `json:"definedIn"`
+	ReferencedIn []string `json:"referencedIn"`
+}
+
+// SymbolIndexer lazily builds and caches a symbol index for the current project.
+// The cache is dropped whenever the file watcher reports a change.
+type SymbolIndexer struct {
+	app          *App
+	mu           sync.Mutex
+	rootDir      string
+	useGitignore bool
+	customIgn    *gitignore.GitIgnore
+	index        *symbolIndex
+}
+
+// symbolIndex maps identifiers and import paths to the files (relative to the
+// root, FileNode.RelPath form) that declare, use or import them. Go selectors
+// are also recorded in qualified form, e.g. "runtime.LogInfo".
+type symbolIndex struct {
+	goModulePath string
+	definitions  map[string]map[string]bool
+	references   map[string]map[string]bool
+	imports      map[string]map[string]bool
+}
+
+var identifierRegex = regexp.MustCompile(`[A-Za-z_$][\w$]*`)
+
+func NewSymbolIndexer(app *App) *SymbolIndexer {
+	return &SymbolIndexer{app: app}
+}
+
+// Invalidate drops the cached index so the next lookup rebuilds it.
+func (si *SymbolIndexer) Invalidate() {
+	si.mu.Lock()
+	si.index = nil
+	si.mu.Unlock()
+}
+
+// indexFor returns the index for rootDir, building it if needed. The index
+// skips what the file tree hides, so it is rebuilt when the ignore settings change.
+func (si *SymbolIndexer) indexFor(rootDir string) (*symbolIndex, error) {
+	si.mu.Lock()
+	defer si.mu.Unlock()
+	useGitignore := si.app.useGitignore
+	var customIgn *gitignore.GitIgnore
+	if si.app.useCustomIgnore {
+		customIgn = si.app.currentCustomIgnorePatterns
+	}
+	if si.index != nil && si.rootDir == rootDir && si.useGitignore == useGitignore && si.customIgn == customIgn {
+		return si.index, nil
+	}
+
+	start := time.Now()
+	idx, err := buildSymbolIndex(rootDir, useGitignore, customIgn)
+	if err != nil {
+		return nil, err
+	}
+	si.rootDir, si.useGitignore, si.customIgn = rootDir, useGitignore, customIgn
+	si.index = idx
+	runtime.LogInfof(si.app.ctx, "Symbol index for %s built in %s (%d identifiers)", rootDir, time.Since(start), len(idx.references))
+	return idx, nil
+}
+
+// buildSymbolIndex indexes the sources under rootDir, skipping files matched
+// by the project's .gitignore when useGitignore is set and by customIgn when
+// it is not nil.
+func buildSymbolIndex(rootDir string, useGitignore bool, customIgn *gitignore.GitIgnore) (*symbolIndex, error) {
+	idx := &symbolIndex{
+		definitions: make(map[string]map[string]bool),
+		references:  make(map[string]map[string]bool),
+		imports:     make(map[string]map[string]bool),
+	}
+	idx.goModulePath = newDependencyResolver(rootDir).goModulePath
+
+	var gitIgn *gitignore.GitIgnore
+	if useGitignore {
+		if ign, err := gitignore.CompileIgnoreFile(filepath.Join(rootDir, ".gitignore")); err == nil {
+			gitIgn = ign
+		}
+	}
+
+	err := filepath.WalkDir(rootDir, func(p string, d fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			if d != nil && d.IsDir() && p != rootDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if p == rootDir {
+			return nil
+		}
+		relPath, _ := filepath.Rel(rootDir, p)
+		pathToMatch := relPath
+		if d.IsDir() {
+			if d.Name() == ".git" || d.Name() == "node_modules" || d.Name() == "vendor" {
+				return filepath.SkipDir
+			}
+			pathToMatch += string(os.PathSeparator)
+		}
+		if (gitIgn != nil && gitIgn.MatchesPath(pathToMatch)) || (customIgn != nil && customIgn.MatchesPath(pathToMatch)) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		ext := strings.ToLower(filepath.Ext(p))
+		switch {
+		case ext == ".go":
+			idx.addGoFile(p, relPath)
+		case jsSourceExts[ext] || pySourceExts[ext]:
+			idx.addTextFile(p, relPath)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to index %s: %w", rootDir, err)
+	}
+	return idx, nil
+}
+
+func addToSet(m map[string]map[string]bool, key, file string) {
+	if m[key] == nil {
+		m[key] = make(map[string]bool)
+	}
+	m[key][file] = true
+}
+
+// addGoFile indexes declarations, identifier uses and imports with go/ast.
+func (idx *symbolIndex) addGoFile(absPath, relPath string) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, absPath, nil, parser.SkipObjectResolution)
+	if err != nil {
+		return
+	}
+
+	declared := make(map[*ast.Ident]bool)
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			declared[d.Name] = true
+			name := d.Name.Name
+			if d.Recv != nil && len(d.Recv.List) > 0 {
+				if recv := receiverTypeName(d.Recv.List[0].Type); recv != "" {
+					addToSet(idx.definitions, recv+"."+name, relPath)
+				}
+			}
+			addToSet(idx.definitions, name, relPath)
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					declared[s.Name] = true
+					addToSet(idx.definitions, s.Name.Name, relPath)
+				case *ast.ValueSpec:
+					for _, n := range s.Names {
+						declared[n] = true
+						addToSet(idx.definitions, n.Name, relPath)
+					}
+				}
+			}
+		}
+	}
+
+	for _, imp := range file.Imports {
+		if importPath, err := strconv.Unquote(imp.Path.Value); err == nil {
+			addToSet(idx.imports, importPath, relPath)
+		}
+	}
+
+	ast.Inspect(file, func(n ast.Node) bool {
+		switch node := n.(type) {
+		case *ast.SelectorExpr:
+			if x, ok := node.X.(*ast.Ident); ok {
+				addToSet(idx.references, x.Name+"."+node.Sel.Name, relPath)
+			}
+		case *ast.Ident:
+			if !declared[node] && node != file.Name {
+				addToSet(idx.references, node.Name, relPath)
+			}
+		}
+		return true
+	})
+}
+
+func receiverTypeName(expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.StarExpr:
+		return receiverTypeName(t.X)
+	case *ast.IndexExpr: // Generic receiver
+		return receiverTypeName(t.X)
+	case *ast.IndexListExpr:
+		return receiverTypeName(t.X)
+	case *ast.Ident:
+		return t.Name
+	}
+	return ""
+}
+
+// addTextFile is the fallback for languages without a parser here: every
+// identifier token outside comments counts as a reference.
+func (idx *symbolIndex) addTextFile(absPath, relPath string) {
+	data, err := os.ReadFile(absPath)
+	if err != nil {
+		return
+	}
+	src := string(data)
+	if syntax, ok := commentSyntaxFor(relPath); ok {
+		src = stripComments(src, syntax)
+	}
+	for _, name := range identifierRegex.FindAllString(src, -1) {
+		addToSet(idx.references, name, relPath)
+	}
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// FindSymbolReferences returns the files declaring and the files using an
+// identifier. Qualified Go names ("pkg.Func", "Type.Method") are supported.
+func (a *App) FindSymbolReferences(rootDir string, identifier string) (*SymbolReferences, error) {
+	if a.symbolIndexer == nil {
+		return nil, fmt.Errorf("symbol indexer not initialized")
+	}
+	identifier = strings.TrimSpace(identifier)
+	if identifier == "" {
+		return nil, fmt.Errorf("identifier is empty")
+	}
+	idx, err := a.symbolIndexer.indexFor(rootDir)
+	if err != nil {
+		return nil, err
+	}
+
+	return idx.find(identifier), nil
+}
+
+// find looks up the files declaring and using an identifier.
+func (idx *symbolIndex) find(identifier string) *SymbolReferences {
+	refs := &SymbolReferences{
+		Identifier:   identifier,
+		DefinedIn:    sortedKeys(idx.definitions[identifier]),
+		ReferencedIn: sortedKeys(idx.references[identifier]),
+	}
+	// A method is referenced through its selector, whatever the receiver
+	// variable is called. Only files that also mention the type count, so
+	// "Server.Close" does not match every Close call in the project.
+	if dot := strings.LastIndex(identifier, "."); dot > 0 && len(refs.ReferencedIn) == 0 && len(refs.DefinedIn) > 0 {
+		typeName, method := identifier[:dot], identifier[dot+1:]
+		files := make(map[string]bool)
+		for f := range idx.references[method] {
+			if idx.references[typeName][f] || idx.definitions[typeName][f] {
+				files[f] = true
+			}
+		}
+		refs.ReferencedIn = sortedKeys(files)
+	}
+	return refs
+}
+
+// FindPackageImporters returns the files importing a package, given either a
+// full import path or, for packages of the project's own module, a directory
+// relative to rootDir.
+func (a *App) FindPackageImporters(rootDir string, pkg string) ([]string, error) {
+	if a.symbolIndexer == nil {
+		return nil, fmt.Errorf("symbol indexer not initialized")
+	}
+	idx, err := a.symbolIndexer.indexFor(rootDir)
+	if err != nil {
+		return nil, err
+	}
+
+	pkg = strings.TrimSuffix(filepath.ToSlash(strings.TrimSpace(pkg)), "/")
+	files := make(map[string]bool)
+	for f := range idx.imports[pkg] {
+		files[f] = true
+	}
+	if idx.goModulePath != "" {
+		for f := range idx.imports[path.Join(idx.goModulePath, pkg)] {
+			files[f] = true
+		}
+	}
+	return sortedKeys(files), nil
+}
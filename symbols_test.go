@@ -0,0 +1,72 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSymbolIndex(t *testing.T) {
+	root := t.TempDir()
+	writeTestFiles(t, root, map[string]string{
+		"go.mod":     "module example.com/app\n",
+		".gitignore": "gen/\n",
+		"server.go": `package app
+
+// Server serves.
+type Server struct{}
+
+const Version = "1"
+
+func NewServer() *Server { return &Server{} }
+
+func (s *Server) Start() error { return nil }
+`,
+		"main.go": `package app
+
+func run() {
+	var srv *Server = NewServer()
+	srv.Start()
+}
+`,
+		"worker.go": `package app
+
+type Worker struct{}
+
+func (w Worker) Start() error { return nil }
+
+func runWorker() {
+	w := Worker{}
+	w.Start()
+}
+`,
+		"gen/gen.go": "package gen\n\nvar v = Version\n",
+		"web/app.js": "import { Server } from './server' // NewServer\n",
+	})
+
+	tests := []struct {
+		identifier   string
+		useGitignore bool
+		definedIn    []string
+		referencedIn []string
+	}{
+		{identifier: "Server", useGitignore: true, definedIn: []string{"server.go"}, referencedIn: []string{"main.go", "server.go", "web/app.js"}},
+		{identifier: "NewServer", useGitignore: true, definedIn: []string{"server.go"}, referencedIn: []string{"main.go"}},
+		{identifier: "Start", useGitignore: true, definedIn: []string{"server.go", "worker.go"}, referencedIn: []string{"main.go", "worker.go"}},
+		{identifier: "Server.Start", useGitignore: true, definedIn: []string{"server.go"}, referencedIn: []string{"main.go"}},
+		{identifier: "Worker.Start", useGitignore: true, definedIn: []string{"worker.go"}, referencedIn: []string{"worker.go"}},
+		{identifier: "Version", useGitignore: true, definedIn: []string{"server.go"}, referencedIn: []string{}},
+		{identifier: "Version", useGitignore: false, definedIn: []string{"server.go"}, referencedIn: []string{"gen/gen.go"}},
+		{identifier: "Missing", useGitignore: true, definedIn: []string{}, referencedIn: []string{}},
+	}
+	for _, tt := range tests {
+		idx, err := buildSymbolIndex(root, tt.useGitignore, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		refs := idx.find(tt.identifier)
+		if !reflect.DeepEqual(refs.DefinedIn, tt.definedIn) || !reflect.DeepEqual(refs.ReferencedIn, tt.referencedIn) {
+			t.Errorf("%s (gitignore %v): defined in %v, referenced in %v; want %v and %v",
+				tt.identifier, tt.useGitignore, refs.DefinedIn, refs.ReferencedIn, tt.definedIn, tt.referencedIn)
+		}
+	}
+}
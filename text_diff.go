@@ -0,0 +1,256 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"shotgun_code/internal/unidiff"
+)
+
+// --- Line diff and unified diff rendering ---
+
+// diffOp is one line of an edit script: ' ' keeps, '-' deletes, '+' inserts.
+type diffOp struct {
+	kind byte
+	line string
+}
+
+// splitLinesForDiff splits text into lines without their terminators and
+// reports whether the last line was terminated by a newline.
+func splitLinesForDiff(text string) (lines []string, endsWithNewline bool) {
+	if text == "" {
+		return nil, true
+	}
+	endsWithNewline = strings.HasSuffix(text, "\n")
+	lines = strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	return lines, endsWithNewline
+}
+
+// diffLines computes a minimal edit script between a and b using Myers'
+// linear-space divide and conquer algorithm.
+func diffLines(a, b []string) []diffOp {
+	ops := make([]diffOp, 0, len(a)+len(b))
+
+	var diffRange func(a0, a1, b0, b1 int)
+	diffRange = func(a0, a1, b0, b1 int) {
+		for a0 < a1 && b0 < b1 && a[a0] == b[b0] {
+			ops = append(ops, diffOp{' ', a[a0]})
+			a0++
+			b0++
+		}
+		suffix := 0
+		for a1-suffix > a0 && b1-suffix > b0 && a[a1-suffix-1] == b[b1-suffix-1] {
+			suffix++
+		}
+		a1, b1 = a1-suffix, b1-suffix
+
+		switch {
+		case a0 == a1:
+			for _, line := range b[b0:b1] {
+				ops = append(ops, diffOp{'+', line})
+			}
+		case b0 == b1:
+			for _, line := range a[a0:a1] {
+				ops = append(ops, diffOp{'-', line})
+			}
+		default:
+			x, y, u, v := middleSnake(a, b, a0, a1, b0, b1)
+			diffRange(a0, x, b0, y)
+			for _, line := range a[x:u] {
+				ops = append(ops, diffOp{' ', line})
+			}
+			diffRange(u, a1, v, b1)
+		}
+
+		for _, line := range a[a1 : a1+suffix] {
+			ops = append(ops, diffOp{' ', line})
+		}
+	}
+	diffRange(0, len(a), 0, len(b))
+	return ops
+}
+
+// middleSnake finds the middle snake (x,y)->(u,v) of an optimal edit path
+// between a[a0:a1] and b[b0:b1], searching forward and backward at once.
+func middleSnake(a, b []string, a0, a1, b0, b1 int) (x, y, u, v int) {
+	n, m := a1-a0, b1-b0
+	delta := n - m
+	odd := delta%2 != 0
+	maxD := (n + m + 1) / 2
+	offset := maxD + 1
+	forward := make([]int, 2*maxD+3)  // Furthest x on diagonal k = x-y, from the start
+	backward := make([]int, 2*maxD+3) // Furthest x on diagonal k, measured from the end
+
+	for d := 0; d <= maxD; d++ {
+		for k := -d; k <= d; k += 2 {
+			var px int
+			if k == -d || (k != d && forward[offset+k-1] < forward[offset+k+1]) {
+				px = forward[offset+k+1]
+			} else {
+				px = forward[offset+k-1] + 1
+			}
+			py := px - k
+			sx, sy := px, py
+			for px < n && py < m && a[a0+px] == b[b0+py] {
+				px++
+				py++
+			}
+			forward[offset+k] = px
+			if odd && k >= delta-(d-1) && k <= delta+(d-1) && px+backward[offset+delta-k] >= n {
+				return a0 + sx, b0 + sy, a0 + px, b0 + py
+			}
+		}
+		for k := -d; k <= d; k += 2 {
+			var px int
+			if k == -d || (k != d && backward[offset+k-1] < backward[offset+k+1]) {
+				px = backward[offset+k+1]
+			} else {
+				px = backward[offset+k-1] + 1
+			}
+			py := px - k
+			sx, sy := px, py
+			for px < n && py < m && a[a1-1-px] == b[b1-1-py] {
+				px++
+				py++
+			}
+			backward[offset+k] = px
+			if !odd && k >= delta-d && k <= delta+d && px+forward[offset+delta-k] >= n {
+				return a1 - px, b1 - py, a1 - sx, b1 - sy
+			}
+		}
+	}
+	// Unreachable for valid input: the searches always meet by maxD.
+	return a0, b0, a0, b0
+}
+
+// lastDiffLines returns the index of the op holding the last line of the old
+// and of the new text, which is where "\ No newline at end of file" goes.
+func lastDiffLines(ops []diffOp) (lastOld, lastNew int) {
+	lastOld, lastNew = -1, -1
+	for i, op := range ops {
+		if op.kind != '+' {
+			lastOld = i
+		}
+		if op.kind != '-' {
+			lastNew = i
+		}
+	}
+	return lastOld, lastNew
+}
+
+// unifiedDiff renders a git-style unified diff of one file. An empty oldPath
+// marks a new file and an empty newPath a deleted one. It returns "" when the
+// texts are identical.
+func unifiedDiff(oldPath, newPath, oldText, newText string, contextLines int) string {
+	if oldText == newText && oldPath != "" && newPath != "" {
+		return ""
+	}
+	oldLines, oldEOL := splitLinesForDiff(oldText)
+	newLines, newEOL := splitLinesForDiff(newText)
+	ops := diffLines(oldLines, newLines)
+
+	// A kept final line that has a newline on one side only is really a change.
+	lastOld, lastNew := lastDiffLines(ops)
+	split := -1
+	switch {
+	case lastOld >= 0 && ops[lastOld].kind == ' ' && !oldEOL && !(lastOld == lastNew && !newEOL):
+		split = lastOld
+	case lastNew >= 0 && ops[lastNew].kind == ' ' && !newEOL && !(lastNew == lastOld && !oldEOL):
+		split = lastNew
+	}
+	if split >= 0 {
+		line := ops[split].line
+		ops = append(ops[:split], append([]diffOp{{'-', line}, {'+', line}}, ops[split+1:]...)...)
+		lastOld, lastNew = lastDiffLines(ops)
+	}
+
+	var b strings.Builder
+	headerOld, headerNew := oldPath, newPath
+	if headerOld == "" {
+		headerOld = newPath
+	}
+	if headerNew == "" {
+		headerNew = oldPath
+	}
+	fmt.Fprintf(&b, "diff --git a/%s b/%s\n", headerOld, headerNew)
+	switch {
+	case oldPath == "":
+		b.WriteString("new file mode 100644\n--- /dev/null\n")
+		fmt.Fprintf(&b, "+++ b/%s\n", newPath)
+	case newPath == "":
+		b.WriteString("deleted file mode 100644\n")
+		fmt.Fprintf(&b, "--- a/%s\n+++ /dev/null\n", oldPath)
+	default:
+		if oldPath != newPath {
+			fmt.Fprintf(&b, "rename from %s\nrename to %s\n", oldPath, newPath)
+		}
+		fmt.Fprintf(&b, "--- a/%s\n+++ b/%s\n", oldPath, newPath)
+	}
+
+	hasChanges := false
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			i++
+			continue
+		}
+		hasChanges = true
+		// Grow the hunk while changes are separated by at most 2*contextLines kept lines.
+		start := max(0, i-contextLines)
+		end := i
+		for end < len(ops) {
+			if ops[end].kind != ' ' {
+				end++
+				continue
+			}
+			run := end
+			for run < len(ops) && ops[run].kind == ' ' {
+				run++
+			}
+			if run == len(ops) || run-end > 2*contextLines {
+				end = min(len(ops), end+contextLines)
+				break
+			}
+			end = run
+		}
+
+		oldStart, newStart := 1, 1
+		for _, op := range ops[:start] {
+			if op.kind != '+' {
+				oldStart++
+			}
+			if op.kind != '-' {
+				newStart++
+			}
+		}
+		oldCount, newCount := 0, 0
+		for _, op := range ops[start:end] {
+			if op.kind != '+' {
+				oldCount++
+			}
+			if op.kind != '-' {
+				newCount++
+			}
+		}
+		if oldCount == 0 {
+			oldStart--
+		}
+		if newCount == 0 {
+			newStart--
+		}
+		fmt.Fprintf(&b, "@@ -%s +%s @@\n", unidiff.FormatRange(oldStart, oldCount), unidiff.FormatRange(newStart, newCount))
+		for j := start; j < end; j++ {
+			op := ops[j]
+			b.WriteByte(op.kind)
+			b.WriteString(op.line)
+			b.WriteByte('\n')
+			if (j == lastOld && !oldEOL && op.kind != '+') || (j == lastNew && !newEOL && op.kind != '-') {
+				b.WriteString("\\ No newline at end of file\n")
+			}
+		}
+		i = end
+	}
+	if !hasChanges && oldPath == newPath {
+		return ""
+	}
+	return b.String()
+}
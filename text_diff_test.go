@@ -0,0 +1,197 @@
+package main
+
+import (
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"shotgun_code/internal/unidiff"
+)
+
+// editScript renders ops compactly, one op per line as kind followed by text.
+func editScript(ops []diffOp) string {
+	var b strings.Builder
+	for _, op := range ops {
+		b.WriteByte(op.kind)
+		b.WriteString(op.line)
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// lcsLength is the length of a longest common subsequence of a and b.
+func lcsLength(a, b []string) int {
+	prev, cur := make([]int, len(b)+1), make([]int, len(b)+1)
+	for i := range a {
+		for j := range b {
+			if a[i] == b[j] {
+				cur[j+1] = prev[j] + 1
+			} else {
+				cur[j+1] = max(prev[j+1], cur[j])
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+// checkEditScript fails unless ops turn a into b with as few edits as possible.
+func checkEditScript(t *testing.T, a, b []string, ops []diffOp) {
+	t.Helper()
+	var old, new []string
+	edits := 0
+	for _, op := range ops {
+		switch op.kind {
+		case ' ':
+			old, new = append(old, op.line), append(new, op.line)
+		case '-':
+			old, edits = append(old, op.line), edits+1
+		case '+':
+			new, edits = append(new, op.line), edits+1
+		default:
+			t.Fatalf("unknown op kind %q", op.kind)
+		}
+	}
+	if strings.Join(old, "\n") != strings.Join(a, "\n") || strings.Join(new, "\n") != strings.Join(b, "\n") {
+		t.Fatalf("script does not turn %q into %q:\n%s", a, b, editScript(ops))
+	}
+	if want := len(a) + len(b) - 2*lcsLength(a, b); edits != want {
+		t.Errorf("script for %q -> %q has %d edits, minimum is %d:\n%s", a, b, edits, want, editScript(ops))
+	}
+}
+
+func TestDiffLinesKnownScripts(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string // Lines separated by spaces
+		want string // Expected script, see editScript
+	}{
+		{"identical", "a b c", "a b c", " a\n b\n c\n"},
+		{"both empty", "", "", ""},
+		{"insert into empty", "", "a b", "+a\n+b\n"},
+		{"delete everything", "a b", "", "-a\n-b\n"},
+		{"insert in the middle", "a c", "a b c", " a\n+b\n c\n"},
+		{"delete in the middle", "a b c", "a c", " a\n-b\n c\n"},
+		{"replace one line", "a b c", "a x c", " a\n-b\n+x\n c\n"},
+		{"append", "a b", "a b c d", " a\n b\n+c\n+d\n"},
+		{"prepend", "c d", "a b c d", "+a\n+b\n c\n d\n"},
+		{"disjoint", "a b", "x y", "-a\n-b\n+x\n+y\n"},
+		{"move a line down", "a b c d", "b c d a", "-a\n b\n c\n d\n+a\n"},
+	}
+	fields := func(s string) []string { return strings.Fields(s) }
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := fields(tt.a), fields(tt.b)
+			ops := diffLines(a, b)
+			if got := editScript(ops); got != tt.want {
+				t.Errorf("script:\n%s\nwant:\n%s", got, tt.want)
+			}
+			checkEditScript(t, a, b, ops)
+		})
+	}
+}
+
+func TestDiffLinesMinimal(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	alphabet := []string{"a", "b", "c", "d", "}", ""}
+	randomLines := func(n int) []string {
+		lines := make([]string, n)
+		for i := range lines {
+			lines[i] = alphabet[r.Intn(len(alphabet))]
+		}
+		return lines
+	}
+	for trial := 0; trial < 500; trial++ {
+		a, b := randomLines(r.Intn(40)), randomLines(r.Intn(40))
+		checkEditScript(t, a, b, diffLines(a, b))
+	}
+}
+
+func TestUnifiedDiffApplies(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	words := []string{"func f() {", "\treturn", "}", "", "x := 1", "y := 2"}
+	randomText := func() string {
+		var b strings.Builder
+		for i, n := 0, r.Intn(30); i < n; i++ {
+			b.WriteString(words[r.Intn(len(words))])
+			b.WriteByte('\n')
+		}
+		s := b.String()
+		if s != "" && r.Intn(4) == 0 {
+			s = strings.TrimSuffix(s, "\n")
+		}
+		return s
+	}
+	for trial := 0; trial < 300; trial++ {
+		oldText, newText := randomText(), randomText()
+		diff := unifiedDiff("f.go", "f.go", oldText, newText, r.Intn(4))
+		if diff == "" {
+			if oldText != newText {
+				t.Fatalf("empty diff for %q -> %q", oldText, newText)
+			}
+			continue
+		}
+		patch, err := unidiff.Parse(diff)
+		if err != nil {
+			t.Fatalf("diff of %q -> %q does not parse: %v\n%s", oldText, newText, err, diff)
+		}
+		got, _, err := applyHunks(oldText, patch.Files[0].Hunks, ApplyDiffOptions{})
+		if err != nil || got != newText {
+			t.Fatalf("applying the diff of %q gives %q (%v), want %q\n%s", oldText, got, err, newText, diff)
+		}
+	}
+}
+
+func TestFileResponseDiff(t *testing.T) {
+	root := t.TempDir()
+	writeTestFiles(t, root, map[string]string{
+		"a.txt":    "one\ntwo\n",
+		"crlf.txt": "one\r\ntwo\r\n",
+		"same.txt": "same\n",
+	})
+	response := "Updated files:\n" +
+		"<file path=\"a.txt\">\none\nTWO\n</file>\n" +
+		"<file path=\"crlf.txt\">\none\nTWO\n</file>\n" +
+		"<file path=\"same.txt\">\nsame\n</file>\n" +
+		"<file path=\"dir/new.txt\">\nnew\n</file>\n" +
+		"<file path=\"empty.txt\">\n</file>\n"
+	converted, err := fileResponseDiff(root, response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ResponseFile{
+		{Path: "a.txt", Action: "modify", Added: 1, Removed: 1},
+		{Path: "crlf.txt", Action: "modify", Added: 1, Removed: 1},
+		{Path: "same.txt", Action: "unchanged"},
+		{Path: "dir/new.txt", Action: "create", Added: 1},
+		{Path: "empty.txt", Action: "create"},
+	}
+	if len(converted.Files) != len(want) {
+		t.Fatalf("files = %+v, want %+v", converted.Files, want)
+	}
+	for i, f := range converted.Files {
+		if f != want[i] {
+			t.Errorf("file %d = %+v, want %+v", i, f, want[i])
+		}
+	}
+
+	patch, err := unidiff.Parse(converted.Diff)
+	if err != nil {
+		t.Fatalf("diff does not parse: %v\n%s", err, converted.Diff)
+	}
+	if result := applyPatch(root, patch, ApplyDiffOptions{}); !result.Applied {
+		t.Fatalf("diff does not apply: %+v", result)
+	}
+	for name, content := range map[string]string{"a.txt": "one\nTWO\n", "crlf.txt": "one\r\nTWO\r\n", "dir/new.txt": "new\n", "empty.txt": ""} {
+		data, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(name)))
+		if err != nil || string(data) != content {
+			t.Errorf("%s = %q (%v), want %q", name, data, err, content)
+		}
+	}
+
+	if _, err := fileResponseDiff(root, "<file path=\"../escape.txt\">\nx\n</file>\n"); err == nil {
+		t.Error("a path outside the project was accepted")
+	}
+}
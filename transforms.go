@@ -0,0 +1,381 @@
+package main
+
+import (
+	"path"
+	"regexp"
+	"strings"
+)
+
+// --- Content transforms (context minification) ---
+
+// Transform names accepted in ContextGenerationOptions.Transforms.
+const (
+	TransformNormalizeLineEndings   = "normalizeLineEndings"
+	TransformRemoveLicenseHeader    = "removeLicenseHeader"
+	TransformStripComments          = "stripComments"
+	TransformTrimTrailingWhitespace = "trimTrailingWhitespace"
+	TransformCollapseBlankLines     = "collapseBlankLines"
+)
+
+// transformOrder is the order in which enabled transforms run, independent of
+// the order they were requested in. Line endings are normalized first so the
+// remaining transforms only ever see "\n".
+var transformOrder = []string{
+	TransformNormalizeLineEndings,
+	TransformRemoveLicenseHeader,
+	TransformStripComments,
+	TransformTrimTrailingWhitespace,
+	TransformCollapseBlankLines,
+}
+
+// FileTransformStats reports how much a file shrank after the transform pipeline.
+type FileTransformStats struct {
+	Path        string `json:"path"`
+	BytesBefore int    `json:"bytesBefore"`
+	BytesAfter  int    `json:"bytesAfter"`
+	BytesSaved  int    `json:"bytesSaved"`
+	TokensSaved int    `json:"tokensSaved"`
+}
+
+// estimateTokens approximates the LLM token count of text (~4 bytes per token).
+func estimateTokens(text string) int {
+	return (len(text) + 3) / 4
+}
+
+// commentSyntax describes how comments and string literals look in a language.
+type commentSyntax struct {
+	line       []string // Line comment prefixes
+	directives []string // Line comment prefixes that carry meaning and are never stripped
+	blockStart string
+	blockEnd   string
+	quotes     string // Characters that delimit string literals
+	triple     bool   // Python-style triple-quoted strings
+	urls       bool   // CSS url(...) tokens, whose unquoted URLs may contain "//"
+	cgo        bool   // Go: the comment directly above import "C" is the cgo preamble and is code
+}
+
+var (
+	cStyleComments       = commentSyntax{line: []string{"//"}, blockStart: "/*", blockEnd: "*/", quotes: "\"'`"}
+	goComments           = commentSyntax{line: []string{"//"}, directives: []string{"//go:", "// +build", "//line ", "//export "}, blockStart: "/*", blockEnd: "*/", quotes: "\"'`", cgo: true}
+	rustComments         = commentSyntax{line: []string{"//"}, blockStart: "/*", blockEnd: "*/", quotes: "\""} // ' starts lifetimes too often
+	cssComments          = commentSyntax{blockStart: "/*", blockEnd: "*/", quotes: "\"'", urls: true}
+	scssComments         = commentSyntax{line: []string{"//"}, blockStart: "/*", blockEnd: "*/", quotes: "\"'", urls: true}
+	phpComments          = commentSyntax{line: []string{"//", "#"}, blockStart: "/*", blockEnd: "*/", quotes: "\"'`"}
+	hashComments         = commentSyntax{line: []string{"#"}, quotes: "\"'"}
+	pythonComments       = commentSyntax{line: []string{"#"}, quotes: "\"'", triple: true}
+	sqlComments          = commentSyntax{line: []string{"--"}, blockStart: "/*", blockEnd: "*/", quotes: "'\""}
+	luaComments          = commentSyntax{line: []string{"--"}, quotes: "\"'"}
+	markupComments       = commentSyntax{blockStart: "<!--", blockEnd: "-->"}
+	hashCommentFileNames = map[string]bool{"makefile": true, "dockerfile": true, ".gitignore": true, ".dockerignore": true, ".env": true}
+)
+
+// commentSyntaxFor picks the comment syntax from the file extension or name.
+func commentSyntaxFor(relPath string) (commentSyntax, bool) {
+	switch strings.ToLower(path.Ext(relPath)) {
+	case ".go":
+		return goComments, true
+	case ".js", ".jsx", ".mjs", ".cjs", ".ts", ".tsx", ".mts", ".cts", ".java", ".kt", ".kts",
+		".scala", ".cs", ".swift", ".dart", ".c", ".h", ".cc", ".cpp", ".cxx", ".hpp", ".hh", ".m", ".proto":
+		return cStyleComments, true
+	case ".rs":
+		return rustComments, true
+	case ".css":
+		return cssComments, true
+	case ".scss", ".less":
+		return scssComments, true
+	case ".php":
+		return phpComments, true
+	case ".py", ".pyi":
+		return pythonComments, true
+	case ".sh", ".bash", ".zsh", ".rb", ".pl", ".r", ".yaml", ".yml", ".toml", ".ini", ".cfg", ".conf", ".tf", ".glob":
+		return hashComments, true
+	case ".sql":
+		return sqlComments, true
+	case ".lua":
+		return luaComments, true
+	case ".html", ".htm", ".xml", ".svg", ".vue", ".md":
+		return markupComments, true
+	}
+	if hashCommentFileNames[strings.ToLower(path.Base(relPath))] {
+		return hashComments, true
+	}
+	return commentSyntax{}, false
+}
+
+// applyTransforms runs the enabled transforms over a file body and reports the savings.
+func applyTransforms(relPath, content string, transforms []string) (string, FileTransformStats) {
+	enabled := make(map[string]bool, len(transforms))
+	for _, t := range transforms {
+		enabled[t] = true
+	}
+
+	result := content
+	syntax, known := commentSyntaxFor(relPath)
+	for _, name := range transformOrder {
+		if !enabled[name] {
+			continue
+		}
+		switch name {
+		case TransformNormalizeLineEndings:
+			result = strings.ReplaceAll(result, "\r\n", "\n")
+		case TransformRemoveLicenseHeader:
+			if known {
+				result = removeLicenseHeader(result, syntax)
+			}
+		case TransformStripComments:
+			if known {
+				result = stripComments(result, syntax)
+			}
+		case TransformTrimTrailingWhitespace:
+			lines := strings.Split(result, "\n")
+			for i, line := range lines {
+				lines[i] = strings.TrimRight(line, " \t\r")
+			}
+			result = strings.Join(lines, "\n")
+		case TransformCollapseBlankLines:
+			result = collapseBlankLines(result)
+		}
+	}
+
+	stats := FileTransformStats{
+		Path:        relPath,
+		BytesBefore: len(content),
+		BytesAfter:  len(result),
+		BytesSaved:  len(content) - len(result),
+		TokensSaved: estimateTokens(content) - estimateTokens(result),
+	}
+	return result, stats
+}
+
+// collapseBlankLines reduces runs of blank lines to a single blank line and
+// drops blank lines at the start and end of the file.
+func collapseBlankLines(src string) string {
+	lines := strings.Split(src, "\n")
+	out := make([]string, 0, len(lines))
+	blank := false
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			blank = true
+			continue
+		}
+		if blank && len(out) > 0 {
+			out = append(out, "")
+		}
+		blank = false
+		out = append(out, line)
+	}
+	return strings.Join(out, "\n")
+}
+
+// stripComments removes comments while leaving string literals untouched and
+// keeping directive comments such as //go:embed. Lines that only contained a
+// comment are removed entirely.
+func stripComments(src string, syntax commentSyntax) string {
+	var b strings.Builder
+	b.Grow(len(src))
+
+	for i := 0; i < len(src); {
+		// Keep shebang lines, they are not comments semantically.
+		if i == 0 && strings.HasPrefix(src, "#!") {
+			end := strings.IndexByte(src, '\n')
+			if end < 0 {
+				return src
+			}
+			b.WriteString(src[:end])
+			i = end
+			continue
+		}
+
+		c := src[i]
+		if syntax.triple && (strings.HasPrefix(src[i:], `"""`) || strings.HasPrefix(src[i:], `'''`)) {
+			delim := src[i : i+3]
+			end := strings.Index(src[i+3:], delim)
+			if end < 0 {
+				b.WriteString(src[i:])
+				break
+			}
+			b.WriteString(src[i : i+3+end+3])
+			i += 3 + end + 3
+			continue
+		}
+		if strings.IndexByte(syntax.quotes, c) >= 0 {
+			j := i + 1
+			for j < len(src) && src[j] != c {
+				if src[j] == '\\' && c != '`' {
+					j++
+				} else if src[j] == '\n' && c != '`' {
+					break // Unterminated literal; don't swallow the rest of the file
+				}
+				j++
+			}
+			if j < len(src) && src[j] == c {
+				j++
+			}
+			b.WriteString(src[i:min(j, len(src))])
+			i = j
+			continue
+		}
+		if syntax.urls && isCSSURLStart(src, i) {
+			end := strings.IndexAny(src[i:], ")\n") // An unterminated url( ends with its line
+			switch {
+			case end < 0:
+				end = len(src) - i
+			case src[i+end] == ')':
+				end++
+			}
+			b.WriteString(src[i : i+end])
+			i += end
+			continue
+		}
+		if syntax.cgo {
+			if end := cgoPreambleEnd(src, i, syntax); end > i {
+				b.WriteString(src[i:end])
+				i = end
+				continue
+			}
+		}
+		if syntax.blockStart != "" && strings.HasPrefix(src[i:], syntax.blockStart) {
+			end := strings.Index(src[i+len(syntax.blockStart):], syntax.blockEnd)
+			stop := len(src)
+			if end >= 0 {
+				stop = i + len(syntax.blockStart) + end + len(syntax.blockEnd)
+			}
+			// Preserve line structure so comment-only lines can be detected below.
+			b.WriteString(strings.Repeat("\n", strings.Count(src[i:stop], "\n")))
+			i = stop
+			continue
+		}
+		if matchLineComment(src[i:], syntax.line) != "" {
+			end := strings.IndexByte(src[i:], '\n')
+			if end < 0 {
+				end = len(src) - i
+			}
+			if matchLineComment(src[i:], syntax.directives) != "" {
+				b.WriteString(src[i : i+end])
+			}
+			i += end
+			continue
+		}
+		b.WriteByte(c)
+		i++
+	}
+
+	stripped := strings.Split(b.String(), "\n")
+	original := strings.Split(src, "\n")
+	if len(stripped) != len(original) {
+		return b.String()
+	}
+	out := make([]string, 0, len(stripped))
+	for i, line := range stripped {
+		if strings.TrimSpace(line) == "" && strings.TrimSpace(original[i]) != "" {
+			continue
+		}
+		out = append(out, line)
+	}
+	return strings.Join(out, "\n")
+}
+
+// isCSSURLStart reports whether a url( token starts at src[i].
+func isCSSURLStart(src string, i int) bool {
+	if len(src)-i < 4 || !strings.EqualFold(src[i:i+4], "url(") {
+		return false
+	}
+	return i == 0 || !(isIdentByte(src[i-1]) || src[i-1] == '-')
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+// cgoPreambleEnd returns the end of the comment starting at src[i] if it is a
+// cgo preamble: a block comment or run of line comments that starts its line
+// and is followed directly by import "C". It returns -1 otherwise.
+func cgoPreambleEnd(src string, i int, syntax commentSyntax) int {
+	if strings.TrimLeft(src[strings.LastIndexByte(src[:i], '\n')+1:i], " \t") != "" {
+		return -1
+	}
+	end := -1
+	switch {
+	case strings.HasPrefix(src[i:], syntax.blockStart):
+		stop := strings.Index(src[i+len(syntax.blockStart):], syntax.blockEnd)
+		if stop < 0 {
+			return -1
+		}
+		end = i + len(syntax.blockStart) + stop + len(syntax.blockEnd)
+	case matchLineComment(src[i:], syntax.line) != "":
+		for end = i; ; {
+			nl := strings.IndexByte(src[end:], '\n')
+			if nl < 0 {
+				return -1
+			}
+			end += nl
+			if matchLineComment(strings.TrimLeft(src[end+1:], " \t"), syntax.line) == "" {
+				break
+			}
+			end++
+		}
+	default:
+		return -1
+	}
+	rest := strings.TrimLeft(src[end:], " \t")
+	if !strings.HasPrefix(rest, "\n") {
+		return -1
+	}
+	line, _, _ := strings.Cut(rest[1:], "\n")
+	if strings.TrimSpace(line) != `import "C"` {
+		return -1
+	}
+	return end
+}
+
+func matchLineComment(s string, prefixes []string) string {
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p) {
+			return p
+		}
+	}
+	return ""
+}
+
+var licenseKeywordRegex = regexp.MustCompile(`(?i)\b(license|licensed|copyright|spdx-license-identifier|\(c\))`)
+
+// removeLicenseHeader drops the leading comment block of a file when it looks
+// like a license or copyright notice. Anything after the header is kept as is.
+func removeLicenseHeader(src string, syntax commentSyntax) string {
+	start := 0
+	if strings.HasPrefix(src, "#!") {
+		if nl := strings.IndexByte(src, '\n'); nl >= 0 {
+			start = nl + 1
+		} else {
+			return src
+		}
+	}
+	rest := src[start:]
+	trimmed := strings.TrimLeft(rest, " \t\n")
+	offset := start + len(rest) - len(trimmed)
+
+	var header string
+	switch {
+	case syntax.blockStart != "" && strings.HasPrefix(trimmed, syntax.blockStart):
+		end := strings.Index(trimmed[len(syntax.blockStart):], syntax.blockEnd)
+		if end < 0 {
+			return src
+		}
+		header = trimmed[:len(syntax.blockStart)+end+len(syntax.blockEnd)]
+	case len(syntax.line) > 0:
+		lines := strings.SplitAfter(trimmed, "\n")
+		n := 0
+		for _, line := range lines {
+			if matchLineComment(strings.TrimSpace(line), syntax.line) == "" || matchLineComment(line, syntax.directives) != "" {
+				break
+			}
+			n += len(line)
+		}
+		header = trimmed[:n]
+	}
+
+	if header == "" || !licenseKeywordRegex.MatchString(header) {
+		return src
+	}
+	return src[:start] + strings.TrimLeft(src[offset+len(header):], "\n")
+}
@@ -0,0 +1,89 @@
+package main
+
+import "testing"
+
+func TestApplyTransforms(t *testing.T) {
+	all := []string{TransformCollapseBlankLines, TransformTrimTrailingWhitespace, TransformStripComments, TransformRemoveLicenseHeader, TransformNormalizeLineEndings}
+	tests := []struct {
+		name       string
+		path       string
+		content    string
+		transforms []string
+		want       string
+	}{
+		{
+			name:       "go comments",
+			path:       "main.go",
+			content:    "// Copyright 2024 Example. MIT License.\n\n//go:build linux\n// +build linux\n\n// Package main does things.\npackage main\n\nimport _ \"embed\"\n\n//go:embed ignore.glob\nvar rules string // The rules\n\n/* block\n   comment */\nvar url = \"http://example.com\" // not a comment inside the string\n",
+			transforms: all,
+			want:       "//go:build linux\n// +build linux\n\npackage main\n\nimport _ \"embed\"\n\n//go:embed ignore.glob\nvar rules string\n\nvar url = \"http://example.com\"",
+		},
+		{
+			name:       "directive on the last line",
+			path:       "gen.go",
+			content:    "package gen\n//go:generate stringer -type=Kind",
+			transforms: []string{TransformStripComments},
+			want:       "package gen\n//go:generate stringer -type=Kind",
+		},
+		{
+			name:       "license header before a directive",
+			path:       "a.go",
+			content:    "// Copyright 2024 Example\n//go:build linux\n\npackage a\n",
+			transforms: []string{TransformRemoveLicenseHeader},
+			want:       "//go:build linux\n\npackage a\n",
+		},
+		{
+			name:       "cgo preambles",
+			path:       "cgo.go",
+			content:    "package main\n\n// #cgo LDFLAGS: -lm\n// #include <math.h>\nimport \"C\"\n\n/*\n#include <stdlib.h>\n*/\nimport \"C\"\n\n// Not a preamble: a blank line follows.\n\nimport \"C\"\n\n// Sqrt returns the square root.\nfunc Sqrt(x float64) float64 { return float64(C.sqrt(C.double(x))) } // cgo call\n",
+			transforms: []string{TransformStripComments},
+			want:       "package main\n\n// #cgo LDFLAGS: -lm\n// #include <math.h>\nimport \"C\"\n\n/*\n#include <stdlib.h>\n*/\nimport \"C\"\n\n\nimport \"C\"\n\nfunc Sqrt(x float64) float64 { return float64(C.sqrt(C.double(x))) } \n",
+		},
+		{
+			name:       "css urls",
+			path:       "theme.scss",
+			content:    "// Theme\n.a { background: url(//cdn.example.com/bg.png); } // cdn\n.b { background: URL(http://example.com/b.png) }\n.c { background: url(\"//quoted/c.png\") } /* quoted */\n.curl(1); // mixin, not a url\n",
+			transforms: []string{TransformStripComments, TransformTrimTrailingWhitespace},
+			want:       ".a { background: url(//cdn.example.com/bg.png); }\n.b { background: URL(http://example.com/b.png) }\n.c { background: url(\"//quoted/c.png\") }\n.curl(1);\n",
+		},
+		{
+			name:       "shebang and python strings",
+			path:       "run.py",
+			content:    "#!/usr/bin/env python3\r\n# Licensed under MIT\r\n\r\nimport os  # stdlib\r\n\r\n\r\n\r\nDOC = \"\"\"# not a comment\"\"\"   \r\n",
+			transforms: all,
+			want:       "#!/usr/bin/env python3\nimport os\n\nDOC = \"\"\"# not a comment\"\"\"",
+		},
+		{
+			name:       "shebang in a script",
+			path:       "cli.js",
+			content:    "#!/usr/bin/env node\n// entry point\nmain()\n",
+			transforms: []string{TransformStripComments},
+			want:       "#!/usr/bin/env node\nmain()\n",
+		},
+		{
+			name:       "unknown language keeps comments",
+			path:       "notes.txt",
+			content:    "// not code\n\n\n\ntext  \n",
+			transforms: all,
+			want:       "// not code\n\ntext",
+		},
+		{
+			name:       "no transforms",
+			path:       "a.go",
+			content:    "// comment\r\npackage a\r\n",
+			transforms: nil,
+			want:       "// comment\r\npackage a\r\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, stats := applyTransforms(tt.path, tt.content, tt.transforms)
+			if got != tt.want {
+				t.Errorf("transformed = %q, want %q", got, tt.want)
+			}
+			if stats.BytesBefore != len(tt.content) || stats.BytesAfter != len(got) || stats.BytesSaved != len(tt.content)-len(got) {
+				t.Errorf("stats = %+v for %d bytes in and %d out", stats, len(tt.content), len(got))
+			}
+		})
+	}
+}
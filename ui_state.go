@@ -0,0 +1,33 @@
+package main
+
+import "fmt"
+
+// --- Persisted UI state ---
+
+// GetUIState returns the frontend state saved with SaveUIState.
+func (a *App) GetUIState() map[string]interface{} {
+	state := make(map[string]interface{}, len(a.settings.UIState))
+	for k, v := range a.settings.UIState {
+		state[k] = v
+	}
+	return state
+}
+
+// SaveUIState merges the given keys into the persisted frontend state. A nil
+// value removes the key.
+func (a *App) SaveUIState(state map[string]interface{}) error {
+	if a.settings.UIState == nil {
+		a.settings.UIState = make(map[string]interface{})
+	}
+	for k, v := range state {
+		if v == nil {
+			delete(a.settings.UIState, k)
+		} else {
+			a.settings.UIState[k] = v
+		}
+	}
+	if err := a.saveSettings(); err != nil {
+		return fmt.Errorf("failed to save UI state: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	gitignore "github.com/sabhiram/go-gitignore"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// --- Multi-root workspaces ---
+
+// WorkspaceRoot is one repository of a multi-root workspace.
+type WorkspaceRoot struct {
+	Alias         string   `json:"alias"`         // Prefix for <file> paths; defaults to the directory name
+	RootDir       string   `json:"rootDir"`       // Absolute path of the repository
+	ExcludedPaths []string `json:"excludedPaths"` // Paths relative to RootDir, as in FileNode.RelPath
+	IgnoreRules   string   `json:"ignoreRules"`   // Extra gitignore-style rules for this root only
+}
+
+// WorkspaceRoute tells which root a prefixed context path belongs to.
+type WorkspaceRoute struct {
+	Alias   string `json:"alias"`
+	RootDir string `json:"rootDir"`
+	RelPath string `json:"relPath"` // Path inside RootDir, forward slashes
+}
+
+// normalizeWorkspaceRoots fills in default aliases and rejects ambiguous workspaces.
+func normalizeWorkspaceRoots(roots []WorkspaceRoot) ([]WorkspaceRoot, error) {
+	if len(roots) == 0 {
+		return nil, fmt.Errorf("workspace has no roots")
+	}
+	seen := make(map[string]bool, len(roots))
+	normalized := make([]WorkspaceRoot, len(roots))
+	for i, root := range roots {
+		if strings.TrimSpace(root.RootDir) == "" {
+			return nil, fmt.Errorf("workspace root %d has no directory", i)
+		}
+		root.RootDir = filepath.Clean(root.RootDir)
+		alias := strings.TrimSpace(root.Alias)
+		if alias == "" {
+			alias = filepath.Base(root.RootDir)
+		}
+		if strings.ContainsAny(alias, `/\`) || alias == "." || alias == ".." {
+			return nil, fmt.Errorf("invalid workspace alias '%s'", alias)
+		}
+		if seen[alias] {
+			return nil, fmt.Errorf("duplicate workspace alias '%s'", alias)
+		}
+		seen[alias] = true
+		root.Alias = alias
+		normalized[i] = root
+	}
+	return normalized, nil
+}
+
+// contextRootFor compiles the ignore rules of a workspace root. Each root uses
+// its own .gitignore, the app-wide custom rules and its own extra rules.
+func (a *App) contextRootFor(root WorkspaceRoot) (*contextRoot, error) {
+	info, err := os.Stat(root.RootDir)
+	if err != nil {
+		return nil, fmt.Errorf("workspace root %s: %w", root.Alias, err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("workspace root %s: %s is not a directory", root.Alias, root.RootDir)
+	}
+
+	cr := &contextRoot{dir: root.RootDir, alias: root.Alias, excluded: make(map[string]bool)}
+	for _, p := range root.ExcludedPaths {
+		cr.excluded[filepath.Clean(p)] = true
+	}
+	if a.useGitignore {
+		gitignorePath := filepath.Join(root.RootDir, ".gitignore")
+		if _, err := os.Stat(gitignorePath); err == nil {
+			gitIgn, err := gitignore.CompileIgnoreFile(gitignorePath)
+			if err != nil {
+				runtime.LogWarningf(a.ctx, "Error compiling .gitignore file at %s: %v", gitignorePath, err)
+			} else {
+				cr.ignores = append(cr.ignores, gitIgn)
+			}
+		}
+	}
+	if a.useCustomIgnore && a.currentCustomIgnorePatterns != nil {
+		cr.ignores = append(cr.ignores, a.currentCustomIgnorePatterns)
+	}
+	if strings.TrimSpace(root.IgnoreRules) != "" {
+		lines := strings.Split(strings.ReplaceAll(root.IgnoreRules, "\r\n", "\n"), "\n")
+		cr.ignores = append(cr.ignores, gitignore.CompileIgnoreLines(lines...))
+	}
+	return cr, nil
+}
+
+// RequestMultiRootContextGeneration generates one context from several roots.
+// Each root is rendered as its own tree labeled with its alias, and every
+// <file> path is prefixed with that alias.
+func (a *App) RequestMultiRootContextGeneration(roots []WorkspaceRoot, opts ContextGenerationOptions) {
+	if a.contextGenerator == nil {
+		runtime.LogError(a.ctx, "ContextGenerator not initialized")
+		runtime.EventsEmit(a.ctx, "shotgunContextError", "Internal error: ContextGenerator not initialized")
+		return
+	}
+	normalized, err := normalizeWorkspaceRoots(roots)
+	if err != nil {
+		runtime.EventsEmit(a.ctx, "shotgunContextError", fmt.Sprintf("Invalid workspace: %v", err))
+		return
+	}
+	contextRoots := make([]*contextRoot, 0, len(normalized))
+	labels := make([]string, 0, len(normalized))
+	archiveEntry := &ContextArchiveEntry{Options: opts, ExcludedPaths: []string{}}
+	for _, root := range normalized {
+		cr, err := a.contextRootFor(root)
+		if err != nil {
+			runtime.EventsEmit(a.ctx, "shotgunContextError", fmt.Sprintf("Invalid workspace: %v", err))
+			return
+		}
+		contextRoots = append(contextRoots, cr)
+		labels = append(labels, root.Alias+"="+root.RootDir)
+		archiveEntry.Roots = append(archiveEntry.Roots, root.RootDir)
+		for _, p := range root.ExcludedPaths {
+			archiveEntry.ExcludedPaths = append(archiveEntry.ExcludedPaths, root.Alias+"/"+filepath.ToSlash(p))
+		}
+	}
+
+	a.contextGenerator.requestShotgunContextGenerationInternal(strings.Join(labels, ", "), archiveEntry, func(jobCtx context.Context) (string, error) {
+		return a.generateContextOutput(jobCtx, contextRoots, opts)
+	})
+}
+
+// RouteWorkspacePath maps an alias-prefixed path from a multi-root context or
+// patch (optionally with the "a/" or "b/" diff prefix) back to its root.
+func (a *App) RouteWorkspacePath(roots []WorkspaceRoot, prefixedPath string) (*WorkspaceRoute, error) {
+	normalized, err := normalizeWorkspaceRoots(roots)
+	if err != nil {
+		return nil, err
+	}
+	return routeWorkspacePath(normalized, prefixedPath)
+}
+
+func routeWorkspacePath(roots []WorkspaceRoot, prefixedPath string) (*WorkspaceRoute, error) {
+	p := strings.TrimPrefix(filepath.ToSlash(prefixedPath), "./")
+	candidates := []string{p}
+	if strings.HasPrefix(p, "a/") || strings.HasPrefix(p, "b/") {
+		candidates = append(candidates, p[2:])
+	}
+	for _, candidate := range candidates {
+		alias, rest, found := strings.Cut(candidate, "/")
+		if !found {
+			continue
+		}
+		for _, root := range roots {
+			if root.Alias == alias {
+				if _, err := resolvePatchPath(root.RootDir, rest); err != nil {
+					return nil, err
+				}
+				return &WorkspaceRoute{Alias: alias, RootDir: root.RootDir, RelPath: path.Clean(rest)}, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("path %s does not start with a workspace alias", prefixedPath)
+}
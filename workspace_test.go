@@ -0,0 +1,42 @@
+package main
+
+import "testing"
+
+func TestRouteWorkspacePath(t *testing.T) {
+	roots := []WorkspaceRoot{
+		{Alias: "front", RootDir: "/src/front"},
+		{Alias: "back", RootDir: "/src/back"},
+	}
+	tests := []struct {
+		path    string
+		alias   string
+		relPath string // Empty means the path is rejected
+	}{
+		{path: "front/src/app.ts", alias: "front", relPath: "src/app.ts"},
+		{path: "b/back/cmd/main.go", alias: "back", relPath: "cmd/main.go"},
+		{path: "./back/a/../b.go", alias: "back", relPath: "b.go"},
+		{path: "front/../../etc/x"},
+		{path: "a/back/../../x"},
+		{path: "back/.."},
+		{path: "back/"},
+		{path: "other/x.go"},
+		{path: "front"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			route, err := routeWorkspacePath(roots, tt.path)
+			if tt.relPath == "" {
+				if err == nil {
+					t.Fatalf("route = %+v, want an error", route)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if route.Alias != tt.alias || route.RelPath != tt.relPath {
+				t.Errorf("route = %s/%s, want %s/%s", route.Alias, route.RelPath, tt.alias, tt.relPath)
+			}
+		})
+	}
+}